@@ -1,53 +1,112 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-idis/internal/config"
 	"go-idis/internal/idis"
 	"go-idis/server"
 	"log"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
 	"time"
 )
 
 // main is the entry point of the application. It initializes and runs an in-memory key-value store server
 // with both HTTP and Telnet interfaces. The server includes the following features:
 //
+// - Loads its settings from the file given with -config, IDIS_* environment variables and flags,
+//   see internal/config; run with -help to list them
 // - Creates an in-memory repository for storing key-value pairs
 // - Starts HTTP server on 0.0.0.0:1234
 // - Starts Telnet server on 0.0.0.0:5678
-// - Implements an automatic cleanup mechanism that deletes all keys after 2 minutes of server start
+// - Starts RESP server on 0.0.0.0:6379 for Redis clients
+// - Optionally deletes all keys every reset-interval, for servers open to the Internet
+// - Replays the append-only file 'appendonly.aof' before accepting clients, then logs every change to it,
+//   syncing it to disk every second
+// - Removes expired keys in the background every 100 milliseconds
 // - Sets up periodic data persistence by dumping the store contents to 'dump.json' every 2 hours
+// - Shuts down gracefully on SIGINT, SIGTERM or the SHUTDOWN command: stops accepting connections,
+//   lets in-flight commands finish, closes the append-only file and writes a final snapshot
 //
-// The server runs until an error occurs or the process is terminated.
+// The addresses, files and intervals above are the defaults.
+// The server runs until it is shut down or an error occurs.
 // If the server encounters a fatal error, it will log the error and terminate the program.
 
 func main() {
-	// Initialize the	 in-memory repository
-	store := idis.NewInMemoryRepository()
+	// Load the settings
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.Path() != "" {
+		fmt.Println("Configuration loaded from", cfg.Path())
+	}
+	if cfg.RuntimeMemoryLimit > 0 {
+		debug.SetMemoryLimit(cfg.RuntimeMemoryLimit)
+	}
+
+	// Initialize the in-memory repository
+	store := idis.NewShardedRepository(cfg.Shards)
+	store.SetNotifyFlags(cfg.NotifyFlags)
+	store.SetSnapshotFormat(cfg.SnapshotFormat)
+	store.SetSnapshotCompression(cfg.SnapshotCompression)
+	store.SetDumpFile(cfg.DumpFile)
+	store.SetMaxMemory(cfg.MaxMemory)
+	store.SetEvictionPolicy(cfg.MaxMemoryPolicy)
+	store.SetMaxMemorySamples(cfg.MaxMemorySamples)
 
 	// Create a new server instance
-	httpAddr := "0.0.0.0:1234"   // HTTP server address
-	telnetAddr := "0.0.0.0:5678" // Telnet server address
-	srv := server.NewServer(httpAddr, telnetAddr, store)
+	srv := server.NewServer(cfg, store)
 
-	// Goroutine to delete all keys after 5 minutes of server start (for because of deploying on Internet)
-	go func() {
-		// Wait for 5 minutes
-		time.Sleep(2 * time.Minute)
-
-		// Delete all keys
-		err := store.DeleteAll()
-		if err != nil {
-			log.Printf("Error deleting all keys: %v", err)
-		} else {
-			log.Println("All keys deleted successfully after 2 minutes.")
+	// Rebuild the keyspace from the append-only file and keep logging to it
+	store.SetFsyncPolicy(cfg.AppendFsync)
+	if cfg.AppendOnly {
+		if err := store.OpenAOF(cfg.AppendFilename); err != nil {
+			log.Fatalf("Failed to load append-only file: %v", err)
 		}
-	}()
+	}
+
+	// Delete all keys periodically, for servers open to the Internet
+	if cfg.ResetInterval > 0 {
+		go func() {
+			for range time.Tick(cfg.ResetInterval) {
+				err := store.DeleteAll()
+				if err != nil {
+					log.Printf("Error deleting all keys: %v", err)
+				} else {
+					log.Printf("All keys deleted, next reset in %v.", cfg.ResetInterval)
+				}
+			}
+		}()
+	}
+
+	// Remove expired keys in the background
+	store.StartActiveExpire(cfg.ExpireCycle)
 
 	// Set up periodic data dump to a file
-	filepath := "dump.json"
-	store.StartAutoDump(filepath, 2*time.Hour)
+	if cfg.SaveInterval > 0 {
+		store.StartAutoDump(cfg.DumpFile, cfg.SaveInterval)
+	}
+
+	// Shut down cleanly on SIGINT or SIGTERM; a second signal kills the process
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		fmt.Printf("Received %v\n", <-sig)
+		signal.Stop(sig)
+		srv.Shutdown(cfg.SaveInterval > 0)
+	}()
 
 	// Run the server
 	if err := srv.Run(); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,585 @@
+// Package config loads the settings of go-idis from a configuration file,
+// environment variables and command-line flags, each overriding the one
+// before, and writes them back to the file for CONFIG REWRITE.
+//
+// The file holds one directive per line, a name followed by its value, with
+// blank lines and lines starting with # ignored:
+//
+//	http-addr 0.0.0.0:1234
+//	save-interval 2h
+//	notify-keyspace-events ""
+//
+// Every directive can also be given as the flag -name value, or as the
+// environment variable IDIS_NAME, upper-cased with dashes turned into
+// underscores, such as IDIS_HTTP_ADDR.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-idis/internal/idis"
+)
+
+// EnvPrefix starts the names of the environment variables read by Load.
+const EnvPrefix = "IDIS_"
+
+// Config holds the settings of the server. The fields are meant to be read
+// once at startup; settings changed at runtime go through Set so that
+// Rewrite sees them.
+type Config struct {
+	HTTPAddr   string
+	TelnetAddr string
+	RESPAddr   string
+
+	Shards        int
+	ExpireCycle   time.Duration // interval of the active expire cycle
+	ResetInterval time.Duration // delete every key this often, 0 for never
+
+	DumpFile            string
+	SaveInterval        time.Duration // 0 disables periodic snapshots
+	SnapshotFormat      idis.SnapshotFormat
+	SnapshotCompression bool
+
+	AppendOnly     bool
+	AppendFilename string
+	AppendFsync    idis.FsyncPolicy
+
+	NotifyFlags        int
+	MaxMemory          int64 // limit of the keyspace in bytes, 0 for none
+	MaxMemoryPolicy    idis.EvictionPolicy
+	MaxMemorySamples   int
+	RuntimeMemoryLimit int64 // soft limit for the Go runtime in bytes, 0 for none
+
+	SlowlogLogSlowerThan int64 // microseconds, negative to disable the slow log
+	SlowlogMaxLen        int
+
+	ShutdownTimeout time.Duration
+
+	mu   sync.Mutex
+	path string // file loaded, empty if none
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		HTTPAddr:         "0.0.0.0:1234",
+		TelnetAddr:       "0.0.0.0:5678",
+		RESPAddr:         "0.0.0.0:6379",
+		Shards:           idis.DefaultShards,
+		ExpireCycle:      100 * time.Millisecond,
+		DumpFile:         "dump.json",
+		SaveInterval:     2 * time.Hour,
+		SnapshotFormat:   idis.SnapshotJSON,
+		AppendOnly:       true,
+		AppendFilename:   "appendonly.aof",
+		AppendFsync:      idis.FsyncEverySec,
+		MaxMemoryPolicy:  idis.NoEviction,
+		MaxMemorySamples: idis.DefaultMaxMemorySamples,
+
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+
+		ShutdownTimeout: 10 * time.Second,
+	}
+}
+
+// directive is a setting as named in the file, flags and CONFIG.
+type directive struct {
+	name  string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, value string) error
+}
+
+// directives lists the settings in the order Rewrite appends them.
+var directives = []directive{
+	{
+		name:  "http-addr",
+		usage: "address of the HTTP listener",
+		get:   func(c *Config) string { return c.HTTPAddr },
+		set:   func(c *Config, v string) error { c.HTTPAddr = v; return nil },
+	},
+	{
+		name:  "telnet-addr",
+		usage: "address of the telnet listener",
+		get:   func(c *Config) string { return c.TelnetAddr },
+		set:   func(c *Config, v string) error { c.TelnetAddr = v; return nil },
+	},
+	{
+		name:  "resp-addr",
+		usage: "address of the RESP listener",
+		get:   func(c *Config) string { return c.RESPAddr },
+		set:   func(c *Config, v string) error { c.RESPAddr = v; return nil },
+	},
+	{
+		name:  "shards",
+		usage: "number of shards the keyspace is split into",
+		get:   func(c *Config) string { return strconv.Itoa(c.Shards) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.Shards = n
+			return nil
+		},
+	},
+	{
+		name:  "expire-cycle",
+		usage: "interval of the background removal of expired keys",
+		get:   func(c *Config) string { return FormatDuration(c.ExpireCycle) },
+		set:   durationSetter(func(c *Config) *time.Duration { return &c.ExpireCycle }, false),
+	},
+	{
+		name:  "reset-interval",
+		usage: "delete every key this often, as on a public demo server; 0 for never",
+		get:   func(c *Config) string { return FormatDuration(c.ResetInterval) },
+		set:   durationSetter(func(c *Config) *time.Duration { return &c.ResetInterval }, true),
+	},
+	{
+		name:  "dbfilename",
+		usage: "file snapshots are written to",
+		get:   func(c *Config) string { return c.DumpFile },
+		set:   func(c *Config, v string) error { c.DumpFile = v; return nil },
+	},
+	{
+		name:  "save-interval",
+		usage: "interval of periodic snapshots; 0 disables them and the snapshot on shutdown",
+		get:   func(c *Config) string { return FormatDuration(c.SaveInterval) },
+		set:   durationSetter(func(c *Config) *time.Duration { return &c.SaveInterval }, true),
+	},
+	{
+		name:  "snapshot-format",
+		usage: "format of snapshots whose file name has no known extension: json or binary",
+		get:   func(c *Config) string { return c.SnapshotFormat.String() },
+		set: func(c *Config, v string) error {
+			format, err := idis.ParseSnapshotFormat(v)
+			if err != nil {
+				return err
+			}
+			c.SnapshotFormat = format
+			return nil
+		},
+	},
+	{
+		name:  "snapshot-compression",
+		usage: "compress binary snapshots: yes or no",
+		get:   func(c *Config) string { return YesNo(c.SnapshotCompression) },
+		set: func(c *Config, v string) error {
+			b, err := ParseYesNo(v)
+			if err != nil {
+				return err
+			}
+			c.SnapshotCompression = b
+			return nil
+		},
+	},
+	{
+		name:  "appendonly",
+		usage: "log every change to the append-only file and replay it on startup: yes or no",
+		get:   func(c *Config) string { return YesNo(c.AppendOnly) },
+		set: func(c *Config, v string) error {
+			b, err := ParseYesNo(v)
+			if err != nil {
+				return err
+			}
+			c.AppendOnly = b
+			return nil
+		},
+	},
+	{
+		name:  "appendfilename",
+		usage: "path of the append-only file",
+		get:   func(c *Config) string { return c.AppendFilename },
+		set:   func(c *Config, v string) error { c.AppendFilename = v; return nil },
+	},
+	{
+		name:  "appendfsync",
+		usage: "how often the append-only file is synced: always, everysec or no",
+		get:   func(c *Config) string { return c.AppendFsync.String() },
+		set: func(c *Config, v string) error {
+			policy, err := idis.ParseFsyncPolicy(v)
+			if err != nil {
+				return err
+			}
+			c.AppendFsync = policy
+			return nil
+		},
+	},
+	{
+		name:  "notify-keyspace-events",
+		usage: "classes of keyspace notifications to publish, as in Redis",
+		get:   func(c *Config) string { return idis.NotifyFlagsString(c.NotifyFlags) },
+		set: func(c *Config, v string) error {
+			flags, err := idis.ParseNotifyFlags(v)
+			if err != nil {
+				return err
+			}
+			c.NotifyFlags = flags
+			return nil
+		},
+	},
+	{
+		name:  "maxmemory",
+		usage: "memory the keys may use before some are evicted, such as 512mb; 0 for no limit",
+		get:   func(c *Config) string { return FormatMemory(c.MaxMemory) },
+		set: func(c *Config, v string) error {
+			n, err := ParseMemory(v)
+			if err != nil {
+				return err
+			}
+			c.MaxMemory = n
+			return nil
+		},
+	},
+	{
+		name:  "maxmemory-policy",
+		usage: "keys evicted past maxmemory: noeviction, allkeys-lru, allkeys-lfu, allkeys-random, volatile-lru, volatile-lfu, volatile-random or volatile-ttl",
+		get:   func(c *Config) string { return c.MaxMemoryPolicy.String() },
+		set: func(c *Config, v string) error {
+			policy, err := idis.ParseEvictionPolicy(v)
+			if err != nil {
+				return err
+			}
+			c.MaxMemoryPolicy = policy
+			return nil
+		},
+	},
+	{
+		name:  "maxmemory-samples",
+		usage: "keys sampled per eviction; more approximate the policy better",
+		get:   func(c *Config) string { return strconv.Itoa(c.MaxMemorySamples) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			c.MaxMemorySamples = n
+			return nil
+		},
+	},
+	{
+		name:  "runtime-memory-limit",
+		usage: "soft memory limit of the Go runtime, such as 512mb; 0 for none",
+		get:   func(c *Config) string { return FormatMemory(c.RuntimeMemoryLimit) },
+		set: func(c *Config, v string) error {
+			n, err := ParseMemory(v)
+			if err != nil {
+				return err
+			}
+			c.RuntimeMemoryLimit = n
+			return nil
+		},
+	},
+	{
+		name:  "slowlog-log-slower-than",
+		usage: "microseconds after which a command is logged to the slow log; 0 logs all, negative none",
+		get:   func(c *Config) string { return strconv.FormatInt(c.SlowlogLogSlowerThan, 10) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("argument must be an integer")
+			}
+			c.SlowlogLogSlowerThan = n
+			return nil
+		},
+	},
+	{
+		name:  "slowlog-max-len",
+		usage: "number of entries kept in the slow log",
+		get:   func(c *Config) string { return strconv.Itoa(c.SlowlogMaxLen) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			c.SlowlogMaxLen = n
+			return nil
+		},
+	},
+	{
+		name:  "shutdown-timeout",
+		usage: "how long shutting down waits for running commands and requests",
+		get:   func(c *Config) string { return FormatDuration(c.ShutdownTimeout) },
+		set:   durationSetter(func(c *Config) *time.Duration { return &c.ShutdownTimeout }, false),
+	},
+}
+
+func durationSetter(field func(c *Config) *time.Duration, zero bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		if d < 0 || (d == 0 && !zero) {
+			return fmt.Errorf("duration must be positive")
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func findDirective(name string) (directive, bool) {
+	for _, d := range directives {
+		if strings.EqualFold(d.name, name) {
+			return d, true
+		}
+	}
+	return directive{}, false
+}
+
+// Names returns the names of the settings.
+func Names() []string {
+	names := make([]string, len(directives))
+	for i, d := range directives {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Get returns the value of a setting as written in the file.
+func (c *Config) Get(name string) (string, bool) {
+	d, ok := findDirective(name)
+	if !ok {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return d.get(c), true
+}
+
+// Set parses value into a setting.
+func (c *Config) Set(name, value string) error {
+	d, ok := findDirective(name)
+	if !ok {
+		return fmt.Errorf("unknown directive '%s'", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := d.set(c, value); err != nil {
+		return fmt.Errorf("invalid value for '%s': %v", d.name, err)
+	}
+	return nil
+}
+
+// Path returns the configuration file the settings were loaded from, or ""
+// if there was none.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Load builds the settings from the defaults, then the configuration file,
+// then environment variables and last the command-line flags in args. The
+// file is named by the -config flag or the IDIS_CONFIG variable; without
+// one, only the other sources are used.
+func Load(args []string) (*Config, error) {
+	c := Default()
+
+	type flagValue struct{ name, value string }
+	var flags []flagValue
+	path := os.Getenv(EnvPrefix + "CONFIG")
+	fs := flag.NewFlagSet("go-idis", flag.ContinueOnError)
+	fs.StringVar(&path, "config", path, "configuration `file` to load and to write back with CONFIG REWRITE")
+	for _, d := range directives {
+		name := d.name
+		fs.Func(name, fmt.Sprintf("%s (default %q)", d.usage, d.get(c)), func(value string) error {
+			// Checked now so the error names the flag, applied after the file
+			if err := d.set(Default(), value); err != nil {
+				return err
+			}
+			flags = append(flags, flagValue{name, value})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument '%s'", fs.Arg(0))
+	}
+
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+		c.path = path
+	}
+	for _, d := range directives {
+		env := EnvName(d.name)
+		if value, ok := os.LookupEnv(env); ok {
+			if err := d.set(c, value); err != nil {
+				return nil, fmt.Errorf("%s: %v", env, err)
+			}
+		}
+	}
+	for _, f := range flags {
+		if err := c.Set(f.name, f.value); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// EnvName returns the environment variable setting a directive.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// loadFile applies the directives of a configuration file.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	lines, err := readLines(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for i, line := range lines {
+		name, value, ok, err := parseLine(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+// parseLine splits a line of a configuration file into a directive and its
+// value, which may be double-quoted. ok is false for blank and comment lines.
+func parseLine(line string) (name, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", "", false, nil
+	}
+	name = line
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, value = line[:i], strings.TrimSpace(line[i:])
+	}
+	if strings.HasPrefix(value, `"`) {
+		if value, err = strconv.Unquote(value); err != nil {
+			return "", "", false, fmt.Errorf("invalid quoted value for '%s'", name)
+		}
+	}
+	return name, value, true, nil
+}
+
+// formatValue quotes a value that would not read back as it is.
+func formatValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"#") || strings.TrimSpace(value) != value {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// Rewrite writes the settings back to the configuration file. Lines setting
+// a directive are updated in place and comments are kept; directives the
+// file does not mention are appended when they differ from the default.
+func (c *Config) Rewrite() error {
+	if c.path == "" {
+		return errors.New("the server is running without a config file")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lines []string
+	if f, err := os.Open(c.path); err == nil {
+		lines, err = readLines(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var out []string
+	written := make(map[string]bool)
+	for _, line := range lines {
+		name, _, ok, err := parseLine(line)
+		if err != nil || !ok {
+			out = append(out, line)
+			continue
+		}
+		d, known := findDirective(name)
+		if !known {
+			out = append(out, line)
+			continue
+		}
+		if written[d.name] {
+			// Only the last occurrence took effect, keep a single one
+			continue
+		}
+		written[d.name] = true
+		out = append(out, d.name+" "+formatValue(d.get(c)))
+	}
+
+	defaults := Default()
+	header := false
+	for _, d := range directives {
+		if written[d.name] || d.get(c) == d.get(defaults) {
+			continue
+		}
+		if !header {
+			out = append(out, "# Generated by CONFIG REWRITE")
+			header = true
+		}
+		out = append(out, d.name+" "+formatValue(d.get(c)))
+	}
+	return writeFile(c.path, strings.Join(out, "\n")+"\n")
+}
+
+// writeFile replaces path by way of a temporary file renamed over it, so a
+// crash leaves the old file or the new one.
+func writeFile(path, content string) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses a duration such as 2h or 1m30s. A bare number is a
+// number of seconds.
+func ParseDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+	return d, nil
+}
+
+// FormatDuration formats d without the zero minutes and seconds
+// time.Duration.String leaves in, so 2h rather than 2h0m0s.
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0"
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// memoryUnits are the suffixes ParseMemory accepts, as in redis.conf: k, m
+// and g are powers of 1000, kb, mb and gb powers of 1024.
+var memoryUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+	{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000},
+	{"b", 1},
+}
+
+// ParseMemory parses an amount of memory such as 512mb into bytes.
+func ParseMemory(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	unit := int64(1)
+	for _, u := range memoryUnits {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower, unit = strings.TrimSuffix(lower, u.suffix), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("invalid memory amount '%s'", s)
+	}
+	return n * unit, nil
+}
+
+// FormatMemory formats bytes with the largest of gb, mb and kb dividing it.
+func FormatMemory(bytes int64) string {
+	for _, u := range memoryUnits[:3] {
+		if bytes != 0 && bytes%u.bytes == 0 {
+			return strconv.FormatInt(bytes/u.bytes, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// FormatHuman formats bytes for reading, such as 1.50M, as INFO does.
+func FormatHuman(bytes int64) string {
+	const units = "KMGTPE"
+	if bytes < 1024 {
+		return strconv.FormatInt(bytes, 10) + "B"
+	}
+	n, i := float64(bytes)/1024, 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%c", n, units[i])
+}
+
+// YesNo formats a boolean setting.
+func YesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// ParseYesNo parses a boolean setting.
+func ParseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("argument must be 'yes' or 'no'")
+}
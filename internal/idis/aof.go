@@ -0,0 +1,717 @@
+package idis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The append-only file (AOF) logs every modification of the repository as a
+// RESP array, like the Redis AOF, and is replayed on startup to rebuild the
+// keyspace. Records are written while the modified key's shard is locked, so
+// the records of a key are in the order its changes were made.
+//
+// Records describe the effect of an operation rather than the call that made
+// it whenever the call is not deterministic: expiry is logged as an absolute
+// PEXPIREAT, automatic stream IDs as the ID chosen, SETUQ as a RESTORE of the
+// resulting list and keys removed on expiry as DEL.
+
+// FsyncPolicy says how often the AOF is flushed to disk.
+type FsyncPolicy int32
+
+const (
+	// FsyncEverySec syncs once per second, losing at most a second of writes.
+	FsyncEverySec FsyncPolicy = iota
+	// FsyncAlways syncs after every record.
+	FsyncAlways
+	// FsyncNo leaves flushing to the operating system.
+	FsyncNo
+)
+
+// ParseFsyncPolicy parses "always", "everysec" or "no".
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySec, nil
+	case "no":
+		return FsyncNo, nil
+	}
+	return 0, fmt.Errorf("invalid fsync policy '%s', expected always, everysec or no", s)
+}
+
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncAlways:
+		return "always"
+	case FsyncNo:
+		return "no"
+	}
+	return "everysec"
+}
+
+// appendOnlyFile is an open AOF.
+type appendOnlyFile struct {
+	mu       sync.Mutex // serialises writes
+	filename string
+	f        *os.File
+	buf      []byte // encoding buffer, reused between records
+	failed   bool   // a write failed and logging stopped
+	size     int64  // current size of the file
+	baseSize int64  // size when opened or last rewritten
+
+	// While a rewrite is in progress, records are also kept in rewriteBuf
+	// to be appended to the rewritten file.
+	rewriting  bool
+	rewriteBuf []byte
+
+	policy *atomic.Int32 // FsyncPolicy, shared with the repository
+	dirty  atomic.Bool   // written since the last sync
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// write appends a record made of head followed by args.
+func (a *appendOnlyFile) write(head, args []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failed {
+		return
+	}
+
+	a.buf = appendRecordHeader(a.buf[:0], len(head)+len(args))
+	for _, arg := range head {
+		a.buf = appendRecordArg(a.buf, arg)
+	}
+	for _, arg := range args {
+		a.buf = appendRecordArg(a.buf, arg)
+	}
+	if _, err := a.f.Write(a.buf); err != nil {
+		// A partial record could only be recovered from at the end of the
+		// file, so nothing more is appended after it
+		fmt.Println("Error writing append-only file, logging stopped:", err)
+		a.failed = true
+		return
+	}
+	a.size += int64(len(a.buf))
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, a.buf...)
+	}
+	if FsyncPolicy(a.policy.Load()) == FsyncAlways {
+		a.f.Sync()
+	} else {
+		a.dirty.Store(true)
+	}
+}
+
+// aofLoop syncs the file once per second under the everysec policy and
+// starts a rewrite once the file has grown enough. Syncing does not hold
+// mu, so writers are never held up by the disk.
+func (r *InMemoryRepository) aofLoop(a *appendOnlyFile) {
+	defer close(a.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			f, size, baseSize := a.f, a.size, a.baseSize
+			a.mu.Unlock()
+			if FsyncPolicy(a.policy.Load()) == FsyncEverySec && a.dirty.Swap(false) {
+				f.Sync()
+			}
+			if size >= autoRewriteMinSize && size >= baseSize*(100+autoRewritePercentage)/100 {
+				r.BgRewriteAOF()
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+func appendRecordHeader(buf []byte, n int) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, '\r', '\n')
+}
+
+func appendRecordArg(buf []byte, arg string) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, arg...)
+	return append(buf, '\r', '\n')
+}
+
+// errTruncatedRecord is returned by readRecord when the file ends inside a record.
+var errTruncatedRecord = errors.New("truncated record")
+
+// maxRecordArg bounds the length of a record argument, so a damaged length
+// cannot make the loader allocate without limit.
+const maxRecordArg = 512 << 20
+
+// readRecord reads one record and returns it with its size in bytes. It
+// returns io.EOF at the clean end of the file.
+func readRecord(br *bufio.Reader) ([]string, int64, error) {
+	var size int64
+	readLine := func() (string, error) {
+		line, err := br.ReadString('\n')
+		size += int64(len(line))
+		if err == io.EOF {
+			if size == 0 {
+				return "", io.EOF
+			}
+			return "", errTruncatedRecord
+		}
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			return "", errors.New("invalid line ending")
+		}
+		return line[:len(line)-2], nil
+	}
+	readCount := func(prefix byte) (int, error) {
+		line, err := readLine()
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 2 || line[0] != prefix {
+			return 0, fmt.Errorf("expected '%c'", prefix)
+		}
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 || n > maxRecordArg {
+			return 0, fmt.Errorf("invalid length %q", line[1:])
+		}
+		return n, nil
+	}
+
+	n, err := readCount('*')
+	if err != nil {
+		return nil, size, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		length, err := readCount('$')
+		if err != nil {
+			return nil, size, err
+		}
+		data := make([]byte, length+2)
+		read, err := io.ReadFull(br, data)
+		size += int64(read)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, size, errTruncatedRecord
+		}
+		if err != nil {
+			return nil, size, err
+		}
+		if data[length] != '\r' || data[length+1] != '\n' {
+			return nil, size, errors.New("invalid argument terminator")
+		}
+		args[i] = string(data[:length])
+	}
+	return args, size, nil
+}
+
+// OpenAOF replays the AOF at filename, if it exists, and then logs every
+// modification to it, syncing as set with SetFsyncPolicy. A record cut short
+// at the end of the file, as left by a crash in the middle of a write, is
+// dropped and the file truncated before it; any other damage, such as a
+// record cut short but followed by another, fails the load.
+// Keys do not expire while the file is replayed, so each record is applied
+// to the keyspace as it was when logged.
+func (r *InMemoryRepository) OpenAOF(filename string) error {
+	if r.aof.Load() != nil {
+		return errors.New("append-only file already open")
+	}
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	loaded, err := r.replayAOF(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(loaded, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	a := &appendOnlyFile{
+		filename: filename,
+		f:        f,
+		size:     loaded,
+		baseSize: loaded,
+		policy:   &r.fsync,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	r.aof.Store(a)
+	go r.aofLoop(a)
+	return nil
+}
+
+// replayAOF applies the records of f and returns the offset following the
+// last complete record.
+func (r *InMemoryRepository) replayAOF(f *os.File) (int64, error) {
+	r.loading.Store(true)
+	defer r.loading.Store(false)
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	var offset int64
+	records := 0
+	for {
+		args, size, err := readRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errTruncatedRecord) {
+			// A crash only cuts the last record short. One followed by
+			// another was damaged, most likely in a length that now runs
+			// past the end of the file.
+			follows, err := recordFollows(f, offset)
+			if err != nil {
+				return 0, err
+			}
+			if follows {
+				return 0, fmt.Errorf("append-only file is corrupt at offset %d: a truncated record is followed by another", offset)
+			}
+			fmt.Printf("Append-only file ends with a truncated record, discarding the last %d bytes\n", size)
+			if err := f.Truncate(offset); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("append-only file is corrupt at offset %d: %w", offset, err)
+		}
+		if len(args) == 0 {
+			return 0, fmt.Errorf("append-only file has an empty record at offset %d", offset)
+		}
+		if err := r.applyRecord(args); err != nil {
+			return 0, fmt.Errorf("append-only file record %s at offset %d: %w", args[0], offset, err)
+		}
+		offset += size
+		records++
+	}
+	if records > 0 {
+		fmt.Printf("Loaded %d records from the append-only file\n", records)
+	}
+	return offset, nil
+}
+
+// recordFollows reports whether a complete record starts on any line of f
+// after offset.
+func recordFollows(f *os.File, offset int64) (bool, error) {
+	tail, err := io.ReadAll(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+	if err != nil {
+		return false, err
+	}
+	for i := 0; ; {
+		next := bytes.Index(tail[i:], []byte("\r\n*"))
+		if next < 0 {
+			return false, nil
+		}
+		i += next + 2
+		args, _, err := readRecord(bufio.NewReader(bytes.NewReader(tail[i:])))
+		if err == nil && len(args) > 0 {
+			return true, nil
+		}
+	}
+}
+
+// CloseAOF syncs and closes the AOF. Later modifications are not logged.
+func (r *InMemoryRepository) CloseAOF() error {
+	a := r.aof.Swap(nil)
+	if a == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failed = true
+	if err := a.f.Sync(); err != nil {
+		a.f.Close()
+		return err
+	}
+	return a.f.Close()
+}
+
+// SetFsyncPolicy sets how often the AOF is synced. It may be changed while
+// the file is open.
+func (r *InMemoryRepository) SetFsyncPolicy(policy FsyncPolicy) {
+	r.fsync.Store(int32(policy))
+}
+
+// FsyncPolicy returns the fsync policy of the AOF.
+func (r *InMemoryRepository) FsyncPolicy() FsyncPolicy {
+	return FsyncPolicy(r.fsync.Load())
+}
+
+// propagating reports whether modifications are being logged. Callers check
+// it before building a record that needs allocating.
+func (r *InMemoryRepository) propagating() bool {
+	return r.aof.Load() != nil
+}
+
+// propagate logs a record to the AOF, if one is open. It is called with the
+// shard of the modified key write-locked.
+func (r *InMemoryRepository) propagate(args ...string) {
+	if a := r.aof.Load(); a != nil {
+		a.write(args, nil)
+	}
+}
+
+// propagateValues logs a record made of head followed by values.
+func (r *InMemoryRepository) propagateValues(values []string, head ...string) {
+	if a := r.aof.Load(); a != nil {
+		a.write(head, values)
+	}
+}
+
+// propagateRestore logs the whole value of key, with its deadline if it has
+// one. The caller must hold the write lock of the key's shard.
+func (r *InMemoryRepository) propagateRestore(s *shard, key string) {
+	if !r.propagating() {
+		return
+	}
+	d, err := encodeValue(s.store[key])
+	if err != nil {
+		return
+	}
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	if expiration, ok := s.expiry[key]; ok {
+		r.propagate("RESTORE", key, string(payload), "PXAT", strconv.FormatInt(expiration.UnixMilli(), 10))
+	} else {
+		r.propagate("RESTORE", key, string(payload))
+	}
+}
+
+// streamIDStrings formats ids for a record.
+func streamIDStrings(ids []StreamID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
+
+// errRecordSyntax is returned for a record with the wrong arguments.
+var errRecordSyntax = errors.New("wrong number or format of arguments")
+
+// applyRecord replays one AOF record.
+func (r *InMemoryRepository) applyRecord(args []string) error {
+	cmd, args := strings.ToUpper(args[0]), args[1:]
+	need := func(n int) error {
+		if len(args) < n {
+			return errRecordSyntax
+		}
+		return nil
+	}
+	if cmd != "FLUSHALL" {
+		if err := need(1); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch cmd {
+	case "FLUSHALL":
+		err = r.DeleteAll()
+	case "DEL":
+		if err = r.Delete(args[0]); errors.Is(err, ErrKeyNotFound) {
+			err = nil
+		}
+	case "PEXPIREAT":
+		if err = need(2); err == nil {
+			var ms int64
+			if ms, err = strconv.ParseInt(args[1], 10, 64); err == nil {
+				err = r.expireAt(args[0], time.UnixMilli(ms))
+			}
+		}
+	case "RESTORE":
+		err = r.applyRestore(args)
+	case "SET":
+		err = r.Set(args[0], args[1:]...)
+	case "REMOVE":
+		if err = need(2); err == nil {
+			err = r.RemoveValue(args[0], args[1])
+		}
+	case "SETSTR":
+		if err = need(2); err == nil {
+			err = r.SetString(args[0], args[1])
+		}
+	case "INCRBY":
+		if err = need(2); err == nil {
+			var delta int64
+			if delta, err = strconv.ParseInt(args[1], 10, 64); err == nil {
+				_, err = r.IncrBy(args[0], delta)
+			}
+		}
+	case "APPEND":
+		if err = need(2); err == nil {
+			_, err = r.Append(args[0], args[1])
+		}
+	case "SADD":
+		_, err = r.SAdd(args[0], args[1:]...)
+	case "SREM":
+		_, err = r.SRem(args[0], args[1:]...)
+	case "ZADD":
+		if len(args)%2 != 1 {
+			return errRecordSyntax
+		}
+		members := make([]ScoredMember, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			score, err := ParseScore(args[i])
+			if err != nil {
+				return err
+			}
+			members = append(members, ScoredMember{Member: args[i+1], Score: score})
+		}
+		_, err = r.ZAdd(args[0], ZAddOptions{}, members...)
+	case "ZREM":
+		_, err = r.ZRem(args[0], args[1:]...)
+	case "HSET":
+		if len(args)%2 != 1 {
+			return errRecordSyntax
+		}
+		fields := make([]FieldValue, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			fields = append(fields, FieldValue{Field: args[i], Value: args[i+1]})
+		}
+		_, err = r.HSet(args[0], fields...)
+	case "HDEL":
+		_, err = r.HDel(args[0], args[1:]...)
+	case "LPUSH", "RPUSH":
+		_, err = r.Push(args[0], cmd == "LPUSH", false, args[1:]...)
+	case "LPOP", "RPOP":
+		if err = need(2); err == nil {
+			var count int
+			if count, err = strconv.Atoi(args[1]); err == nil {
+				_, err = r.Pop(args[0], cmd == "LPOP", count)
+			}
+		}
+	case "LSET":
+		if err = need(3); err == nil {
+			var index int
+			if index, err = strconv.Atoi(args[1]); err == nil {
+				err = r.LSet(args[0], index, args[2])
+			}
+		}
+	case "LINSERT":
+		if err = need(4); err == nil {
+			_, err = r.LInsert(args[0], strings.ToUpper(args[1]) == "BEFORE", args[2], args[3])
+		}
+	case "LREM":
+		if err = need(3); err == nil {
+			var count int
+			if count, err = strconv.Atoi(args[1]); err == nil {
+				_, err = r.LRem(args[0], count, args[2])
+			}
+		}
+	case "LTRIM":
+		if err = need(3); err == nil {
+			start, err1 := strconv.Atoi(args[1])
+			stop, err2 := strconv.Atoi(args[2])
+			if err = errors.Join(err1, err2); err == nil {
+				err = r.LTrim(args[0], start, stop)
+			}
+		}
+	case "XADD":
+		if err = need(4); err == nil {
+			_, _, err = r.XAdd(args[0], args[1], args[2:], false, NoTrim)
+		}
+	case "XTRIM":
+		if err = need(3); err == nil {
+			var trim StreamTrim
+			if trim, err = parseRecordTrim(args[1], args[2]); err == nil {
+				_, err = r.XTrim(args[0], trim)
+			}
+		}
+	case "XDEL":
+		var ids []StreamID
+		if ids, err = parseStreamIDs(args[1:]); err == nil {
+			_, err = r.XDel(args[0], ids...)
+		}
+	case "XGROUP":
+		err = r.applyXGroup(args)
+	case "XDELIVER":
+		err = r.applyDelivery(args)
+	case "XACK":
+		if err = need(2); err == nil {
+			var ids []StreamID
+			if ids, err = parseStreamIDs(args[2:]); err == nil {
+				_, err = r.XAck(args[0], args[1], ids...)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown record type")
+	}
+	return err
+}
+
+func parseStreamIDs(args []string) ([]StreamID, error) {
+	ids := make([]StreamID, len(args))
+	for i, arg := range args {
+		id, err := ParseStreamID(arg)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// recordTrim returns the XTRIM arguments describing t.
+func recordTrim(t StreamTrim) (string, string) {
+	if t.ByMinID {
+		return "MINID", t.MinID.String()
+	}
+	return "MAXLEN", strconv.FormatInt(t.MaxLen, 10)
+}
+
+func parseRecordTrim(strategy, threshold string) (StreamTrim, error) {
+	trim := NoTrim
+	switch strings.ToUpper(strategy) {
+	case "MAXLEN":
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return trim, err
+		}
+		trim.MaxLen = n
+	case "MINID":
+		id, err := ParseStreamID(threshold)
+		if err != nil {
+			return trim, err
+		}
+		trim.MinID, trim.ByMinID = id, true
+	default:
+		return trim, errRecordSyntax
+	}
+	return trim, nil
+}
+
+// applyRestore replays RESTORE key payload [PXAT ms], replacing the value of
+// key and its deadline.
+func (r *InMemoryRepository) applyRestore(args []string) error {
+	if len(args) != 2 && len(args) != 4 {
+		return errRecordSyntax
+	}
+	var d dumpValue
+	if err := json.Unmarshal([]byte(args[1]), &d); err != nil {
+		return err
+	}
+	v, err := decodeValue(d)
+	if err != nil {
+		return err
+	}
+	var expiration time.Time
+	if len(args) == 4 {
+		ms, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		expiration = time.UnixMilli(ms)
+	}
+
+	s := r.shardFor(args[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.restoreLocked(s, args[0], v, expiration)
+	return nil
+}
+
+// restoreLocked replaces the value stored at key, keeping the reverse lookup
+// in sync, and sets its deadline; a zero expiration removes it. The caller
+// must hold the write lock of the key's shard.
+func (r *InMemoryRepository) restoreLocked(s *shard, key string, v value, expiration time.Time) {
+	if old, ok := s.store[key]; ok {
+		for _, value := range indexedValues(old) {
+			r.unlink(value, key)
+		}
+	}
+	s.store[key] = v
+	for _, value := range indexedValues(v) {
+		r.link(value, key)
+	}
+	if expiration.IsZero() {
+		delete(s.expiry, key)
+	} else {
+		s.expiry[key] = expiration
+	}
+	r.account(s, key, time.Now())
+}
+
+// applyXGroup replays XGROUP CREATE key group id [MKSTREAM], DESTROY key
+// group, SETID key group id, CREATECONSUMER and DELCONSUMER key group consumer.
+func (r *InMemoryRepository) applyXGroup(args []string) error {
+	if len(args) < 3 {
+		return errRecordSyntax
+	}
+	sub, key, group := strings.ToUpper(args[0]), args[1], args[2]
+	var err error
+	switch {
+	case sub == "CREATE" && len(args) >= 4:
+		err = r.XGroupCreate(key, group, args[3], len(args) > 4)
+	case sub == "DESTROY":
+		_, err = r.XGroupDestroy(key, group)
+	case sub == "SETID" && len(args) == 4:
+		err = r.XGroupSetID(key, group, args[3])
+	case sub == "CREATECONSUMER" && len(args) == 4:
+		_, err = r.XGroupCreateConsumer(key, group, args[3])
+	case sub == "DELCONSUMER" && len(args) == 4:
+		_, err = r.XGroupDelConsumer(key, group, args[3])
+	default:
+		return errRecordSyntax
+	}
+	return err
+}
+
+// applyDelivery replays XDELIVER key group consumer ms NOACK|ACK id ..., the
+// record of entries delivered by XREADGROUP: the group's last delivered ID
+// moves to the last of them and, unless NOACK, they become pending for the
+// consumer as of ms.
+func (r *InMemoryRepository) applyDelivery(args []string) error {
+	if len(args) < 6 {
+		return errRecordSyntax
+	}
+	key, group, consumer := args[0], args[1], args[2]
+	ms, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return err
+	}
+	noAck := strings.ToUpper(args[4]) == "NOACK"
+	ids, err := parseStreamIDs(args[5:])
+	if err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := r.groupForWriteLocked(s, key, group, "XREADGROUP")
+	if err != nil {
+		return err
+	}
+	r.deliverLocked(g, consumer, time.UnixMilli(ms), noAck, ids)
+	return nil
+}
@@ -0,0 +1,235 @@
+package idis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record encodes args as an AOF record.
+func record(args ...string) string {
+	buf := appendRecordHeader(nil, len(args))
+	for _, arg := range args {
+		buf = appendRecordArg(buf, arg)
+	}
+	return string(buf)
+}
+
+// writeAOF writes content to a new AOF and returns its path.
+func writeAOF(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestReplayAOFTruncatedTail(t *testing.T) {
+	complete := record("SET", "a", "1") + record("SETSTR", "b", "2")
+	last := record("SET", "c", "3")
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{"inside the count", last[:1]},
+		{"after the count", last[:len("*3\r\n")]},
+		{"inside an argument length", last[:len("*3\r\n$")]},
+		{"inside an argument", last[:len("*3\r\n$3\r\nSE")]},
+		{"before the final CRLF", last[:len(last)-2]},
+		{"between CR and LF", last[:len(last)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAOF(t, complete+tt.tail)
+			r := NewShardedRepository(4)
+			if err := r.OpenAOF(path); err != nil {
+				t.Fatalf("OpenAOF() error = %v", err)
+			}
+			if got := fileSize(t, path); got != int64(len(complete)) {
+				t.Errorf("file truncated to %d bytes, want %d", got, len(complete))
+			}
+			if r.Exists("c") {
+				t.Errorf("the truncated record was applied")
+			}
+
+			// Records logged afterwards follow the last complete one
+			if err := r.Set("d", "4"); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.CloseAOF(); err != nil {
+				t.Fatal(err)
+			}
+			reloaded := NewShardedRepository(4)
+			if err := reloaded.OpenAOF(path); err != nil {
+				t.Fatalf("reopening: OpenAOF() error = %v", err)
+			}
+			defer reloaded.CloseAOF()
+			if values, err := reloaded.Get("a"); err != nil || !reflect.DeepEqual(values, []string{"1"}) {
+				t.Errorf("Get(a) = %v, %v, want [1]", values, err)
+			}
+			if s, err := reloaded.GetString("b"); err != nil || s != "2" {
+				t.Errorf("GetString(b) = %q, %v, want 2", s, err)
+			}
+			if values, err := reloaded.Get("d"); err != nil || !reflect.DeepEqual(values, []string{"4"}) {
+				t.Errorf("Get(d) = %v, %v, want [4]", values, err)
+			}
+		})
+	}
+}
+
+func TestReplayAOFCorrupt(t *testing.T) {
+	first := record("SET", "a", "1")
+	after := record("SET", "c", "3")
+	second := fmt.Sprintf("offset %d", len(first))
+	tests := []struct {
+		name    string
+		content string
+		offset  string // reported in the error
+	}{
+		{"bad count", first + "*x\r\n" + after, second},
+		{"negative count", first + "*-1\r\n" + after, second},
+		{"bad argument length", first + "*3\r\n$x\r\nSET\r\n" + after, second},
+		{"negative argument length", first + "*3\r\n$-3\r\nSET\r\n" + after, second},
+		{"argument length over the limit", first + "*1\r\n$999999999999\r\n" + after, second},
+		{"missing dollar", first + "*1\r\n:3\r\n" + after, second},
+		{"bare LF", first + "*3\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n" + after, second},
+		{"argument longer than its length", first + "*3\r\n$2\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n" + after, second},
+		{"argument length running past later records", first + "*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$40\r\n2\r\n" + after, second},
+		{"garbage between records", first + "hello\r\n" + after, second},
+		{"empty record", first + "*0\r\n" + after, second},
+		{"unknown record", first + record("NOPE", "b") + after, second},
+		{"record with missing arguments", first + record("SETSTR", "b") + after, second},
+		{"corrupt first record", "*2\r\n$3\r\nSET\r\n" + "x" + after, "offset 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAOF(t, tt.content)
+			r := NewShardedRepository(4)
+			err := r.OpenAOF(path)
+			if err == nil {
+				r.CloseAOF()
+				t.Fatalf("OpenAOF() succeeded on a corrupt file")
+			}
+			if !strings.Contains(err.Error(), tt.offset) {
+				t.Errorf("OpenAOF() error = %v, want it to mention %s", err, tt.offset)
+			}
+			// Nothing past the damage is loaded, and the file is left as it
+			// was for inspection
+			if r.Exists("c") {
+				t.Errorf("a record following the corruption was applied")
+			}
+			if got := fileSize(t, path); got != int64(len(tt.content)) {
+				t.Errorf("file size = %d, want %d, untouched", got, len(tt.content))
+			}
+		})
+	}
+}
+
+func TestAOFRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := NewShardedRepository(4)
+	if err := r.OpenAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	r.Set("list", "a", "b")
+	r.SetUnique("uniq", "x", "x", "y")
+	r.SetString("str", "v")
+	r.IncrBy("n", 5)
+	r.SAdd("set", "m1", "m2")
+	r.ZAdd("zset", ZAddOptions{}, ScoredMember{Member: "m", Score: 1.5})
+	r.HSet("hash", FieldValue{Field: "f", Value: "v"})
+	r.XAdd("stream", "*", []string{"f", "v"}, false, NoTrim)
+	r.Delete("list")
+	if err := r.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewShardedRepository(4)
+	if err := reloaded.OpenAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.CloseAOF()
+	for _, key := range []string{"uniq", "str", "n", "set", "zset", "hash", "stream"} {
+		want, err := r.Object(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := reloaded.Object(key)
+		if err != nil {
+			t.Fatalf("%s was not replayed: %v", key, err)
+		}
+		if got.Type != want.Type {
+			t.Errorf("%s replayed as a %s, want a %s", key, got.Type, want.Type)
+		}
+	}
+	if reloaded.Exists("list") {
+		t.Errorf("deleted key was replayed")
+	}
+	if s, _ := reloaded.GetString("n"); s != "5" {
+		t.Errorf("GetString(n) = %q, want 5", s)
+	}
+}
+
+func TestBgRewriteAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	r := NewShardedRepository(4)
+	if err := r.OpenAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		r.Push("list", false, false, strconv.Itoa(i))
+	}
+	r.SetString("str", "v")
+	r.Expire("str", time.Hour)
+	if err := r.BgRewriteAOF(); err != nil {
+		t.Fatal(err)
+	}
+	// Written while the rewrite runs, and carried over to the new file
+	r.SetString("after", "v")
+	for r.AOFStatus().RewriteInProgress {
+		time.Sleep(time.Millisecond)
+	}
+	if st := r.AOFStatus(); st.LastRewriteStatus != "ok" {
+		t.Fatalf("rewrite status = %s: %s", st.LastRewriteStatus, st.LastRewriteError)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("rewritten file mode = %v, want 0644", mode)
+	}
+	if err := r.CloseAOF(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewShardedRepository(4)
+	if err := reloaded.OpenAOF(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.CloseAOF()
+	if n, _ := reloaded.LLen("list"); n != 100 {
+		t.Errorf("LLen(list) = %d, want 100", n)
+	}
+	if ttl, _ := reloaded.TTL("str"); ttl <= 0 {
+		t.Errorf("TTL(str) = %v, want the deadline kept", ttl)
+	}
+	if s, _ := reloaded.GetString("after"); s != "v" {
+		t.Errorf("GetString(after) = %q, want v", s)
+	}
+}
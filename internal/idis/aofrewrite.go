@@ -0,0 +1,315 @@
+package idis
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A rewrite replaces the AOF with the shortest log rebuilding the current
+// keyspace, like BGREWRITEAOF. The keyspace is copied as for SAVE, and
+// records start to be kept aside as well as logged while every shard is
+// still locked; the copy is then written to a temporary file in the
+// background, followed by the records kept aside, and the file is renamed
+// over the AOF.
+
+const (
+	// A rewrite starts by itself once the file is autoRewriteMinSize bytes
+	// and has grown by autoRewritePercentage since the last rewrite.
+	autoRewritePercentage = 100
+	autoRewriteMinSize    = 64 << 20
+
+	// rewriteBatch is the most elements written in one record, so that
+	// large collections do not make huge records.
+	rewriteBatch = 64
+
+	// rewriteFinalFlush is how many bytes of kept records may be left for
+	// the final append, which holds up writers.
+	rewriteFinalFlush = 64 << 10
+)
+
+// ErrRewriteInProgress is returned by BgRewriteAOF while a rewrite runs.
+var ErrRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// aofRewrite is the state of AOF rewrites.
+type aofRewrite struct {
+	mu           sync.Mutex
+	inProgress   bool
+	started      time.Time
+	lastStatus   string // "ok" or "err", empty before the first rewrite
+	lastErr      error
+	lastDuration time.Duration
+	count        int
+}
+
+// AOFStatus reports the state of the append-only file.
+type AOFStatus struct {
+	Enabled             bool          `json:"enabled"`
+	FsyncPolicy         string        `json:"fsync_policy"`
+	LastWriteStatus     string        `json:"last_write_status"`
+	CurrentSize         int64         `json:"current_size"`
+	BaseSize            int64         `json:"base_size"`
+	RewriteInProgress   bool          `json:"rewrite_in_progress"`
+	CurrentRewriteTime  time.Duration `json:"current_rewrite_time"`
+	LastRewriteStatus   string        `json:"last_rewrite_status"`
+	LastRewriteError    string        `json:"last_rewrite_error,omitempty"`
+	LastRewriteDuration time.Duration `json:"last_rewrite_duration"`
+	Rewrites            int           `json:"rewrites"`
+}
+
+// AOFStatus returns the state of the append-only file and its rewrites.
+func (r *InMemoryRepository) AOFStatus() AOFStatus {
+	st := AOFStatus{FsyncPolicy: r.FsyncPolicy().String(), LastWriteStatus: "ok"}
+	if a := r.aof.Load(); a != nil {
+		a.mu.Lock()
+		st.Enabled = true
+		st.CurrentSize, st.BaseSize = a.size, a.baseSize
+		if a.failed {
+			st.LastWriteStatus = "err"
+		}
+		a.mu.Unlock()
+	}
+
+	r.rewrite.mu.Lock()
+	defer r.rewrite.mu.Unlock()
+	st.RewriteInProgress = r.rewrite.inProgress
+	if r.rewrite.inProgress {
+		st.CurrentRewriteTime = time.Since(r.rewrite.started)
+	}
+	st.LastRewriteStatus = r.rewrite.lastStatus
+	if r.rewrite.lastErr != nil {
+		st.LastRewriteError = r.rewrite.lastErr.Error()
+	}
+	st.LastRewriteDuration = r.rewrite.lastDuration
+	st.Rewrites = r.rewrite.count
+	return st
+}
+
+// BgRewriteAOF starts rewriting the append-only file in the background and
+// returns once the keyspace has been copied. Writes carry on meanwhile and
+// are carried over to the new file.
+func (r *InMemoryRepository) BgRewriteAOF() error {
+	a := r.aof.Load()
+	if a == nil {
+		return errors.New("append-only file is not enabled")
+	}
+
+	r.rewrite.mu.Lock()
+	if r.rewrite.inProgress {
+		r.rewrite.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+	r.rewrite.inProgress = true
+	r.rewrite.started = time.Now()
+	r.rewrite.mu.Unlock()
+
+	// Keep records aside from the point in time the keyspace is copied at,
+	// so the copy and the records kept together make up the whole history
+	snap := r.snapshot(func() {
+		a.mu.Lock()
+		a.rewriting = true
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+	})
+	go func() {
+		err := r.rewriteAOF(a, snap)
+
+		r.rewrite.mu.Lock()
+		defer r.rewrite.mu.Unlock()
+		r.rewrite.inProgress = false
+		r.rewrite.lastDuration = time.Since(r.rewrite.started)
+		r.rewrite.lastErr = err
+		r.rewrite.count++
+		if err != nil {
+			r.rewrite.lastStatus = "err"
+			fmt.Println("Error rewriting append-only file:", err)
+		} else {
+			r.rewrite.lastStatus = "ok"
+			fmt.Printf("Append-only file rewritten in %v\n", r.rewrite.lastDuration)
+		}
+	}()
+	return nil
+}
+
+// rewriteAOF writes snap to a temporary file, appends the records kept
+// aside since it was taken and renames the file over the AOF.
+func (r *InMemoryRepository) rewriteAOF(a *appendOnlyFile, snap *keyspaceSnapshot) error {
+	released := false
+	release := func() {
+		if !released {
+			r.releaseSnapshot(snap)
+			released = true
+		}
+	}
+	defer release()
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.filename), "temp-rewriteaof-*.aof")
+	if err != nil {
+		a.stopRewrite()
+		return err
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			a.stopRewrite()
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	// CreateTemp makes the file private; give it the mode of a file
+	// created by OpenAOF before it replaces one
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(tmp, 64*1024)
+	var buf []byte
+	emit := func(args ...string) error {
+		buf = appendRecordHeader(buf[:0], len(args))
+		for _, arg := range args {
+			buf = appendRecordArg(buf, arg)
+		}
+		_, err := w.Write(buf)
+		return err
+	}
+	for key, v := range snap.store {
+		if err := rewriteValue(key, v, emit); err != nil {
+			return err
+		}
+		if expiration, ok := snap.expiry[key]; ok {
+			if err := emit("PEXPIREAT", key, strconv.FormatInt(expiration.UnixMilli(), 10)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	release()
+
+	// Catch up with the records kept aside without holding up writers,
+	// until few enough are left
+	for {
+		a.mu.Lock()
+		if a.failed {
+			a.mu.Unlock()
+			return errors.New("append-only file closed during rewrite")
+		}
+		pending := a.rewriteBuf
+		if len(pending) <= rewriteFinalFlush {
+			a.mu.Unlock()
+			break
+		}
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+		if _, err := tmp.Write(pending); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failed {
+		return errors.New("append-only file closed during rewrite")
+	}
+	if _, err := tmp.Write(a.rewriteBuf); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), a.filename); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(a.filename))
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		// The file is in place, so there is no going back; the size is
+		// only used for reporting
+		size = 0
+	}
+	old := a.f
+	a.f = tmp
+	a.size, a.baseSize = size, size
+	a.rewriting = false
+	a.rewriteBuf = nil
+	swapped = true
+	old.Close()
+	return nil
+}
+
+// stopRewrite stops keeping records aside after a failed rewrite.
+func (a *appendOnlyFile) stopRewrite() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewriting = false
+	a.rewriteBuf = nil
+}
+
+// syncDir syncs a directory so that a rename in it survives a crash.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// rewriteValue emits the records creating v at key, in batches of
+// rewriteBatch elements. Streams, whose consumer groups have no command
+// creating them as they are, are restored whole.
+func rewriteValue(key string, v value, emit func(args ...string) error) error {
+	batched := func(cmd string, items []string, per int) error {
+		for len(items) > 0 {
+			n := min(len(items), rewriteBatch*per)
+			args := append([]string{cmd, key}, items[:n]...)
+			if err := emit(args...); err != nil {
+				return err
+			}
+			items = items[n:]
+		}
+		return nil
+	}
+
+	switch v := v.(type) {
+	case *stringValue:
+		return emit("SETSTR", key, v.s)
+	case *listValue:
+		return batched("RPUSH", v.items, 1)
+	case *setValue:
+		return batched("SADD", v.members(), 1)
+	case *hashValue:
+		entries := v.entries()
+		items := make([]string, 0, 2*len(entries))
+		for _, fv := range entries {
+			items = append(items, fv.Field, fv.Value)
+		}
+		return batched("HSET", items, 2)
+	case *zsetValue:
+		items := make([]string, 0, 2*v.zsl.length)
+		for x := v.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+			items = append(items, formatScore(x.score), x.member)
+		}
+		return batched("ZADD", items, 2)
+	default:
+		d, err := encodeValue(v)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return emit("RESTORE", key, string(payload))
+	}
+}
@@ -0,0 +1,285 @@
+package idis
+
+import (
+	"context"
+	"errors"
+)
+
+// listWaiter is a client parked in BlockingPop on one or more keys, or in
+// BlockingMove on its source.
+type listWaiter struct {
+	keys []string
+	left bool
+	// served is set, under blockMu, once the waiter has been handed an
+	// element or has given up. It is then no longer queued on any key.
+	served bool
+	ch     chan poppedElement
+
+	// A BlockingMove waiter is woken rather than handed an element, and
+	// moves it itself with both lists locked. woken is set, under blockMu,
+	// while it has yet to do so.
+	move    bool
+	dst     string
+	dstLeft bool
+	woken   bool
+}
+
+// poppedElement is an element handed to a blocked client.
+type poppedElement struct {
+	key, value string
+}
+
+// dequeueLocked marks w as served and removes it from every key it waits on.
+// The caller must hold blockMu.
+func (r *InMemoryRepository) dequeueLocked(w *listWaiter) {
+	w.served = true
+	for _, key := range w.keys {
+		queue := r.waiters[key]
+		kept := queue[:0]
+		for _, other := range queue {
+			if other != w {
+				kept = append(kept, other)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.waiters, key)
+		} else {
+			r.waiters[key] = kept
+		}
+	}
+	r.blocked.Add(-1)
+}
+
+// serveWaitersLocked hands elements of the list at key to the clients blocked
+// on it, longest waiting first, until either runs out; a BlockingMove waiter
+// is woken to move its element itself. It is called by every write that
+// adds elements to a list; the caller must hold the key's shard write lock,
+// which makes the handoff atomic with the write.
+//
+// Lock ordering: shard lock, then blockMu, then index shard locks.
+func (r *InMemoryRepository) serveWaitersLocked(s *shard, key string) {
+	if r.blocked.Load() == 0 {
+		return
+	}
+	v, ok := r.mutableLocked(s, key)
+	if !ok {
+		return
+	}
+	list, ok := v.(*listValue)
+	if !ok {
+		return
+	}
+
+	r.blockMu.Lock()
+	defer r.blockMu.Unlock()
+	for len(list.items) > 0 && len(r.waiters[key]) > 0 {
+		w := r.waiters[key][0]
+		if w.move {
+			// The waiters queued behind it are served once it has moved
+			// the element, see BlockingMove
+			if !w.woken {
+				w.woken = true
+				w.ch <- poppedElement{key: key}
+			}
+			return
+		}
+		r.dequeueLocked(w)
+		item := r.popLocked(s, key, list, w.left, 1)[0]
+		w.ch <- poppedElement{key: key, value: item}
+	}
+}
+
+// BlockingPop pops an element from the head, or the tail when left is false,
+// of the first non-empty list among keys. When all are empty it waits until
+// another client pushes to one of them, serving blocked clients in the order
+// they arrived, or until ctx is done, in which case ctx.Err() is returned.
+//
+// If ctx is cancelled just as an element is handed over, the element is
+// pushed back where it came from so it is not lost.
+func (r *InMemoryRepository) BlockingPop(ctx context.Context, keys []string, left bool) (string, string, error) {
+	for _, key := range keys {
+		items, err := r.Pop(key, left, 1)
+		if err == nil {
+			return key, items[0], nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return "", "", err
+		}
+	}
+
+	w := &listWaiter{keys: keys, left: left, ch: make(chan poppedElement, 1)}
+	r.blockMu.Lock()
+	for _, key := range keys {
+		r.waiters[key] = append(r.waiters[key], w)
+	}
+	r.blocked.Add(1)
+	r.blockMu.Unlock()
+
+	// Elements pushed between the first attempt and queueing were not handed
+	// to us; serve them now.
+	for _, key := range keys {
+		r.serveWaiters(key)
+	}
+
+	select {
+	case e := <-w.ch:
+		return e.key, e.value, nil
+	case <-ctx.Done():
+	}
+
+	r.blockMu.Lock()
+	served := w.served
+	if !served {
+		r.dequeueLocked(w)
+	}
+	r.blockMu.Unlock()
+	if !served {
+		return "", "", ctx.Err()
+	}
+
+	// An element was handed over as we gave up
+	e := <-w.ch
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// The client is still there and can take it
+		return e.key, e.value, nil
+	}
+	if _, err := r.Push(e.key, left, false, e.value); err != nil {
+		return "", "", err
+	}
+	return "", "", ctx.Err()
+}
+
+// lockPair write-locks the shards of two keys in a fixed order and returns
+// a function unlocking them.
+func (r *InMemoryRepository) lockPair(a, b string) (*shard, *shard, func()) {
+	ia, ib := fnv32(a)%uint32(len(r.shards)), fnv32(b)%uint32(len(r.shards))
+	sa, sb := r.shards[ia], r.shards[ib]
+	switch {
+	case ia == ib:
+		sa.mu.Lock()
+		return sa, sb, sa.mu.Unlock
+	case ia < ib:
+		sa.mu.Lock()
+		sb.mu.Lock()
+	default:
+		sb.mu.Lock()
+		sa.mu.Lock()
+	}
+	return sa, sb, func() {
+		sa.mu.Unlock()
+		sb.mu.Unlock()
+	}
+}
+
+// Move atomically pops an element from one end of the list at src and pushes
+// it to one end of the list at dst, as LMOVE does. It reports false when src
+// does not exist.
+func (r *InMemoryRepository) Move(src, dst string, srcLeft, dstLeft bool) (string, bool, error) {
+	if err := r.freeMemory(); err != nil {
+		return "", false, err
+	}
+
+	ss, ds, unlock := r.lockPair(src, dst)
+	defer unlock()
+	return r.moveLocked(ss, ds, src, dst, srcLeft, dstLeft)
+}
+
+// moveLocked is Move with the shards of src and dst, ss and ds, write-locked.
+func (r *InMemoryRepository) moveLocked(ss, ds *shard, src, dst string, srcLeft, dstLeft bool) (string, bool, error) {
+	srcList, err := r.listForWriteLocked(ss, src, false)
+	if err != nil || srcList == nil {
+		return "", false, err
+	}
+	r.expireIfNeededLocked(ds, dst)
+	if v, ok := ds.store[dst]; ok {
+		if _, err := typed[*listValue](v); err != nil {
+			return "", false, err
+		}
+	}
+
+	item := r.popLocked(ss, src, srcList, srcLeft, 1)[0]
+	dstList, _ := r.listForWriteLocked(ds, dst, true)
+	r.pushLocked(ds, dst, dstList, dstLeft, item)
+	return item, true, nil
+}
+
+// BlockingMove is the blocking form of Move, as BLMOVE. It waits like
+// BlockingPop for src to receive an element, or until ctx is done, in which
+// case ctx.Err() is returned. The element is popped and pushed with both
+// lists locked, so no client sees it in neither list.
+func (r *InMemoryRepository) BlockingMove(ctx context.Context, src, dst string, srcLeft, dstLeft bool) (string, error) {
+	if err := r.freeMemory(); err != nil {
+		return "", err
+	}
+
+	item, ok, err := r.Move(src, dst, srcLeft, dstLeft)
+	if err != nil || ok {
+		return item, err
+	}
+
+	w := &listWaiter{keys: []string{src}, left: srcLeft, ch: make(chan poppedElement, 1), move: true, dst: dst, dstLeft: dstLeft}
+	r.blockMu.Lock()
+	r.waiters[src] = append(r.waiters[src], w)
+	r.blocked.Add(1)
+	r.blockMu.Unlock()
+
+	// Elements pushed between the first attempt and queueing did not wake
+	// us; check for them now.
+	r.serveWaiters(src)
+
+	for {
+		select {
+		case <-w.ch:
+		case <-ctx.Done():
+			r.blockMu.Lock()
+			woken := w.woken
+			r.dequeueLocked(w)
+			r.blockMu.Unlock()
+			if woken {
+				// Let the waiters queued behind us have the element
+				r.serveWaiters(src)
+			}
+			return "", ctx.Err()
+		}
+
+		item, ok, err := r.moveWaiter(w, src, dst, srcLeft, dstLeft)
+		if err != nil || ok {
+			return item, err
+		}
+		// Another client emptied src first; wait for the next push
+	}
+}
+
+// moveWaiter moves an element for w, a woken BlockingMove waiter, and then
+// serves the waiters queued behind it. It reports false, leaving w queued,
+// when src has been emptied since w was woken.
+func (r *InMemoryRepository) moveWaiter(w *listWaiter, src, dst string, srcLeft, dstLeft bool) (string, bool, error) {
+	ss, ds, unlock := r.lockPair(src, dst)
+	defer unlock()
+
+	r.blockMu.Lock()
+	w.woken = false
+	r.blockMu.Unlock()
+	if srcList, err := r.listForWriteLocked(ss, src, false); err == nil && srcList == nil {
+		return "", false, nil
+	}
+
+	// Dequeued first, so the push to dst cannot hand the element back to us
+	// when src and dst are the same list
+	r.blockMu.Lock()
+	r.dequeueLocked(w)
+	r.blockMu.Unlock()
+	item, _, err := r.moveLocked(ss, ds, src, dst, srcLeft, dstLeft)
+	r.serveWaitersLocked(ss, src)
+	return item, err == nil, err
+}
+
+// serveWaiters serves the clients blocked on the list at key, see
+// serveWaitersLocked.
+func (r *InMemoryRepository) serveWaiters(key string) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	r.expireIfNeededLocked(s, key)
+	r.serveWaitersLocked(s, key)
+	s.mu.Unlock()
+}
@@ -0,0 +1,169 @@
+package idis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// waitBlocked waits until n clients are blocked on r.
+func waitBlocked(t *testing.T, r *InMemoryRepository, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for r.blocked.Load() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients blocked, want %d", r.blocked.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// result is what a blocking call returned.
+type result struct {
+	item string
+	err  error
+}
+
+// blockingMove runs BlockingMove from src to dst in the background.
+func blockingMove(r *InMemoryRepository, ctx context.Context, src, dst string) <-chan result {
+	ch := make(chan result, 1)
+	go func() {
+		item, err := r.BlockingMove(ctx, src, dst, true, false)
+		ch <- result{item, err}
+	}()
+	return ch
+}
+
+// blockingPop runs BlockingPop on key in the background.
+func blockingPop(r *InMemoryRepository, ctx context.Context, key string) <-chan result {
+	ch := make(chan result, 1)
+	go func() {
+		_, item, err := r.BlockingPop(ctx, []string{key}, true)
+		ch <- result{item, err}
+	}()
+	return ch
+}
+
+func lrange(t *testing.T, r *InMemoryRepository, key string) []string {
+	t.Helper()
+	items, err := r.LRange(key, 0, -1)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestBlockingMoveServedInOrder(t *testing.T) {
+	r := NewShardedRepository(4)
+	ctx := context.Background()
+	move := blockingMove(r, ctx, "src", "dst")
+	waitBlocked(t, r, 1)
+	pop := blockingPop(r, ctx, "src")
+	waitBlocked(t, r, 2)
+
+	if _, err := r.Push("src", false, false, "x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-move; got.err != nil || got.item != "x" {
+		t.Errorf("BlockingMove() = %q, %v, want x", got.item, got.err)
+	}
+	if got := <-pop; got.err != nil || got.item != "y" {
+		t.Errorf("BlockingPop() = %q, %v, want y", got.item, got.err)
+	}
+	if got := lrange(t, r, "dst"); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("dst = %v, want [x]", got)
+	}
+	if r.Exists("src") {
+		t.Errorf("src still exists")
+	}
+}
+
+func TestBlockingMoveWrongTypeDestination(t *testing.T) {
+	r := NewShardedRepository(4)
+	ctx := context.Background()
+	move := blockingMove(r, ctx, "src", "dst")
+	waitBlocked(t, r, 1)
+	pop := blockingPop(r, ctx, "src")
+	waitBlocked(t, r, 2)
+	if err := r.SetString("dst", "text"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The element stays in src for the next client in line
+	if _, err := r.Push("src", false, false, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-move; !errors.Is(got.err, ErrWrongType) {
+		t.Errorf("BlockingMove() error = %v, want %v", got.err, ErrWrongType)
+	}
+	if got := <-pop; got.err != nil || got.item != "x" {
+		t.Errorf("BlockingPop() = %q, %v, want x", got.item, got.err)
+	}
+	waitBlocked(t, r, 0)
+}
+
+func TestBlockingMoveTimeout(t *testing.T) {
+	r := NewShardedRepository(4)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.BlockingMove(ctx, "src", "dst", true, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("BlockingMove() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	waitBlocked(t, r, 0)
+
+	// Nothing is left waiting for later pushes
+	if _, err := r.Push("src", false, false, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lrange(t, r, "src"); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("src = %v, want [x]", got)
+	}
+}
+
+func TestBlockingMoveAtomic(t *testing.T) {
+	r := NewShardedRepository(4)
+	ctx := context.Background()
+	// inLists returns the number of elements in src and dst, both locked
+	inLists := func() int {
+		ss, ds, unlock := r.lockPair("src", "dst")
+		defer unlock()
+		n := 0
+		for _, v := range []value{ss.store["src"], ds.store["dst"]} {
+			if list, ok := v.(*listValue); ok {
+				n += len(list.items)
+			}
+		}
+		return n
+	}
+
+	for i := 0; i < 20; i++ {
+		move := blockingMove(r, ctx, "src", "dst")
+		waitBlocked(t, r, 1)
+		if _, err := r.Push("src", false, false, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		// The element is in one list or the other while the blocked client
+		// moves it
+		for moved := false; !moved; {
+			select {
+			case got := <-move:
+				if got.err != nil || got.item != strconv.Itoa(i) {
+					t.Fatalf("BlockingMove() = %q, %v, want %d", got.item, got.err, i)
+				}
+				moved = true
+			default:
+			}
+			if n := inLists(); n != i+1 {
+				t.Fatalf("%d of %d elements are in src or dst", n, i+1)
+			}
+			runtime.Gosched()
+		}
+	}
+	if n, _ := r.LLen("dst"); n != 20 {
+		t.Errorf("LLen(dst) = %d, want 20", n)
+	}
+}
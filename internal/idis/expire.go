@@ -0,0 +1,103 @@
+package idis
+
+import "time"
+
+const (
+	// activeExpireSamples is the number of keys with a TTL checked per round
+	activeExpireSamples = 20
+	// activeExpireRepeat keeps sampling while more than this fraction of a round was expired
+	activeExpireRepeat = 0.25
+	// activeExpireBudget bounds the time a single cycle may spend sampling
+	activeExpireBudget = 25 * time.Millisecond
+)
+
+// expiredLocked reports whether key has a deadline at or before now.
+// The caller must hold at least the read lock of the key's shard.
+func (r *InMemoryRepository) expiredLocked(s *shard, key string, now time.Time) bool {
+	if r.loading.Load() {
+		return false
+	}
+	expiration, ok := s.expiry[key]
+	return ok && !now.Before(expiration)
+}
+
+// expireIfNeededLocked deletes key if its deadline has passed and reports
+// whether it did. The caller must hold the write lock of the key's shard.
+func (r *InMemoryRepository) expireIfNeededLocked(s *shard, key string) bool {
+	if !r.expiredLocked(s, key, time.Now()) {
+		return false
+	}
+	r.removeKeyLocked(s, key)
+	r.propagate("DEL", key)
+	r.modified(s, NotifyExpired, "expired", key)
+	return true
+}
+
+// evictIfExpired takes the shard's write lock and deletes key if it is still
+// expired. Read paths call it after releasing their read lock.
+func (r *InMemoryRepository) evictIfExpired(key string) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.expireIfNeededLocked(s, key)
+}
+
+// StartActiveExpire starts a goroutine that removes expired keys in the
+// background, so keys that are never read again do not linger in memory.
+func (r *InMemoryRepository) StartActiveExpire(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			r.activeExpireCycle()
+		}
+	}()
+}
+
+// activeExpireCycle samples keys with a TTL and deletes the expired ones.
+// Like Redis, it keeps sampling a shard while a large share of each round
+// was expired, bounded by activeExpireBudget. When the budget runs out the
+// next cycle resumes from the shard where this one stopped. Only one shard
+// is locked at a time, and only for a single round.
+func (r *InMemoryRepository) activeExpireCycle() int {
+	start := time.Now()
+	removed := 0
+
+	for range r.shards {
+		s := r.shards[r.expireCursor.Add(1)%uint64(len(r.shards))]
+		for {
+			sampled, expired := r.activeExpireRound(s)
+			removed += expired
+			if time.Since(start) > activeExpireBudget {
+				return removed
+			}
+			if sampled == 0 || float64(expired) <= float64(sampled)*activeExpireRepeat {
+				break
+			}
+		}
+	}
+	return removed
+}
+
+// activeExpireRound checks up to activeExpireSamples keys with a TTL in s.
+// Map iteration order is randomised, which gives us the random sample.
+func (r *InMemoryRepository) activeExpireRound(s *shard) (sampled, expired int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, expiration := range s.expiry {
+		if sampled == activeExpireSamples {
+			break
+		}
+		sampled++
+		if !now.Before(expiration) {
+			r.removeKeyLocked(s, key)
+			r.propagate("DEL", key)
+			r.modified(s, NotifyExpired, "expired", key)
+			expired++
+		}
+	}
+	return sampled, expired
+}
@@ -0,0 +1,104 @@
+package idis
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// expiring returns a repository holding n keys with a TTL of ttl and one
+// persistent key.
+func expiring(t *testing.T, n int, ttl time.Duration) *InMemoryRepository {
+	t.Helper()
+	r := NewShardedRepository(4)
+	for i := 0; i < n; i++ {
+		key := "volatile:" + strconv.Itoa(i)
+		if err := r.SetString(key, "value"); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Expire(key, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.SetString("persistent", "value"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLazyExpire(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(r *InMemoryRepository, key string) bool // reports a hit
+	}{
+		{"Exists", func(r *InMemoryRepository, key string) bool {
+			return r.Exists(key)
+		}},
+		{"GetString", func(r *InMemoryRepository, key string) bool {
+			_, err := r.GetString(key)
+			return !errors.Is(err, ErrKeyNotFound)
+		}},
+		{"Type", func(r *InMemoryRepository, key string) bool {
+			typ, _ := r.Type(key)
+			return typ != TypeNone
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := expiring(t, 1, 100*time.Millisecond)
+			if !tt.read(r, "volatile:0") {
+				t.Fatalf("missed the key before its deadline")
+			}
+			time.Sleep(110 * time.Millisecond)
+
+			// Nothing removed the key yet
+			if n := r.MemoryStats().Keys; n != 2 {
+				t.Fatalf("%d keys before reading, want 2", n)
+			}
+			if tt.read(r, "volatile:0") {
+				t.Errorf("hit the key after its deadline")
+			}
+			// Reading it deleted it
+			if n := r.MemoryStats().Keys; n != 1 {
+				t.Errorf("%d keys after reading, want 1", n)
+			}
+			if !tt.read(r, "persistent") {
+				t.Errorf("missed the key without a TTL")
+			}
+		})
+	}
+}
+
+func TestActiveExpire(t *testing.T) {
+	// Enough keys for several rounds in every shard
+	const n = 500
+	r := expiring(t, n, 20*time.Millisecond)
+	r.StartActiveExpire(5 * time.Millisecond)
+
+	// The keys are never read, yet go away
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := r.MemoryStats()
+		if stats.Keys == 1 && stats.Expires == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys and %d deadlines left, want 1 and 0", stats.Keys, stats.Expires)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !r.Exists("persistent") {
+		t.Errorf("the key without a TTL was deleted")
+	}
+}
+
+func TestActiveExpireCycleKeepsLiveKeys(t *testing.T) {
+	r := expiring(t, 100, time.Hour)
+	if removed := r.activeExpireCycle(); removed != 0 {
+		t.Errorf("activeExpireCycle() = %d, want 0", removed)
+	}
+	if n := r.MemoryStats().Keys; n != 101 {
+		t.Errorf("%d keys, want 101", n)
+	}
+}
@@ -0,0 +1,413 @@
+package idis
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// TypeHash is the type name of hashes.
+const TypeHash = "hash"
+
+var (
+	// ErrHashNotInteger is returned by HIncrBy when the field is not an integer.
+	ErrHashNotInteger = errors.New("hash value is not an integer")
+	// ErrHashNotFloat is returned by HIncrByFloat when the field is not a float.
+	ErrHashNotFloat = errors.New("hash value is not a float")
+)
+
+// FieldValue is a single hash field and its value.
+type FieldValue struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// hashValue maps fields to values. Small hashes are kept as a slice of pairs
+// in insertion order, like the Redis listpack encoding, and converted to a
+// hash table once they grow past listpackMaxEntries or hold a long string.
+type hashValue struct {
+	small []FieldValue
+	table map[string]string
+}
+
+func newHashValue() *hashValue {
+	return &hashValue{}
+}
+
+func (h *hashValue) Type() string { return TypeHash }
+
+func (h *hashValue) Encoding() string {
+	if h.table != nil {
+		return "hashtable"
+	}
+	return "listpack"
+}
+
+func (h *hashValue) clone() value {
+	c := &hashValue{small: append([]FieldValue(nil), h.small...)}
+	if h.table != nil {
+		c.table = make(map[string]string, len(h.table))
+		for f, v := range h.table {
+			c.table[f] = v
+		}
+	}
+	return c
+}
+
+func (h *hashValue) len() int {
+	if h.table != nil {
+		return len(h.table)
+	}
+	return len(h.small)
+}
+
+func (h *hashValue) get(field string) (string, bool) {
+	if h.table != nil {
+		v, ok := h.table[field]
+		return v, ok
+	}
+	for _, fv := range h.small {
+		if fv.Field == field {
+			return fv.Value, true
+		}
+	}
+	return "", false
+}
+
+// set stores value in field and reports whether the field is new.
+func (h *hashValue) set(field, value string) bool {
+	if h.table == nil {
+		for i := range h.small {
+			if h.small[i].Field == field {
+				h.small[i].Value = value
+				if len(value) > listpackMaxValue {
+					h.convert()
+				}
+				return false
+			}
+		}
+		if len(h.small) >= listpackMaxEntries || len(field) > listpackMaxValue || len(value) > listpackMaxValue {
+			h.convert()
+		}
+	}
+	if h.table != nil {
+		_, exists := h.table[field]
+		h.table[field] = value
+		return !exists
+	}
+	h.small = append(h.small, FieldValue{Field: field, Value: value})
+	return true
+}
+
+// convert switches a listpack hash to the hashtable encoding.
+func (h *hashValue) convert() {
+	h.table = make(map[string]string, len(h.small)+1)
+	for _, fv := range h.small {
+		h.table[fv.Field] = fv.Value
+	}
+	h.small = nil
+}
+
+// remove deletes field and reports whether it was present.
+func (h *hashValue) remove(field string) bool {
+	if h.table != nil {
+		if _, ok := h.table[field]; !ok {
+			return false
+		}
+		delete(h.table, field)
+		return true
+	}
+	for i, fv := range h.small {
+		if fv.Field == field {
+			h.small = append(h.small[:i], h.small[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// entries returns a copy of all fields and values. Listpack hashes keep
+// insertion order; hashtable ones come back in no particular order.
+func (h *hashValue) entries() []FieldValue {
+	if h.table == nil {
+		return append([]FieldValue(nil), h.small...)
+	}
+	entries := make([]FieldValue, 0, len(h.table))
+	for f, v := range h.table {
+		entries = append(entries, FieldValue{Field: f, Value: v})
+	}
+	return entries
+}
+
+// hashForWriteLocked returns the hash at key, creating it when missing.
+// The caller must hold the shard's write lock.
+func (r *InMemoryRepository) hashForWriteLocked(s *shard, key string) (*hashValue, error) {
+	r.expireIfNeededLocked(s, key)
+	if v, ok := r.mutableLocked(s, key); ok {
+		return typed[*hashValue](v)
+	}
+	h := newHashValue()
+	s.store[key] = h
+	return h, nil
+}
+
+// viewHash calls fn with the hash stored at key under the shard's read lock.
+func (r *InMemoryRepository) viewHash(key string, fn func(h *hashValue)) error {
+	return r.view(key, func(v value) error {
+		h, err := typed[*hashValue](v)
+		if err != nil {
+			return err
+		}
+		fn(h)
+		return nil
+	})
+}
+
+// HSet sets fields in the hash at key and returns how many were new.
+func (r *InMemoryRepository) HSet(key string, fields ...FieldValue) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := r.hashForWriteLocked(s, key)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, fv := range fields {
+		if h.set(fv.Field, fv.Value) {
+			added++
+		}
+	}
+	if h.len() == 0 {
+		r.removeKeyLocked(s, key)
+		return added, nil
+	}
+	if r.propagating() {
+		args := make([]string, 0, 2*len(fields))
+		for _, fv := range fields {
+			args = append(args, fv.Field, fv.Value)
+		}
+		r.propagateValues(args, "HSET", key)
+	}
+	r.modified(s, NotifyHash, "hset", key)
+	return added, nil
+}
+
+// HGet returns the value of field in the hash at key.
+func (r *InMemoryRepository) HGet(key, field string) (string, bool, error) {
+	var val string
+	var found bool
+	err := r.viewHash(key, func(h *hashValue) {
+		val, found = h.get(field)
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", false, nil
+	}
+	return val, found, err
+}
+
+// HDel removes fields from the hash at key and returns how many were removed.
+// The key is deleted once the hash is empty.
+func (r *InMemoryRepository) HDel(key string, fields ...string) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	v, ok := r.mutableLocked(s, key)
+	if !ok {
+		return 0, nil
+	}
+	h, err := typed[*hashValue](v)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, f := range fields {
+		if h.remove(f) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		r.propagateValues(fields, "HDEL", key)
+		r.modified(s, NotifyHash, "hdel", key)
+	}
+	if h.len() == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return removed, nil
+}
+
+// HGetAll returns every field and value of the hash at key.
+func (r *InMemoryRepository) HGetAll(key string) ([]FieldValue, error) {
+	var entries []FieldValue
+	err := r.viewHash(key, func(h *hashValue) {
+		entries = h.entries()
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return []FieldValue{}, nil
+	}
+	return entries, err
+}
+
+// HExists reports whether field exists in the hash at key.
+func (r *InMemoryRepository) HExists(key, field string) (bool, error) {
+	_, found, err := r.HGet(key, field)
+	return found, err
+}
+
+// HLen returns the number of fields in the hash at key.
+func (r *InMemoryRepository) HLen(key string) (int, error) {
+	var n int
+	err := r.viewHash(key, func(h *hashValue) {
+		n = h.len()
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// HIncrBy adds delta to the integer in field, creating it as 0 first if missing.
+func (r *InMemoryRepository) HIncrBy(key, field string, delta int64) (int64, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := r.hashForWriteLocked(s, key)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	if v, ok := h.get(field); ok {
+		current, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, ErrHashNotInteger
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		if h.len() == 0 {
+			r.removeKeyLocked(s, key)
+		}
+		return 0, errors.New("increment or decrement would overflow")
+	}
+	current += delta
+	h.set(field, strconv.FormatInt(current, 10))
+	r.propagate("HSET", key, field, strconv.FormatInt(current, 10))
+	r.modified(s, NotifyHash, "hincrby", key)
+	return current, nil
+}
+
+// HIncrByFloat adds delta to the float in field, creating it as 0 first if
+// missing, and returns the stored representation of the result.
+func (r *InMemoryRepository) HIncrByFloat(key, field string, delta float64) (string, error) {
+	if err := r.freeMemory(); err != nil {
+		return "", err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, err := r.hashForWriteLocked(s, key)
+	if err != nil {
+		return "", err
+	}
+	var current float64
+	if v, ok := h.get(field); ok {
+		current, err = strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(current) {
+			return "", ErrHashNotFloat
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		if h.len() == 0 {
+			r.removeKeyLocked(s, key)
+		}
+		return "", errors.New("increment would produce NaN or Infinity")
+	}
+	str := strconv.FormatFloat(current, 'f', -1, 64)
+	h.set(field, str)
+	r.propagate("HSET", key, field, str)
+	r.modified(s, NotifyHash, "hincrbyfloat", key)
+	return str, nil
+}
+
+// HScan iterates the hash at key. Pass cursor 0 to start; the returned cursor
+// is 0 once the iteration is complete. Only fields matching the glob pattern
+// match are returned; an empty pattern matches everything. count is a hint
+// for how many fields to examine per call.
+//
+// Fields are visited in order of their hash, and the cursor records the next
+// hash to visit, so fields present for the whole iteration are returned at
+// least once even when the hash is modified between calls.
+func (r *InMemoryRepository) HScan(key string, cursor uint64, match string, count int) (uint64, []FieldValue, error) {
+	if count <= 0 {
+		count = 10
+	}
+	var next uint64
+	var entries []FieldValue
+	err := r.viewHash(key, func(h *hashValue) {
+		all := h.entries()
+		if h.table == nil {
+			// Like Redis, small hashes are returned in a single call
+			entries = all
+			return
+		}
+
+		sort.Slice(all, func(i, j int) bool {
+			hi, hj := fnv32(all[i].Field), fnv32(all[j].Field)
+			if hi != hj {
+				return hi < hj
+			}
+			return all[i].Field < all[j].Field
+		})
+		i := sort.Search(len(all), func(i int) bool {
+			return uint64(fnv32(all[i].Field)) >= cursor
+		})
+		end := i + count
+		if end >= len(all) {
+			entries = all[i:]
+			return
+		}
+		// Never split fields sharing a hash across calls
+		last := fnv32(all[end-1].Field)
+		for end < len(all) && fnv32(all[end].Field) == last {
+			end++
+		}
+		entries = all[i:end]
+		if end < len(all) {
+			next = uint64(last) + 1
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, []FieldValue{}, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if match != "" {
+		filtered := entries[:0:0]
+		for _, fv := range entries {
+			if MatchPattern(match, fv.Field) {
+				filtered = append(filtered, fv)
+			}
+		}
+		entries = filtered
+	}
+	return next, entries, nil
+}
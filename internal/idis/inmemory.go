@@ -4,126 +4,204 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// InMemoryRepository keeps the keyspace in independently locked shards so
+// operations on different keys do not contend on a single mutex. The reverse
+// lookup from values to keys is sharded the same way, by value.
 type InMemoryRepository struct {
-	store         map[string][]string
-	mu            sync.RWMutex
-	expiry        map[string]time.Time
-	reverseLookup map[string][]string // Map value to a slice of keys
+	shards       []*shard
+	index        []*indexShard
+	expireCursor atomic.Uint64 // next shard visited by the active expire cycle
+
+	// Clients blocked in BlockingPop, XRead or XReadGroup, by key. See
+	// blocking.go and stream.go.
+	blockMu       sync.Mutex
+	waiters       map[string][]*listWaiter
+	streamWaiters map[string][]chan struct{}
+	blocked       atomic.Int64
+
+	// Keyspace notifications, see notify.go
+	publish     Publisher
+	notifyFlags atomic.Int64
+
+	// clock issues key versions, see version.go
+	clock atomic.Uint64
+
+	// Append-only file, see aof.go and aofrewrite.go. Keys do not expire
+	// while loading.
+	aof     atomic.Pointer[appendOnlyFile]
+	fsync   atomic.Int32
+	loading atomic.Bool
+	rewrite aofRewrite
+
+	// Snapshot settings, see snapshot.go
+	snapshotFormat      atomic.Int32
+	snapshotCompression atomic.Bool
+	saves               saveState
+
+	// Memory accounting and eviction, see memory.go
+	memory memoryState
 }
 
 // NewInMemoryRepository creates a new instance of InMemoryRepository
 func NewInMemoryRepository() *InMemoryRepository {
-	return &InMemoryRepository{
-		store:         make(map[string][]string),
-		expiry:        make(map[string]time.Time),
-		reverseLookup: make(map[string][]string),
+	return NewShardedRepository(DefaultShards)
+}
+
+// NewShardedRepository creates an InMemoryRepository split into n shards
+func NewShardedRepository(n int) *InMemoryRepository {
+	if n < 1 {
+		n = 1
+	}
+	r := &InMemoryRepository{
+		shards:        make([]*shard, n),
+		index:         make([]*indexShard, n),
+		waiters:       make(map[string][]*listWaiter),
+		streamWaiters: make(map[string][]chan struct{}),
+	}
+	r.saves.filename = "dump.json"
+	r.memory.samples.Store(DefaultMaxMemorySamples)
+	for i := range r.shards {
+		r.shards[i] = newShard()
+		r.index[i] = newIndexShard()
 	}
+	return r
 }
 
 // Set adds one or more values to a key (appends values to the key's slice)
 func (r *InMemoryRepository) Set(key string, values ...string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.freeMemory(); err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// An expired key is replaced rather than appended to
+	r.expireIfNeededLocked(s, key)
 
 	// If the key already exists, append the new values
-	if existingValues, ok := r.store[key]; ok {
-		r.store[key] = append(existingValues, values...)
+	if existing, ok := r.mutableLocked(s, key); ok {
+		list, err := typed[*listValue](existing)
+		if err != nil {
+			return err
+		}
+		list.items = append(list.items, values...)
 	} else {
-		// If the key doesn't exist, create a new slice with the values
-		r.store[key] = values
+		// If the key doesn't exist, create a new list with the values
+		s.store[key] = &listValue{items: append([]string(nil), values...)}
 	}
 
 	// Update reverse lookup map
 	for _, value := range values {
-		r.reverseLookup[value] = append(r.reverseLookup[value], key)
+		r.link(value, key)
 	}
 
+	r.propagateValues(values, "SET", key)
+	r.modified(s, NotifyList, "set", key)
+
+	// Hand the new values to clients blocked on the key
+	r.serveWaitersLocked(s, key)
 	return nil
 }
 
 // Get retrieves all values associated with a key
 func (r *InMemoryRepository) Get(key string) ([]string, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	return r.listItems(key)
+}
 
-	values, ok := r.store[key]
-	if !ok {
-		return nil, errors.New("key not found")
-	}
-	return values, nil
+// listItems returns a copy of the elements of the list stored at key.
+func (r *InMemoryRepository) listItems(key string) ([]string, error) {
+	var values []string
+	err := r.view(key, func(v value) error {
+		list, err := typed[*listValue](v)
+		if err != nil {
+			return err
+		}
+		values = append([]string(nil), list.items...)
+		return nil
+	})
+	return values, err
 }
 
 // Delete removes a key and its associated values from the store
 func (r *InMemoryRepository) Delete(key string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if existingValues, ok := r.store[key]; ok {
-		for _, value := range existingValues {
-			// Remove the key from the list of keys for each value
-			keys := r.reverseLookup[value]
-			for i, k := range keys {
-				if k == key {
-					r.reverseLookup[value] = append(keys[:i], keys[i+1:]...)
-					break
-				}
-			}
-			if len(r.reverseLookup[value]) == 0 {
-				delete(r.reverseLookup, value)
-			}
-		}
-		delete(r.store, key)
-		delete(r.expiry, key)
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	if _, ok := s.store[key]; ok {
+		r.removeKeyLocked(s, key)
+		r.propagate("DEL", key)
+		r.modified(s, NotifyGeneric, "del", key)
 		return nil
 	}
 
-	return errors.New("key not found")
+	return ErrKeyNotFound
+}
+
+// removeKeyLocked deletes key, its expiry and its reverse lookup entries.
+// The caller must hold the write lock of the key's shard.
+func (r *InMemoryRepository) removeKeyLocked(s *shard, key string) {
+	for _, value := range indexedValues(s.store[key]) {
+		// Remove the key from the list of keys for each value
+		r.unlink(value, key)
+	}
+	delete(s.store, key)
+	delete(s.expiry, key)
 }
 
 // Exists checks if a key exists in the store
 func (r *InMemoryRepository) Exists(key string) bool {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	if expiration, ok := r.expiry[key]; ok && time.Now().After(expiration) {
-		return false // Key has expired
-	}
-	_, exists := r.store[key]
-	return exists
+	err := r.view(key, func(value) error { return nil })
+	return err == nil
 }
 
 // Expire sets the expiration time for a key
 func (r *InMemoryRepository) Expire(key string, ttl time.Duration) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return r.expireAt(key, time.Now().Add(ttl))
+}
+
+// expireAt sets the deadline of a key.
+func (r *InMemoryRepository) expireAt(key string, expiration time.Time) error {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, ok := r.store[key]; !ok {
-		return errors.New("key not found")
+	r.expireIfNeededLocked(s, key)
+	if _, ok := s.store[key]; !ok {
+		return ErrKeyNotFound
 	}
-	r.expiry[key] = time.Now().Add(ttl)
+	s.expiry[key] = expiration
+	r.propagate("PEXPIREAT", key, strconv.FormatInt(expiration.UnixMilli(), 10))
+	r.modified(s, NotifyGeneric, "expire", key)
 	return nil
 }
 
 // TTL returns the remaining time-to-live for a key
 func (r *InMemoryRepository) TTL(key string) (time.Duration, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.shardFor(key)
+	s.mu.RLock()
+	expiration, ok := s.expiry[key]
+	s.mu.RUnlock()
 
-	expiration, ok := r.expiry[key]
 	if !ok {
 		return -1, errors.New("no TTL set or key not found")
 	}
 
 	if time.Now().After(expiration) {
-		delete(r.store, key)
-		delete(r.expiry, key)
+		r.evictIfExpired(key)
 		return -1, errors.New("key has expired")
 	}
 
@@ -132,12 +210,9 @@ func (r *InMemoryRepository) TTL(key string) (time.Duration, error) {
 
 // RandomValues returns a specific number of random values from the key's associated list
 func (r *InMemoryRepository) RandomValues(key string, count int) ([]string, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	values, ok := r.store[key]
-	if !ok {
-		return nil, errors.New("key not found")
+	values, err := r.listItems(key)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if the requested count is valid
@@ -145,12 +220,8 @@ func (r *InMemoryRepository) RandomValues(key string, count int) ([]string, erro
 		return nil, errors.New("invalid count value")
 	}
 
-	// Seed the random number generator for randomness
-	rand.Seed(time.Now().UnixNano())
-
-	// Shuffle the values slice
-	shuffledValues := make([]string, len(values))
-	copy(shuffledValues, values)
+	// Shuffle the values slice; listItems already returned a private copy
+	shuffledValues := values
 	rand.Shuffle(len(shuffledValues), func(i, j int) {
 		shuffledValues[i], shuffledValues[j] = shuffledValues[j], shuffledValues[i]
 	})
@@ -161,17 +232,30 @@ func (r *InMemoryRepository) RandomValues(key string, count int) ([]string, erro
 
 // SetUnique adds unique values to a key, ensuring no duplicates
 func (r *InMemoryRepository) SetUnique(key string, values ...string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.freeMemory(); err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
 
 	// Use a map to track unique values
 	uniqueValues := make(map[string]bool)
 
 	// Load existing values into the map if the key already exists
-	if existingValues, ok := r.store[key]; ok {
-		for _, value := range existingValues {
-			uniqueValues[value] = true
+	var existingValues []string
+	if existing, ok := s.store[key]; ok {
+		list, err := typed[*listValue](existing)
+		if err != nil {
+			return err
 		}
+		existingValues = list.items
+	}
+	for _, value := range existingValues {
+		uniqueValues[value] = true
 	}
 
 	// Add new values to the map
@@ -185,62 +269,49 @@ func (r *InMemoryRepository) SetUnique(key string, values ...string) error {
 		uniqueSlice = append(uniqueSlice, value)
 	}
 
-	// Remove old values from reverse lookup map
-	if existingValues, ok := r.store[key]; ok {
-		for _, value := range existingValues {
-			if _, exists := uniqueValues[value]; !exists {
-				// Remove the key from the list of keys for the value
-				keys := r.reverseLookup[value]
-				for i, k := range keys {
-					if k == key {
-						r.reverseLookup[value] = append(keys[:i], keys[i+1:]...)
-						break
-					}
-				}
-				if len(r.reverseLookup[value]) == 0 {
-					delete(r.reverseLookup, value)
-				}
-			}
-		}
+	// Replace the old values in the reverse lookup with the unique ones
+	for _, value := range existingValues {
+		r.unlink(value, key)
 	}
-
-	// Store updated unique values
-	r.store[key] = uniqueSlice
-
-	// Update reverse lookup map
 	for _, value := range uniqueSlice {
-		r.reverseLookup[value] = append(r.reverseLookup[value], key)
+		r.link(value, key)
 	}
 
+	// Store updated unique values
+	s.store[key] = &listValue{items: uniqueSlice}
+	r.propagateRestore(s, key)
+	r.modified(s, NotifyList, "setuq", key)
+
+	r.serveWaitersLocked(s, key)
 	return nil
 }
 
 // RemoveValue removes a specific value from a key
 func (r *InMemoryRepository) RemoveValue(key string, value string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	values, ok := r.store[key]
+	r.expireIfNeededLocked(s, key)
+
+	existing, ok := r.mutableLocked(s, key)
 	if !ok {
-		return errors.New("key not found")
+		return ErrKeyNotFound
+	}
+	list, err := typed[*listValue](existing)
+	if err != nil {
+		return err
 	}
 
-	for i, v := range values {
+	for i, v := range list.items {
 		if v == value {
 			// Remove the value from reverse lookup map
-			keys := r.reverseLookup[value]
-			for j, k := range keys {
-				if k == key {
-					r.reverseLookup[value] = append(keys[:j], keys[j+1:]...)
-					break
-				}
-			}
-			if len(r.reverseLookup[value]) == 0 {
-				delete(r.reverseLookup, value)
-			}
+			r.unlink(value, key)
 
 			// Remove from key's values
-			r.store[key] = append(values[:i], values[i+1:]...)
+			list.items = append(list.items[:i], list.items[i+1:]...)
+			r.propagate("REMOVE", key, value)
+			r.modified(s, NotifyList, "remove", key)
 			return nil
 		}
 	}
@@ -250,12 +321,9 @@ func (r *InMemoryRepository) RemoveValue(key string, value string) error {
 
 // GetUnique retrieves all unique values associated with a key
 func (r *InMemoryRepository) GetUnique(key string) ([]string, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	values, ok := r.store[key]
-	if !ok {
-		return nil, errors.New("key not found")
+	values, err := r.listItems(key)
+	if err != nil {
+		return nil, err
 	}
 
 	// Use a map to track unique values
@@ -274,31 +342,97 @@ func (r *InMemoryRepository) GetUnique(key string) ([]string, error) {
 
 // GetKeyFromValue retrieves all keys associated with a specific value
 func (r *InMemoryRepository) GetKeyFromValue(value string) ([]string, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	ix := r.indexFor(value)
+	ix.mu.RLock()
+	candidates := append([]string(nil), ix.keys[value]...)
+	ix.mu.RUnlock()
+
+	// Skip keys that have expired but were not evicted yet
+	now := time.Now()
+	var keys []string
+	for _, key := range candidates {
+		s := r.shardFor(key)
+		s.mu.RLock()
+		expired := r.expiredLocked(s, key, now)
+		s.mu.RUnlock()
+
+		if expired {
+			r.evictIfExpired(key)
+		} else {
+			keys = append(keys, key)
+		}
+	}
 
-	keys, ok := r.reverseLookup[value]
-	if !ok {
+	if len(keys) == 0 {
 		return nil, errors.New("value not found")
 	}
 
 	return keys, nil
 }
 
-// DumpToFile serializes the in-memory store and writes it to a file.
+// dumpFile is the JSON layout written by DumpToFile. Version 1 dumps only
+// had Store, holding every key as a list; version 2 keeps the type of each
+// key in Values.
+type dumpFile struct {
+	Version       int                  `json:",omitempty"`
+	Store         map[string][]string  `json:",omitempty"`
+	Values        map[string]dumpValue `json:",omitempty"`
+	Expiry        map[string]time.Time
+	ReverseLookup map[string][]string
+}
+
+// dumpVersion is the version written by DumpToFile.
+const dumpVersion = 2
+
+// DumpToFile serializes the in-memory store and writes it to a file, in the
+// format chosen by its extension or SetSnapshotFormat. It fails while
+// another snapshot is being written; see save.go.
 func (r *InMemoryRepository) DumpToFile(filename string) error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	if err := r.beginSave(false); err != nil {
+		return err
+	}
+	err := r.writeSnapshot(filename)
+	r.endSave(err)
+	return err
+}
+
+// writeSnapshot copies the store and writes it to filename. Writers are
+// only blocked while the keys are copied, never while the snapshot is
+// encoded and written. The file is replaced only once the snapshot is
+// complete and synced to disk.
+func (r *InMemoryRepository) writeSnapshot(filename string) error {
+	snap := r.snapshot(nil)
+	defer r.releaseSnapshot(snap)
+	r.saves.mu.Lock()
+	r.saves.keysTotal = len(snap.store)
+	r.saves.mu.Unlock()
+
+	format, compress := r.snapshotFormatFor(filename), r.SnapshotCompression()
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		if format == SnapshotBinary {
+			return writeBinarySnapshot(w, snap.store, snap.expiry, compress, &r.saves.keysDone)
+		}
+		return writeJSONSnapshot(w, snap.store, snap.expiry, &r.saves.keysDone)
+	})
+}
 
+// writeJSONSnapshot writes store and expiry to w as a JSON dump, counting
+// the keys encoded in progress.
+func writeJSONSnapshot(w io.Writer, store map[string]value, expiry map[string]time.Time, progress *atomic.Int64) error {
 	// Create a map that holds both store and expiry for dump
-	data := struct {
-		Store         map[string][]string
-		Expiry        map[string]time.Time
-		ReverseLookup map[string][]string
-	}{
-		Store:         r.store,
-		Expiry:        r.expiry,
-		ReverseLookup: r.reverseLookup,
+	data := dumpFile{
+		Version:       dumpVersion,
+		Values:        make(map[string]dumpValue, len(store)),
+		Expiry:        expiry,
+		ReverseLookup: buildReverseLookup(store),
+	}
+	for key, v := range store {
+		encoded, err := encodeValue(v)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		data.Values[key] = encoded
+		progress.Add(1)
 	}
 
 	// Serialize the data to JSON
@@ -308,14 +442,102 @@ func (r *InMemoryRepository) DumpToFile(filename string) error {
 	}
 
 	// Write the JSON data to the dump file
-	return ioutil.WriteFile(filename, bytes, 0644)
+	_, err = w.Write(bytes)
+	return err
 }
 
-// LoadFromDump reads the dump file and restores the in-memory store.
-func (r *InMemoryRepository) LoadFromDump(filename string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// keyspaceSnapshot is a copy of the live keys and their deadlines at a
+// point in time, taken by snapshot. Its values are shared with the shards
+// until it is released.
+type keyspaceSnapshot struct {
+	store  map[string]value
+	expiry map[string]time.Time
+}
+
+// snapshot copies the live keys and their deadlines while every shard is
+// locked, so the copy is consistent even with commands spanning shards,
+// such as LMOVE or EXEC. Only the maps are copied, which keeps writers
+// waiting briefly: a value held by the snapshot is cloned by the writer
+// modifying it until releaseSnapshot is called, see mutableLocked. locked,
+// if not nil, is called before the shards are unlocked.
+func (r *InMemoryRepository) snapshot(locked func()) *keyspaceSnapshot {
+	r.lockAll()
+	defer r.unlockAll()
+
+	n := 0
+	for _, s := range r.shards {
+		n += len(s.store)
+	}
+	snap := &keyspaceSnapshot{
+		store:  make(map[string]value, n),
+		expiry: make(map[string]time.Time),
+	}
+	now := time.Now()
+	for _, s := range r.shards {
+		for key, v := range s.store {
+			if r.expiredLocked(s, key, now) {
+				continue
+			}
+			snap.store[key] = v
+			if expiration, ok := s.expiry[key]; ok {
+				snap.expiry[key] = expiration
+			}
+		}
+		s.snapshots = append(s.snapshots, snap)
+	}
+	if locked != nil {
+		locked()
+	}
+	return snap
+}
+
+// releaseSnapshot lets writers modify the values of snap in place again,
+// once it has been written out.
+func (r *InMemoryRepository) releaseSnapshot(snap *keyspaceSnapshot) {
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for i, other := range s.snapshots {
+			if other == snap {
+				s.snapshots = append(s.snapshots[:i], s.snapshots[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// mutableLocked returns the value stored at key for modifying in place.
+// A value still held by a snapshot being written is replaced by a clone
+// first. The caller must hold the write lock of the key's shard.
+func (r *InMemoryRepository) mutableLocked(s *shard, key string) (value, bool) {
+	v, ok := s.store[key]
+	if !ok {
+		return nil, false
+	}
+	for _, snap := range s.snapshots {
+		if snap.store[key] == v {
+			v = v.clone()
+			s.store[key] = v
+			break
+		}
+	}
+	return v, true
+}
+
+// buildReverseLookup maps every indexed value in store to the keys holding it.
+func buildReverseLookup(store map[string]value) map[string][]string {
+	reverseLookup := make(map[string][]string)
+	for key, v := range store {
+		for _, value := range indexedValues(v) {
+			reverseLookup[value] = append(reverseLookup[value], key)
+		}
+	}
+	return reverseLookup
+}
 
+// LoadFromDump reads the dump file and restores the in-memory store. Binary
+// snapshots are told from JSON dumps by their header.
+func (r *InMemoryRepository) LoadFromDump(filename string) error {
 	// Check if the dump file exists
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return fmt.Errorf("dump file does not exist")
@@ -327,27 +549,64 @@ func (r *InMemoryRepository) LoadFromDump(filename string) error {
 		return err
 	}
 
-	// Create a temporary struct to load the dump data
-	data := struct {
-		Store         map[string][]string
-		Expiry        map[string]time.Time
-		ReverseLookup map[string][]string
-	}{}
-
-	// Unmarshal the JSON data from the file
-	err = json.Unmarshal(bytes, &data)
+	// Decode every key before touching the live store
+	var store map[string]value
+	var expiry map[string]time.Time
+	if isBinarySnapshot(bytes) {
+		store, expiry, err = readBinarySnapshot(bytes)
+	} else {
+		store, expiry, err = readJSONSnapshot(bytes)
+	}
 	if err != nil {
 		return err
 	}
 
-	// Restore the in-memory store and expiry
-	r.store = data.Store
-	r.expiry = data.Expiry
-	r.reverseLookup = data.ReverseLookup
+	// Restore the in-memory store and expiry. The reverse lookup is rebuilt
+	// from the store so it always matches the sharding of this instance.
+	r.lockAll()
+	defer r.unlockAll()
+
+	r.resetLocked()
+	r.propagate("FLUSHALL")
+	now := time.Now()
+	for key, v := range store {
+		s := r.shardFor(key)
+		s.store[key] = v
+		if expiration, ok := expiry[key]; ok {
+			s.expiry[key] = expiration
+		}
+		for _, value := range indexedValues(v) {
+			ix := r.indexFor(value)
+			ix.keys[value] = append(ix.keys[value], key)
+		}
+		r.account(s, key, now)
+		r.propagateRestore(s, key)
+	}
 
 	return nil
 }
 
+// readJSONSnapshot decodes a JSON dump.
+func readJSONSnapshot(bytes []byte) (map[string]value, map[string]time.Time, error) {
+	var data dumpFile
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return nil, nil, err
+	}
+
+	store := make(map[string]value, len(data.Store)+len(data.Values))
+	for key, values := range data.Store {
+		store[key] = &listValue{items: values}
+	}
+	for key, encoded := range data.Values {
+		v, err := decodeValue(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		store[key] = v
+	}
+	return store, data.Expiry, nil
+}
+
 // StartAutoDump starts a goroutine to periodically dump the in-memory store to a file every 2 hours.
 func (r *InMemoryRepository) StartAutoDump(filepath string, interval time.Duration) {
 	go func() {
@@ -365,14 +624,34 @@ func (r *InMemoryRepository) StartAutoDump(filepath string, interval time.Durati
 	}()
 }
 
-// flush removes all keys and values from the store
+// DeleteAll removes all keys and values from the store
 func (r *InMemoryRepository) DeleteAll() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.store = make(map[string][]string)
-	r.expiry = make(map[string]time.Time)
-	r.reverseLookup = make(map[string][]string)
+	r.lockAll()
+	defer r.unlockAll()
 
+	if r.notifying(NotifyGeneric) {
+		for _, s := range r.shards {
+			for key := range s.store {
+				r.notify(NotifyGeneric, "del", key)
+			}
+		}
+	}
+	r.resetLocked()
+	r.propagate("FLUSHALL")
 	return nil
 }
+
+// resetLocked empties every shard. The caller must hold lockAll.
+func (r *InMemoryRepository) resetLocked() {
+	for _, s := range r.shards {
+		s.store = make(map[string]value)
+		s.expiry = make(map[string]time.Time)
+		s.meta = make(map[string]*keyMeta)
+		s.versions = make(map[string]uint64)
+		s.epoch = r.clock.Add(1)
+	}
+	r.memory.used.Store(0)
+	for _, ix := range r.index {
+		ix.keys = make(map[string][]string)
+	}
+}
@@ -0,0 +1,411 @@
+package idis
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	// listpackMaxEntries and listpackMaxValue mirror the Redis thresholds for
+	// reporting small collections as compactly encoded.
+	listpackMaxEntries = 128
+	listpackMaxValue   = 64
+)
+
+// listValue is an ordered sequence of strings. It is the type created by SET.
+type listValue struct {
+	items []string
+}
+
+func (l *listValue) Type() string { return TypeList }
+
+func (l *listValue) Encoding() string {
+	if len(l.items) > listpackMaxEntries {
+		return "quicklist"
+	}
+	for _, item := range l.items {
+		if len(item) > listpackMaxValue {
+			return "quicklist"
+		}
+	}
+	return "listpack"
+}
+
+func (l *listValue) clone() value {
+	return &listValue{items: append([]string(nil), l.items...)}
+}
+
+// ErrIndexOutOfRange is returned by LSet for an index outside the list.
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// listForWriteLocked returns the list at key, creating it when create is set.
+// It returns nil when the key is missing and create is not set. The caller
+// must hold the shard's write lock.
+func (r *InMemoryRepository) listForWriteLocked(s *shard, key string, create bool) (*listValue, error) {
+	r.expireIfNeededLocked(s, key)
+	if v, ok := r.mutableLocked(s, key); ok {
+		return typed[*listValue](v)
+	}
+	if !create {
+		return nil, nil
+	}
+	list := &listValue{}
+	s.store[key] = list
+	return list, nil
+}
+
+// viewList calls fn with the list stored at key under the shard's read lock.
+func (r *InMemoryRepository) viewList(key string, fn func(l *listValue)) error {
+	return r.view(key, func(v value) error {
+		list, err := typed[*listValue](v)
+		if err != nil {
+			return err
+		}
+		fn(list)
+		return nil
+	})
+}
+
+// listIndex converts a possibly negative index into an offset from the head.
+func listIndex(index, n int) int {
+	if index < 0 {
+		index += n
+	}
+	return index
+}
+
+// listRange clamps start and stop, which may be negative, to the bounds of a
+// list of length n. It returns an empty range when nothing is selected.
+func listRange(start, stop, n int) (int, int) {
+	start, stop = listIndex(start, n), listIndex(stop, n)
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// Push inserts values at the head, or the tail when left is false, of the
+// list at key and returns the new length. Like LPUSH, values pushed to the
+// head end up in reverse order. When onlyExisting is set nothing is created
+// and 0 is returned for a missing key, as LPUSHX does.
+func (r *InMemoryRepository) Push(key string, left, onlyExisting bool, values ...string) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, !onlyExisting)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return r.pushLocked(s, key, list, left, values...), nil
+}
+
+// pushLocked adds values to one end of list, hands them to any clients
+// blocked on key and returns the length reached before doing so, which is
+// what LPUSH reports. The caller must hold the shard's write lock.
+func (r *InMemoryRepository) pushLocked(s *shard, key string, list *listValue, left bool, values ...string) int {
+	if left {
+		head := make([]string, 0, len(values)+len(list.items))
+		for i := len(values) - 1; i >= 0; i-- {
+			head = append(head, values[i])
+		}
+		list.items = append(head, list.items...)
+	} else {
+		list.items = append(list.items, values...)
+	}
+	for _, v := range values {
+		r.link(v, key)
+	}
+	n := len(list.items)
+	if left {
+		r.propagateValues(values, "LPUSH", key)
+		r.modified(s, NotifyList, "lpush", key)
+	} else {
+		r.propagateValues(values, "RPUSH", key)
+		r.modified(s, NotifyList, "rpush", key)
+	}
+	r.serveWaitersLocked(s, key)
+	return n
+}
+
+// Pop removes and returns up to count elements from the head, or the tail
+// when left is false, of the list at key. The key is deleted once empty.
+func (r *InMemoryRepository) Pop(key string, left bool, count int) ([]string, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, false)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, ErrKeyNotFound
+	}
+	return r.popLocked(s, key, list, left, count), nil
+}
+
+// popLocked removes up to count elements from one end of list.
+func (r *InMemoryRepository) popLocked(s *shard, key string, list *listValue, left bool, count int) []string {
+	if count > len(list.items) {
+		count = len(list.items)
+	}
+	popped := make([]string, 0, count)
+	if left {
+		popped = append(popped, list.items[:count]...)
+		list.items = list.items[count:]
+	} else {
+		for i := len(list.items) - 1; i >= len(list.items)-count; i-- {
+			popped = append(popped, list.items[i])
+		}
+		list.items = list.items[:len(list.items)-count]
+	}
+	for _, v := range popped {
+		r.unlink(v, key)
+	}
+	if left {
+		r.propagate("LPOP", key, strconv.Itoa(count))
+		r.modified(s, NotifyList, "lpop", key)
+	} else {
+		r.propagate("RPOP", key, strconv.Itoa(count))
+		r.modified(s, NotifyList, "rpop", key)
+	}
+	if len(list.items) == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return popped
+}
+
+// LLen returns the length of the list at key, or 0 if it does not exist.
+func (r *InMemoryRepository) LLen(key string) (int, error) {
+	var n int
+	err := r.viewList(key, func(l *listValue) {
+		n = len(l.items)
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// LRange returns the elements between start and stop inclusive. Negative
+// indices count from the tail, -1 being the last element.
+func (r *InMemoryRepository) LRange(key string, start, stop int) ([]string, error) {
+	items := []string{}
+	err := r.viewList(key, func(l *listValue) {
+		from, to := listRange(start, stop, len(l.items))
+		items = append(items, l.items[from:to]...)
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return []string{}, nil
+	}
+	return items, err
+}
+
+// LIndex returns the element at index, which may be negative.
+func (r *InMemoryRepository) LIndex(key string, index int) (string, bool, error) {
+	var item string
+	var found bool
+	err := r.viewList(key, func(l *listValue) {
+		if i := listIndex(index, len(l.items)); i >= 0 && i < len(l.items) {
+			item, found = l.items[i], true
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return "", false, nil
+	}
+	return item, found, err
+}
+
+// LSet replaces the element at index, which may be negative.
+func (r *InMemoryRepository) LSet(key string, index int, value string) error {
+	if err := r.freeMemory(); err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, false)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrKeyNotFound
+	}
+	i := listIndex(index, len(list.items))
+	if i < 0 || i >= len(list.items) {
+		return ErrIndexOutOfRange
+	}
+	r.unlink(list.items[i], key)
+	list.items[i] = value
+	r.link(value, key)
+	r.propagate("LSET", key, strconv.Itoa(i), value)
+	r.modified(s, NotifyList, "lset", key)
+	return nil
+}
+
+// LInsert inserts value before or after the first occurrence of pivot and
+// returns the new length, -1 when pivot is missing or 0 when key is.
+func (r *InMemoryRepository) LInsert(key string, before bool, pivot, value string) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	for i, item := range list.items {
+		if item != pivot {
+			continue
+		}
+		if !before {
+			i++
+		}
+		list.items = append(list.items, "")
+		copy(list.items[i+1:], list.items[i:])
+		list.items[i] = value
+		r.link(value, key)
+		if before {
+			r.propagate("LINSERT", key, "BEFORE", pivot, value)
+		} else {
+			r.propagate("LINSERT", key, "AFTER", pivot, value)
+		}
+		r.modified(s, NotifyList, "linsert", key)
+		return len(list.items), nil
+	}
+	return -1, nil
+}
+
+// LPos returns the indices of element in the list at key. rank selects
+// which match to start from: 1 is the first, -1 the last searching from the
+// tail. count limits the number of matches, 0 meaning all, and maxLen limits
+// how many elements are compared, 0 meaning all.
+func (r *InMemoryRepository) LPos(key, element string, rank, count, maxLen int) ([]int, error) {
+	positions := []int{}
+	err := r.viewList(key, func(l *listValue) {
+		n := len(l.items)
+		step, i, skip := 1, 0, rank-1
+		if rank < 0 {
+			step, i, skip = -1, n-1, -rank-1
+		}
+		for compared := 0; i >= 0 && i < n; i += step {
+			if maxLen > 0 && compared >= maxLen {
+				break
+			}
+			compared++
+			if l.items[i] != element {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			positions = append(positions, i)
+			if count > 0 && len(positions) == count {
+				break
+			}
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return []int{}, nil
+	}
+	return positions, err
+}
+
+// LRem removes occurrences of element and returns how many were removed.
+// count > 0 removes the first count matches from the head, count < 0 the
+// last ones from the tail and count == 0 all of them.
+func (r *InMemoryRepository) LRem(key string, count int, element string) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, false)
+	if err != nil || list == nil {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	drop := make([]bool, len(list.items))
+	removed := 0
+	step, i := 1, 0
+	if count < 0 {
+		step, i = -1, len(list.items)-1
+	}
+	for ; i >= 0 && i < len(list.items); i += step {
+		if list.items[i] == element {
+			drop[i] = true
+			removed++
+			if limit > 0 && removed == limit {
+				break
+			}
+		}
+	}
+
+	kept := list.items[:0]
+	for j, item := range list.items {
+		if drop[j] {
+			r.unlink(item, key)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	list.items = kept
+	if removed > 0 {
+		r.propagate("LREM", key, strconv.Itoa(count), element)
+		r.modified(s, NotifyList, "lrem", key)
+	}
+	if len(list.items) == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return removed, nil
+}
+
+// LTrim keeps only the elements between start and stop inclusive. The key is
+// deleted when nothing remains.
+func (r *InMemoryRepository) LTrim(key string, start, stop int) error {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := r.listForWriteLocked(s, key, false)
+	if err != nil || list == nil {
+		return err
+	}
+	from, to := listRange(start, stop, len(list.items))
+	for i, item := range list.items {
+		if i < from || i >= to {
+			r.unlink(item, key)
+		}
+	}
+	list.items = append([]string(nil), list.items[from:to]...)
+	r.propagate("LTRIM", key, strconv.Itoa(start), strconv.Itoa(stop))
+	r.modified(s, NotifyList, "ltrim", key)
+	if len(list.items) == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return nil
+}
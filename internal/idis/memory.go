@@ -0,0 +1,520 @@
+package idis
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Every key carries metadata with its approximate size, updated whenever the
+// key is modified, when it was created and when it was last accessed, for
+// eviction and for OBJECT and MEMORY, see object.go. Sizes count the key, its
+// value, its deadline and its entries in the reverse lookup; collections
+// larger than MemoryUsageSamples elements are estimated from a sample, as
+// MEMORY USAGE does in Redis, so keeping them up to date stays cheap.
+//
+// Once the sum of the sizes passes maxmemory, commands that may add data
+// first evict keys chosen by the eviction policy. Like Redis, LRU, LFU and
+// TTL policies are approximated: a few keys are sampled from random shards
+// and the best candidates seen so far are kept in a small pool.
+
+const (
+	// Approximate overheads in bytes
+	keyOverhead        = 96 // store entry, string header and metadata
+	expiryOverhead     = 48 // expiry entry
+	elementOverhead    = 16 // string header of a collection element
+	tableEntryOverhead = 32 // extra cost of an element in a hash table
+	indexEntryOverhead = 48 // reverse lookup entry for an indexed element
+	zsetEntryOverhead  = 96 // dict entry and skiplist node
+	streamEntryBytes   = 48 // entry ID and fields slice header
+
+	// MemoryUsageSamples is the number of elements measured to estimate the
+	// size of a larger collection, unless MEMORY USAGE asks for another.
+	MemoryUsageSamples = 32
+
+	// evictionPoolSize is the number of eviction candidates kept between
+	// evictions.
+	evictionPoolSize = 16
+
+	// DefaultMaxMemorySamples is the number of keys sampled per eviction.
+	DefaultMaxMemorySamples = 5
+
+	// LFU counters grow logarithmically from lfuInitVal and are decremented
+	// once for every lfuDecayTime without access, as in Redis.
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+)
+
+// ErrOOM is returned by commands that may add data when the used memory is
+// over maxmemory and no key can be evicted.
+var ErrOOM = &CodedError{Code: "OOM", Msg: "command not allowed when used memory > 'maxmemory'"}
+
+// EvictionPolicy chooses the keys evicted when the used memory is over
+// maxmemory.
+type EvictionPolicy int
+
+const (
+	NoEviction     EvictionPolicy = iota // reject commands that may add data
+	AllKeysLRU                           // least recently used key
+	AllKeysLFU                           // least frequently used key
+	AllKeysRandom                        // any key
+	VolatileLRU                          // least recently used key with a TTL
+	VolatileLFU                          // least frequently used key with a TTL
+	VolatileRandom                       // any key with a TTL
+	VolatileTTL                          // key with the nearest deadline
+)
+
+var evictionPolicyNames = []string{
+	NoEviction:     "noeviction",
+	AllKeysLRU:     "allkeys-lru",
+	AllKeysLFU:     "allkeys-lfu",
+	AllKeysRandom:  "allkeys-random",
+	VolatileLRU:    "volatile-lru",
+	VolatileLFU:    "volatile-lfu",
+	VolatileRandom: "volatile-random",
+	VolatileTTL:    "volatile-ttl",
+}
+
+func (p EvictionPolicy) String() string {
+	if p >= 0 && int(p) < len(evictionPolicyNames) {
+		return evictionPolicyNames[p]
+	}
+	return "unknown"
+}
+
+// ParseEvictionPolicy parses a policy name such as allkeys-lru.
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	for p, name := range evictionPolicyNames {
+		if strings.EqualFold(s, name) {
+			return EvictionPolicy(p), nil
+		}
+	}
+	return NoEviction, fmt.Errorf("invalid eviction policy '%s', expected one of %s", s, strings.Join(evictionPolicyNames, ", "))
+}
+
+// volatile reports whether the policy only evicts keys with a TTL.
+func (p EvictionPolicy) volatile() bool {
+	return p >= VolatileLRU
+}
+
+// keyMeta is the metadata of a key. size is guarded by the shard lock;
+// access and freq are updated atomically by readers holding a read lock.
+type keyMeta struct {
+	size    int64
+	created int64         // Unix milliseconds of the creation
+	access  atomic.Int64  // Unix milliseconds of the last access
+	freq    atomic.Uint32 // logarithmic LFU counter, at most 255
+}
+
+func newKeyMeta(now time.Time) *keyMeta {
+	m := &keyMeta{created: now.UnixMilli()}
+	m.access.Store(now.UnixMilli())
+	m.freq.Store(lfuInitVal)
+	return m
+}
+
+// touch records an access to the key.
+func (m *keyMeta) touch(now time.Time) {
+	counter := m.decayedFreq(now)
+	if counter < 255 {
+		base := float64(counter) - lfuInitVal
+		if base < 0 {
+			base = 0
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	m.freq.Store(counter)
+	m.access.Store(now.UnixMilli())
+}
+
+// decayedFreq returns the LFU counter, decremented once for every
+// lfuDecayTime since the last access.
+func (m *keyMeta) decayedFreq(now time.Time) uint32 {
+	counter := m.freq.Load()
+	periods := now.Sub(time.UnixMilli(m.access.Load())) / lfuDecayTime
+	if periods <= 0 {
+		return counter
+	}
+	if int64(periods) >= int64(counter) {
+		return 0
+	}
+	return counter - uint32(periods)
+}
+
+// idle returns how long the key has gone without access.
+func (m *keyMeta) idle(now time.Time) time.Duration {
+	return now.Sub(time.UnixMilli(m.access.Load()))
+}
+
+// memoryState holds the eviction settings and statistics.
+type memoryState struct {
+	used    atomic.Int64 // sum of the sizes of all keys
+	max     atomic.Int64 // 0 for no limit
+	policy  atomic.Int32
+	samples atomic.Int32
+	evicted atomic.Int64
+
+	mu   sync.Mutex // serializes evictions, guards pool
+	pool []evictionCandidate
+}
+
+// evictionCandidate is a key considered for eviction; the higher the score,
+// the better a candidate.
+type evictionCandidate struct {
+	key   string
+	score int64
+}
+
+// MemoryStatus reports the memory used by the keyspace and its limit.
+type MemoryStatus struct {
+	UsedMemory  int64  `json:"used_memory"`
+	MaxMemory   int64  `json:"maxmemory"`
+	Policy      string `json:"maxmemory_policy"`
+	Samples     int    `json:"maxmemory_samples"`
+	EvictedKeys int64  `json:"evicted_keys"`
+}
+
+// SetMaxMemory sets the memory limit in bytes, 0 for none. Keys are evicted
+// by the next command adding data, not at once.
+func (r *InMemoryRepository) SetMaxMemory(bytes int64) {
+	r.memory.max.Store(bytes)
+}
+
+// MaxMemory returns the memory limit in bytes, 0 for none.
+func (r *InMemoryRepository) MaxMemory() int64 {
+	return r.memory.max.Load()
+}
+
+// SetEvictionPolicy sets how keys are chosen for eviction.
+func (r *InMemoryRepository) SetEvictionPolicy(policy EvictionPolicy) {
+	r.memory.mu.Lock()
+	defer r.memory.mu.Unlock()
+	r.memory.policy.Store(int32(policy))
+	// Scores from another policy do not compare
+	r.memory.pool = nil
+}
+
+// EvictionPolicy returns how keys are chosen for eviction.
+func (r *InMemoryRepository) EvictionPolicy() EvictionPolicy {
+	return EvictionPolicy(r.memory.policy.Load())
+}
+
+// SetMaxMemorySamples sets how many keys are sampled per eviction; more
+// samples approximate the policy better at a higher cost.
+func (r *InMemoryRepository) SetMaxMemorySamples(n int) {
+	r.memory.samples.Store(int32(max(n, 1)))
+}
+
+// MaxMemorySamples returns how many keys are sampled per eviction.
+func (r *InMemoryRepository) MaxMemorySamples() int {
+	return int(r.memory.samples.Load())
+}
+
+// UsedMemory returns the approximate number of bytes held by the keyspace.
+func (r *InMemoryRepository) UsedMemory() int64 {
+	return r.memory.used.Load()
+}
+
+// MemoryStatus returns the used memory, its limit and eviction statistics.
+func (r *InMemoryRepository) MemoryStatus() MemoryStatus {
+	return MemoryStatus{
+		UsedMemory:  r.UsedMemory(),
+		MaxMemory:   r.MaxMemory(),
+		Policy:      r.EvictionPolicy().String(),
+		Samples:     r.MaxMemorySamples(),
+		EvictedKeys: r.memory.evicted.Load(),
+	}
+}
+
+// account updates the size of key after a change and returns its metadata,
+// or nil if the key is gone. The caller must hold the write lock of the
+// key's shard.
+func (r *InMemoryRepository) account(s *shard, key string, now time.Time) *keyMeta {
+	v, ok := s.store[key]
+	m := s.meta[key]
+	if !ok {
+		if m != nil {
+			r.memory.used.Add(-m.size)
+			delete(s.meta, key)
+		}
+		return nil
+	}
+	if m == nil {
+		m = newKeyMeta(now)
+		s.meta[key] = m
+	}
+	size := keySize(s, key, v, MemoryUsageSamples)
+	r.memory.used.Add(size - m.size)
+	m.size = size
+	return m
+}
+
+// keySize estimates the bytes held by key and its value v, measuring samples
+// elements of larger collections, or all of them if samples is 0. The caller
+// must hold at least the read lock of the key's shard.
+func keySize(s *shard, key string, v value, samples int) int64 {
+	size := int64(keyOverhead+len(key)) + valueSize(v, samples)
+	if _, ok := s.expiry[key]; ok {
+		size += expiryOverhead
+	}
+	return size
+}
+
+// valueSize estimates the bytes held by v, including its entries in the
+// reverse lookup, see keySize.
+func valueSize(v value, samples int) int64 {
+	switch v := v.(type) {
+	case *stringValue:
+		return int64(elementOverhead+len(v.s)) + indexEntryOverhead
+	case *listValue:
+		return 24 + sampledSum(len(v.items), samples, func(i int) int {
+			return elementOverhead + indexEntryOverhead + len(v.items[i])
+		})
+	case *setValue:
+		if v.table == nil {
+			return 24 + sampledSum(len(v.small), samples, func(i int) int {
+				return elementOverhead + indexEntryOverhead + len(v.small[i])
+			})
+		}
+		return 48 + sampledMap(v.table, samples, func(m string, _ struct{}) int {
+			return elementOverhead + tableEntryOverhead + indexEntryOverhead + len(m)
+		})
+	case *hashValue:
+		if v.table == nil {
+			return 24 + sampledSum(len(v.small), samples, func(i int) int {
+				return 2*elementOverhead + len(v.small[i].Field) + len(v.small[i].Value)
+			})
+		}
+		return 48 + sampledMap(v.table, samples, func(f, val string) int {
+			return 2*elementOverhead + tableEntryOverhead + len(f) + len(val)
+		})
+	case *zsetValue:
+		return 96 + sampledMap(v.dict, samples, func(m string, _ float64) int {
+			return zsetEntryOverhead + len(m)
+		})
+	case *streamValue:
+		size := 64 + sampledSum(len(v.entries), samples, func(i int) int {
+			n := streamEntryBytes
+			for _, f := range v.entries[i].Fields {
+				n += elementOverhead + len(f)
+			}
+			return n
+		})
+		for name, g := range v.groups {
+			size += int64(96 + len(name) + 64*len(g.pending))
+			for consumer := range g.consumers {
+				size += int64(48 + len(consumer))
+			}
+		}
+		return size
+	}
+	return 0
+}
+
+// sampledSum returns the sum of size(i) for i in [0, n), estimated from
+// samples evenly spaced elements when n is larger and samples is not 0.
+func sampledSum(n, samples int, size func(i int) int) int64 {
+	if samples == 0 || n <= samples {
+		total := 0
+		for i := 0; i < n; i++ {
+			total += size(i)
+		}
+		return int64(total)
+	}
+	total := 0
+	for i := 0; i < samples; i++ {
+		total += size(i * n / samples)
+	}
+	return int64(total) * int64(n) / int64(samples)
+}
+
+// sampledMap returns the sum of size over the entries of m, estimated from
+// the first samples entries iterated, which start at a random place, when m
+// is larger and samples is not 0.
+func sampledMap[K comparable, V any](m map[K]V, samples int, size func(k K, v V) int) int64 {
+	total, sampled := 0, 0
+	for k, v := range m {
+		if sampled == samples && samples != 0 {
+			break
+		}
+		total += size(k, v)
+		sampled++
+	}
+	if sampled == 0 {
+		return 0
+	}
+	return int64(total) * int64(len(m)) / int64(sampled)
+}
+
+// freeMemory evicts keys until the used memory is within maxmemory, or
+// returns ErrOOM if it cannot. Commands that may add data call it before
+// taking any lock. Nothing is evicted while loading.
+func (r *InMemoryRepository) freeMemory() error {
+	limit := r.memory.max.Load()
+	if limit == 0 || r.memory.used.Load() <= limit || r.loading.Load() {
+		return nil
+	}
+	policy := r.EvictionPolicy()
+	if policy == NoEviction {
+		return ErrOOM
+	}
+
+	r.memory.mu.Lock()
+	defer r.memory.mu.Unlock()
+	for r.memory.used.Load() > limit {
+		if !r.evictOne(policy) {
+			return ErrOOM
+		}
+	}
+	return nil
+}
+
+// evictOne evicts a key chosen by policy and reports whether there was one.
+// The caller must hold memory.mu.
+func (r *InMemoryRepository) evictOne(policy EvictionPolicy) bool {
+	if policy == AllKeysRandom || policy == VolatileRandom {
+		return r.evictRandom(policy)
+	}
+
+	r.fillEvictionPool(policy)
+	for len(r.memory.pool) > 0 {
+		// The best candidate is last
+		c := r.memory.pool[len(r.memory.pool)-1]
+		r.memory.pool = r.memory.pool[:len(r.memory.pool)-1]
+		if r.evictKey(c.key, policy.volatile()) {
+			return true
+		}
+	}
+	return false
+}
+
+// fillEvictionPool samples keys from random shards into the eviction pool,
+// which keeps the evictionPoolSize best candidates in ascending order of
+// score. A shard without eligible keys is passed over for the next one, so
+// that keys are found however few there are.
+func (r *InMemoryRepository) fillEvictionPool(policy EvictionPolicy) {
+	now := time.Now()
+	samples := r.MaxMemorySamples()
+	for i := 0; i < samples; i++ {
+		start := rand.Intn(len(r.shards))
+		found := false
+		for j := range r.shards {
+			s := r.shards[(start+j)%len(r.shards)]
+			s.mu.RLock()
+			key, score, ok := r.sampleLocked(s, policy, now)
+			s.mu.RUnlock()
+			if ok {
+				r.poolInsert(evictionCandidate{key, score})
+				found = true
+				break
+			}
+		}
+		if !found {
+			// No shard has an eligible key
+			return
+		}
+	}
+}
+
+// sampleLocked picks a random key of s eligible under policy and scores it.
+func (r *InMemoryRepository) sampleLocked(s *shard, policy EvictionPolicy, now time.Time) (string, int64, bool) {
+	var key string
+	found := false
+	if policy.volatile() {
+		for k := range s.expiry {
+			key, found = k, true
+			break
+		}
+	} else {
+		for k := range s.store {
+			key, found = k, true
+			break
+		}
+	}
+	if !found {
+		return "", 0, false
+	}
+
+	var score int64
+	switch policy {
+	case VolatileTTL:
+		// The nearer the deadline, the higher the score
+		score = math.MaxInt64 - s.expiry[key].UnixMilli()
+	case AllKeysLFU, VolatileLFU:
+		if m := s.meta[key]; m != nil {
+			score = 255 - int64(m.decayedFreq(now))
+		}
+	default:
+		if m := s.meta[key]; m != nil {
+			score = int64(m.idle(now))
+		}
+	}
+	return key, score, true
+}
+
+// poolInsert adds a candidate to the eviction pool, or refreshes its score if
+// the key is already there, dropping the worst candidate when full.
+func (r *InMemoryRepository) poolInsert(c evictionCandidate) {
+	pool := r.memory.pool
+	for i := range pool {
+		if pool[i].key == c.key {
+			pool = append(pool[:i], pool[i+1:]...)
+			break
+		}
+	}
+	if len(pool) == evictionPoolSize {
+		if c.score <= pool[0].score {
+			r.memory.pool = pool
+			return
+		}
+		pool = pool[1:]
+	}
+	i := sort.Search(len(pool), func(i int) bool { return pool[i].score > c.score })
+	pool = append(pool, evictionCandidate{})
+	copy(pool[i+1:], pool[i:])
+	pool[i] = c
+	r.memory.pool = pool
+}
+
+// evictRandom evicts a key from a random shard, trying the others in turn if
+// it has none eligible under policy.
+func (r *InMemoryRepository) evictRandom(policy EvictionPolicy) bool {
+	start := rand.Intn(len(r.shards))
+	for i := range r.shards {
+		s := r.shards[(start+i)%len(r.shards)]
+		s.mu.RLock()
+		key, _, ok := r.sampleLocked(s, policy, time.Time{})
+		s.mu.RUnlock()
+		if ok && r.evictKey(key, policy.volatile()) {
+			return true
+		}
+	}
+	return false
+}
+
+// evictKey deletes key, if it still exists and, for volatile policies, still
+// has a TTL, and reports whether it did.
+func (r *InMemoryRepository) evictKey(key string, volatile bool) bool {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.store[key]; !ok {
+		return false
+	}
+	if _, ok := s.expiry[key]; volatile && !ok {
+		return false
+	}
+	r.removeKeyLocked(s, key)
+	r.propagate("DEL", key)
+	r.modified(s, NotifyEvicted, "evicted", key)
+	r.memory.evicted.Add(1)
+	return true
+}
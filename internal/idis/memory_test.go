@@ -0,0 +1,153 @@
+package idis
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	evictionKeys = 100 // keys of each kind
+	coldPrefix   = "cold:"
+	hotPrefix    = "hot:"
+)
+
+// filledRepository returns a repository holding evictionKeys cold and hot
+// keys, the hot ones read after the cold ones were last used and often
+// enough to have a higher LFU counter, and, when volatile is set, a TTL on
+// every key, nearer for cold keys. Another evictionKeys persistent keys have
+// no TTL either way.
+func filledRepository(t *testing.T, policy EvictionPolicy, volatile bool) *InMemoryRepository {
+	t.Helper()
+	r := NewShardedRepository(4)
+	r.SetEvictionPolicy(policy)
+	r.SetMaxMemorySamples(64)
+	for i := 0; i < evictionKeys; i++ {
+		n := strconv.Itoa(i)
+		for _, key := range []string{coldPrefix + n, hotPrefix + n, "persistent:" + n} {
+			if err := r.SetString(key, "value"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if volatile {
+			r.Expire(coldPrefix+n, time.Hour+time.Duration(i)*time.Second)
+			r.Expire(hotPrefix+n, 2*time.Hour+time.Duration(i)*time.Second)
+		}
+	}
+
+	// Idle times are kept to the millisecond
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < evictionKeys; i++ {
+		for j := 0; j < 100; j++ {
+			r.GetString(hotPrefix + strconv.Itoa(i))
+		}
+	}
+	return r
+}
+
+// evicted returns how many keys with prefix are gone.
+func evicted(r *InMemoryRepository, prefix string) int {
+	n := 0
+	for i := 0; i < evictionKeys; i++ {
+		if !r.Exists(prefix + strconv.Itoa(i)) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		policy   EvictionPolicy
+		volatile bool
+		// whether cold keys must go before hot ones, and persistent keys
+		// must stay
+		coldFirst, keepPersistent bool
+	}{
+		{AllKeysLRU, false, true, false},
+		{AllKeysLFU, false, true, false},
+		{AllKeysRandom, false, false, false},
+		{VolatileLRU, true, true, true},
+		{VolatileLFU, true, true, true},
+		{VolatileRandom, true, false, true},
+		{VolatileTTL, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			r := filledRepository(t, tt.policy, tt.volatile)
+			limit := r.UsedMemory() * 3 / 4
+			r.SetMaxMemory(limit)
+
+			// The next write makes room first
+			if err := r.SetString("new", "value"); err != nil {
+				t.Fatalf("SetString() error = %v", err)
+			}
+			if !r.Exists("new") {
+				t.Fatalf("the key written was evicted")
+			}
+			status := r.MemoryStatus()
+			if status.EvictedKeys == 0 {
+				t.Fatalf("no key was evicted")
+			}
+			// Room is made before the write, which may then go over by itself
+			newKey := int64(keyOverhead + len("new") + elementOverhead + len("value") + indexEntryOverhead)
+			if used := r.UsedMemory(); used > limit+newKey {
+				t.Errorf("used memory = %d, want %d at most", used, limit+newKey)
+			}
+
+			cold, hot, persistent := evicted(r, coldPrefix), evicted(r, hotPrefix), evicted(r, "persistent:")
+			if got := int64(cold + hot + persistent); got != status.EvictedKeys {
+				t.Errorf("%d keys are gone, %d reported evicted", got, status.EvictedKeys)
+			}
+			if tt.keepPersistent && persistent > 0 {
+				t.Errorf("%d keys without a TTL were evicted", persistent)
+			}
+			if tt.coldFirst && cold <= hot {
+				t.Errorf("evicted %d cold and %d hot keys, want mostly cold ones", cold, hot)
+			}
+		})
+	}
+}
+
+func TestEvictionWithoutCandidates(t *testing.T) {
+	// Volatile policies cannot make room when no key has a TTL
+	r := filledRepository(t, VolatileLRU, false)
+	r.SetMaxMemory(r.UsedMemory() / 2)
+	if err := r.SetString("new", "value"); !errors.Is(err, ErrOOM) {
+		t.Fatalf("SetString() error = %v, want %v", err, ErrOOM)
+	}
+	if n := r.MemoryStatus().EvictedKeys; n != 0 {
+		t.Errorf("%d keys evicted, want none", n)
+	}
+}
+
+func TestNoEviction(t *testing.T) {
+	r := filledRepository(t, NoEviction, false)
+	r.SetMaxMemory(r.UsedMemory() / 2)
+
+	if err := r.SetString("new", "value"); !errors.Is(err, ErrOOM) {
+		t.Fatalf("SetString() error = %v, want %v", err, ErrOOM)
+	}
+	if _, err := r.Push("list", false, false, "v"); !errors.Is(err, ErrOOM) {
+		t.Fatalf("Push() error = %v, want %v", err, ErrOOM)
+	}
+	if r.Exists("new") || r.Exists("list") {
+		t.Errorf("a rejected write was applied")
+	}
+	if n := r.MemoryStatus().EvictedKeys; n != 0 {
+		t.Errorf("%d keys evicted, want none", n)
+	}
+
+	// Reads and deletions are still served, and free memory
+	if s, err := r.GetString(coldPrefix + "0"); err != nil || s != "value" {
+		t.Errorf("GetString() = %q, %v, want value", s, err)
+	}
+	for i := 0; i < evictionKeys; i++ {
+		r.Delete(coldPrefix + strconv.Itoa(i))
+		r.Delete(hotPrefix + strconv.Itoa(i))
+	}
+	if err := r.SetString("new", "value"); err != nil {
+		t.Errorf("SetString() once under the limit: error = %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package idis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keyspace notification classes, selected with the same flags as the Redis
+// notify-keyspace-events setting. K and E choose the channels notifications
+// are published on; the other flags choose which events are published.
+const (
+	NotifyKeyspace = 1 << iota // K: __keyspace@0__:<key> with the event as message
+	NotifyKeyevent             // E: __keyevent@0__:<event> with the key as message
+	NotifyGeneric              // g: del, expire
+	NotifyString               // $: setstr, incrby, append
+	NotifyList                 // l: set, setuq, remove, lpush, rpush, lpop, rpop, lset, linsert, lrem, ltrim
+	NotifySet                  // s: sadd, srem
+	NotifyHash                 // h: hset, hdel, hincrby, hincrbyfloat
+	NotifyZSet                 // z: zadd, zincr, zrem, zpopmin, zpopmax
+	NotifyExpired              // x: a key reached its TTL and was removed
+	NotifyEvicted              // e: a key was removed to reclaim memory
+	NotifyStream               // t: xadd, xdel, xtrim, xgroup-*
+
+	// NotifyAll is the A flag, every event class but not the channels.
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream
+)
+
+// notifyFlagChars maps each flag character to its class, in the order
+// NotifyFlagsString writes them.
+var notifyFlagChars = []struct {
+	c     byte
+	class int
+}{
+	{'g', NotifyGeneric},
+	{'$', NotifyString},
+	{'l', NotifyList},
+	{'s', NotifySet},
+	{'h', NotifyHash},
+	{'z', NotifyZSet},
+	{'x', NotifyExpired},
+	{'e', NotifyEvicted},
+	{'t', NotifyStream},
+	{'K', NotifyKeyspace},
+	{'E', NotifyKeyevent},
+}
+
+// ParseNotifyFlags parses a notify-keyspace-events string such as "KEA" or
+// "Ex". The empty string disables notifications.
+func ParseNotifyFlags(s string) (int, error) {
+	flags := 0
+outer:
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+		for _, f := range notifyFlagChars {
+			if f.c == s[i] {
+				flags |= f.class
+				continue outer
+			}
+		}
+		return 0, fmt.Errorf("invalid notify-keyspace-events flag '%c'", s[i])
+	}
+	return flags, nil
+}
+
+// NotifyFlagsString formats flags the way ParseNotifyFlags reads them,
+// using A when every event class is set.
+func NotifyFlagsString(flags int) string {
+	var b strings.Builder
+	if flags&NotifyAll == NotifyAll {
+		b.WriteByte('A')
+	}
+	for _, f := range notifyFlagChars {
+		if flags&f.class != 0 && (f.class&NotifyAll == 0 || flags&NotifyAll != NotifyAll) {
+			b.WriteByte(f.c)
+		}
+	}
+	return b.String()
+}
+
+// Publisher delivers a message on a pub/sub channel.
+type Publisher func(channel, message string)
+
+// SetPublisher sets where keyspace notifications are delivered. It must be
+// called before the repository is shared between goroutines.
+func (r *InMemoryRepository) SetPublisher(p Publisher) {
+	r.publish = p
+}
+
+// SetNotifyFlags selects the keyspace notifications published, see
+// ParseNotifyFlags. Notifications are off until it is called.
+func (r *InMemoryRepository) SetNotifyFlags(flags int) {
+	r.notifyFlags.Store(int64(flags))
+}
+
+// NotifyFlags returns the keyspace notification classes enabled.
+func (r *InMemoryRepository) NotifyFlags() int {
+	return int(r.notifyFlags.Load())
+}
+
+// notifying reports whether events of class are published at all, so callers
+// can skip building notifications nobody will receive.
+func (r *InMemoryRepository) notifying(class int) bool {
+	flags := r.NotifyFlags()
+	return r.publish != nil && flags&class != 0 && flags&(NotifyKeyspace|NotifyKeyevent) != 0
+}
+
+// notify publishes a keyspace notification for event on key. It is called
+// with the key's shard locked, so the notifications of a key are published
+// in the order its changes were made.
+func (r *InMemoryRepository) notify(class int, event, key string) {
+	if !r.notifying(class) {
+		return
+	}
+	flags := r.NotifyFlags()
+	if flags&NotifyKeyspace != 0 {
+		r.publish("__keyspace@0__:"+key, event)
+	}
+	if flags&NotifyKeyevent != 0 {
+		r.publish("__keyevent@0__:"+event, key)
+	}
+}
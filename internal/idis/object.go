@@ -0,0 +1,85 @@
+package idis
+
+import (
+	"time"
+)
+
+// ObjectInfo describes the value stored at a key and its metadata, as
+// reported by OBJECT and /object/{key}.
+type ObjectInfo struct {
+	Type       string
+	Encoding   string
+	Size       int64 // approximate bytes, as counted towards maxmemory
+	Created    time.Time
+	LastAccess time.Time
+	Idle       time.Duration // time since LastAccess
+	Freq       uint32        // logarithmic LFU counter, see keyMeta
+}
+
+// MemoryStats reports how the memory counted towards maxmemory is spread
+// over the keyspace.
+type MemoryStats struct {
+	MemoryStatus
+	Keys         int   `json:"keys_count"`
+	Expires      int   `json:"expires_count"`
+	BytesPerKey  int64 `json:"keys_bytes_per_key"`
+	IndexValues  int   `json:"index_values"`
+	IndexEntries int   `json:"index_entries"`
+}
+
+// Object returns the metadata of the value stored at key. Unlike reads, it
+// does not count as an access.
+func (r *InMemoryRepository) Object(key string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := r.peek(key, func(s *shard, v value, m *keyMeta) error {
+		info.Type = v.Type()
+		info.Encoding = v.Encoding()
+		if m == nil {
+			return nil
+		}
+		now := time.Now()
+		info.Size = m.size
+		info.Created = time.UnixMilli(m.created)
+		info.LastAccess = time.UnixMilli(m.access.Load())
+		info.Idle = max(m.idle(now), 0)
+		info.Freq = m.decayedFreq(now)
+		return nil
+	})
+	return info, err
+}
+
+// MemoryUsage estimates the bytes held by key and its value, measuring
+// samples elements of larger collections, or all of them if samples is 0.
+// It does not count as an access.
+func (r *InMemoryRepository) MemoryUsage(key string, samples int) (int64, error) {
+	var size int64
+	err := r.peek(key, func(s *shard, v value, _ *keyMeta) error {
+		size = keySize(s, key, v, samples)
+		return nil
+	})
+	return size, err
+}
+
+// MemoryStats counts the keys, deadlines and reverse lookup entries one shard
+// at a time, so the totals may be slightly off while keys are written.
+func (r *InMemoryRepository) MemoryStats() MemoryStats {
+	stats := MemoryStats{MemoryStatus: r.MemoryStatus()}
+	for _, s := range r.shards {
+		s.mu.RLock()
+		stats.Keys += len(s.store)
+		stats.Expires += len(s.expiry)
+		s.mu.RUnlock()
+	}
+	for _, ix := range r.index {
+		ix.mu.RLock()
+		stats.IndexValues += len(ix.keys)
+		for _, keys := range ix.keys {
+			stats.IndexEntries += len(keys)
+		}
+		ix.mu.RUnlock()
+	}
+	if stats.Keys > 0 {
+		stats.BytesPerKey = stats.UsedMemory / int64(stats.Keys)
+	}
+	return stats
+}
@@ -1,6 +1,9 @@
 package idis
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Repository interface {
 	Set(key string, values ...string) error
@@ -16,4 +19,115 @@ type Repository interface {
 	GetKeyFromValue(value string) ([]string, error)
 	DumpToFile(filename string) error
 	LoadFromDump(filename string) error
+
+	// Typed values
+	Type(key string) (string, error)
+	SetString(key, value string) error
+	GetString(key string) (string, error)
+	IncrBy(key string, delta int64) (int64, error)
+	Append(key, value string) (int, error)
+	StrLen(key string) (int, error)
+	SAdd(key string, members ...string) (int, error)
+	SRem(key string, members ...string) (int, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key, member string) (bool, error)
+	SCard(key string) (int, error)
+
+	// Sorted sets
+	ZAdd(key string, opts ZAddOptions, members ...ScoredMember) (int, error)
+	ZAddIncr(key string, opts ZAddOptions, m ScoredMember) (float64, bool, error)
+	ZRem(key string, members ...string) (int, error)
+	ZScore(key, member string) (float64, bool, error)
+	ZCard(key string) (int, error)
+	ZRank(key, member string, rev bool) (int, bool, error)
+	ZRangeByRank(key string, start, stop int, rev bool) ([]ScoredMember, error)
+	ZRangeByScore(key string, min, max ScoreBound, rev bool, offset, count int) ([]ScoredMember, error)
+	ZRangeByLex(key string, min, max LexBound, rev bool, offset, count int) ([]ScoredMember, error)
+	ZCount(key string, min, max ScoreBound) (int, error)
+	ZPop(key string, count int, max bool) ([]ScoredMember, error)
+
+	// Hashes
+	HSet(key string, fields ...FieldValue) (int, error)
+	HGet(key, field string) (string, bool, error)
+	HDel(key string, fields ...string) (int, error)
+	HGetAll(key string) ([]FieldValue, error)
+	HExists(key, field string) (bool, error)
+	HLen(key string) (int, error)
+	HIncrBy(key, field string, delta int64) (int64, error)
+	HIncrByFloat(key, field string, delta float64) (string, error)
+	HScan(key string, cursor uint64, match string, count int) (uint64, []FieldValue, error)
+
+	// Lists
+	Push(key string, left, onlyExisting bool, values ...string) (int, error)
+	Pop(key string, left bool, count int) ([]string, error)
+	LLen(key string) (int, error)
+	LRange(key string, start, stop int) ([]string, error)
+	LIndex(key string, index int) (string, bool, error)
+	LSet(key string, index int, value string) error
+	LInsert(key string, before bool, pivot, value string) (int, error)
+	LPos(key, element string, rank, count, maxLen int) ([]int, error)
+	LRem(key string, count int, element string) (int, error)
+	LTrim(key string, start, stop int) error
+	Move(src, dst string, srcLeft, dstLeft bool) (string, bool, error)
+	BlockingPop(ctx context.Context, keys []string, left bool) (string, string, error)
+	BlockingMove(ctx context.Context, src, dst string, srcLeft, dstLeft bool) (string, error)
+
+	// Streams
+	XAdd(key, id string, fields []string, noMkStream bool, trim StreamTrim) (StreamID, bool, error)
+	XLen(key string) (int, error)
+	XRange(key string, start, end StreamID, count int, rev bool) ([]StreamEntry, error)
+	XDel(key string, ids ...StreamID) (int, error)
+	XTrim(key string, trim StreamTrim) (int, error)
+	XRead(ctx context.Context, keys, ids []string, count int, block bool) ([]StreamRead, error)
+	XGroupCreate(key, group, id string, mkStream bool) error
+	XGroupDestroy(key, group string) (bool, error)
+	XGroupSetID(key, group, id string) error
+	XGroupCreateConsumer(key, group, consumer string) (bool, error)
+	XGroupDelConsumer(key, group, consumer string) (int, error)
+	XReadGroup(ctx context.Context, group, consumer string, keys, ids []string, count int, noAck, block bool) ([]StreamRead, error)
+	XAck(key, group string, ids ...StreamID) (int, error)
+	XPending(key, group string) (PendingSummary, error)
+	XPendingRange(key, group string, start, end StreamID, count int, consumer string) ([]PendingEntry, error)
+
+	// Transactions
+	Version(key string) uint64
+
+	// Keyspace notifications
+	SetPublisher(p Publisher)
+	SetNotifyFlags(flags int)
+	NotifyFlags() int
+
+	// Append-only file
+	SetFsyncPolicy(policy FsyncPolicy)
+	FsyncPolicy() FsyncPolicy
+	BgRewriteAOF() error
+	CloseAOF() error
+	AOFStatus() AOFStatus
+
+	// Memory limit and eviction
+	SetMaxMemory(bytes int64)
+	MaxMemory() int64
+	SetEvictionPolicy(policy EvictionPolicy)
+	EvictionPolicy() EvictionPolicy
+	SetMaxMemorySamples(n int)
+	MaxMemorySamples() int
+	UsedMemory() int64
+	MemoryStatus() MemoryStatus
+
+	// Per-key introspection
+	Object(key string) (ObjectInfo, error)
+	MemoryUsage(key string, samples int) (int64, error)
+	MemoryStats() MemoryStats
+
+	// Snapshots
+	SetSnapshotFormat(format SnapshotFormat)
+	SnapshotFormat() SnapshotFormat
+	SetSnapshotCompression(compress bool)
+	SnapshotCompression() bool
+	SetDumpFile(filename string)
+	DumpFile() string
+	Save() error
+	BgSave() error
+	LastSave() time.Time
+	SaveStatus() SaveStatus
 }
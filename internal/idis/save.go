@@ -0,0 +1,198 @@
+package idis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSaveInProgress is returned when a snapshot is asked for while another
+// one is being written.
+var ErrSaveInProgress = errors.New("Background save already in progress")
+
+// saveState tracks the snapshots written by DumpToFile, Save and BgSave.
+type saveState struct {
+	mu           sync.Mutex
+	filename     string // used by Save and BgSave
+	inProgress   bool
+	background   bool
+	started      time.Time
+	keysTotal    int
+	keysDone     atomic.Int64
+	lastSave     time.Time // last successful snapshot
+	lastStatus   string    // "ok" or "err", empty before the first snapshot
+	lastErr      error
+	lastDuration time.Duration
+	startClock   uint64 // clock when the current snapshot started
+	savedClock   uint64 // clock when the last successful snapshot started
+	count        int
+}
+
+// SaveStatus reports the state of snapshots.
+type SaveStatus struct {
+	Filename         string        `json:"filename"`
+	InProgress       bool          `json:"in_progress"`
+	Background       bool          `json:"background"`
+	CurrentTime      time.Duration `json:"current_time"`
+	KeysTotal        int           `json:"keys_total"`
+	KeysDone         int64         `json:"keys_done"`
+	LastSave         time.Time     `json:"last_save"`
+	LastStatus       string        `json:"last_status"`
+	LastError        string        `json:"last_error,omitempty"`
+	LastDuration     time.Duration `json:"last_duration"`
+	ChangesSinceSave uint64        `json:"changes_since_save"`
+	Saves            int           `json:"saves"`
+}
+
+// SetDumpFile sets the file written by Save and BgSave.
+func (r *InMemoryRepository) SetDumpFile(filename string) {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	r.saves.filename = filename
+}
+
+// DumpFile returns the file written by Save and BgSave.
+func (r *InMemoryRepository) DumpFile() string {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	return r.saves.filename
+}
+
+// Save writes a snapshot to the dump file and returns once it is on disk.
+func (r *InMemoryRepository) Save() error {
+	return r.DumpToFile(r.DumpFile())
+}
+
+// BgSave starts writing a snapshot to the dump file in the background.
+func (r *InMemoryRepository) BgSave() error {
+	filename := r.DumpFile()
+	if err := r.beginSave(true); err != nil {
+		return err
+	}
+	go func() {
+		err := r.writeSnapshot(filename)
+		r.endSave(err)
+		if err != nil {
+			fmt.Println("Error dumping data:", err)
+		} else {
+			fmt.Println("Data successfully dumped to file:", filename)
+		}
+	}()
+	return nil
+}
+
+// LastSave returns when the last snapshot was successfully written, or the
+// zero time if none was.
+func (r *InMemoryRepository) LastSave() time.Time {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	return r.saves.lastSave
+}
+
+// SaveStatus returns the state of snapshots, including the progress of one
+// being written.
+func (r *InMemoryRepository) SaveStatus() SaveStatus {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	st := SaveStatus{
+		Filename:     r.saves.filename,
+		InProgress:   r.saves.inProgress,
+		Background:   r.saves.background,
+		LastSave:     r.saves.lastSave,
+		LastStatus:   r.saves.lastStatus,
+		LastDuration: r.saves.lastDuration,
+		Saves:        r.saves.count,
+	}
+	if r.saves.inProgress {
+		st.CurrentTime = time.Since(r.saves.started)
+		st.KeysTotal = r.saves.keysTotal
+		st.KeysDone = r.saves.keysDone.Load()
+	}
+	if r.saves.lastErr != nil {
+		st.LastError = r.saves.lastErr.Error()
+	}
+	// Every change moves the clock on by at least one, so this is an upper
+	// bound on the number of changes
+	st.ChangesSinceSave = r.clock.Load() - r.saves.savedClock
+	return st
+}
+
+// beginSave marks a snapshot as being written, failing if one already is.
+func (r *InMemoryRepository) beginSave(background bool) error {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	if r.saves.inProgress {
+		return ErrSaveInProgress
+	}
+	r.saves.inProgress = true
+	r.saves.background = background
+	r.saves.started = time.Now()
+	r.saves.keysTotal = 0
+	r.saves.keysDone.Store(0)
+	r.saves.startClock = r.clock.Load()
+	return nil
+}
+
+// endSave records the outcome of the snapshot being written.
+func (r *InMemoryRepository) endSave(err error) {
+	r.saves.mu.Lock()
+	defer r.saves.mu.Unlock()
+	r.saves.inProgress = false
+	r.saves.lastDuration = time.Since(r.saves.started)
+	r.saves.lastErr = err
+	r.saves.count++
+	if err != nil {
+		r.saves.lastStatus = "err"
+		return
+	}
+	r.saves.lastStatus = "ok"
+	r.saves.lastSave = r.saves.started
+	r.saves.savedClock = r.saves.startClock
+}
+
+// writeFileAtomic replaces filename with the output of write. The output
+// goes to a temporary file in the same directory, which is synced and
+// renamed over filename, so a crash leaves either the old file or the new
+// one, never a partial file.
+func writeFileAtomic(filename string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "temp-"+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	bw := bufio.NewWriterSize(tmp, 64*1024)
+	if err := write(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+	done = true
+	syncDir(filepath.Dir(filename))
+	return nil
+}
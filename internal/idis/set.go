@@ -0,0 +1,227 @@
+package idis
+
+import "errors"
+
+// setValue is an unordered collection of unique strings. Small sets are kept
+// in a slice, like the Redis listpack encoding, and converted to a hash table
+// once they grow past listpackMaxEntries or hold a long member.
+type setValue struct {
+	small []string
+	table map[string]struct{}
+}
+
+func newSetValue() *setValue {
+	return &setValue{}
+}
+
+func (v *setValue) Type() string { return TypeSet }
+
+func (v *setValue) Encoding() string {
+	if v.table != nil {
+		return "hashtable"
+	}
+	return "listpack"
+}
+
+func (v *setValue) clone() value {
+	c := &setValue{small: append([]string(nil), v.small...)}
+	if v.table != nil {
+		c.table = make(map[string]struct{}, len(v.table))
+		for m := range v.table {
+			c.table[m] = struct{}{}
+		}
+	}
+	return c
+}
+
+func (v *setValue) len() int {
+	if v.table != nil {
+		return len(v.table)
+	}
+	return len(v.small)
+}
+
+func (v *setValue) has(member string) bool {
+	if v.table != nil {
+		_, ok := v.table[member]
+		return ok
+	}
+	for _, m := range v.small {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// add inserts member and reports whether it was not already present.
+func (v *setValue) add(member string) bool {
+	if v.has(member) {
+		return false
+	}
+	if v.table == nil && (len(v.small) >= listpackMaxEntries || len(member) > listpackMaxValue) {
+		v.table = make(map[string]struct{}, len(v.small)+1)
+		for _, m := range v.small {
+			v.table[m] = struct{}{}
+		}
+		v.small = nil
+	}
+	if v.table != nil {
+		v.table[member] = struct{}{}
+	} else {
+		v.small = append(v.small, member)
+	}
+	return true
+}
+
+// remove deletes member and reports whether it was present.
+func (v *setValue) remove(member string) bool {
+	if v.table != nil {
+		if _, ok := v.table[member]; !ok {
+			return false
+		}
+		delete(v.table, member)
+		return true
+	}
+	for i, m := range v.small {
+		if m == member {
+			v.small = append(v.small[:i], v.small[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the members in no particular order.
+func (v *setValue) members() []string {
+	if v.table == nil {
+		return v.small
+	}
+	members := make([]string, 0, len(v.table))
+	for m := range v.table {
+		members = append(members, m)
+	}
+	return members
+}
+
+// SAdd adds members to the set at key and returns how many were new.
+func (r *InMemoryRepository) SAdd(key string, members ...string) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	var set *setValue
+	if v, ok := r.mutableLocked(s, key); ok {
+		var err error
+		if set, err = typed[*setValue](v); err != nil {
+			return 0, err
+		}
+	} else {
+		set = newSetValue()
+		s.store[key] = set
+	}
+
+	added := 0
+	for _, m := range members {
+		if set.add(m) {
+			r.link(m, key)
+			added++
+		}
+	}
+	if added > 0 {
+		r.propagateValues(members, "SADD", key)
+		r.modified(s, NotifySet, "sadd", key)
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key and returns how many were removed.
+// The key is deleted once the set is empty.
+func (r *InMemoryRepository) SRem(key string, members ...string) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	v, ok := r.mutableLocked(s, key)
+	if !ok {
+		return 0, nil
+	}
+	set, err := typed[*setValue](v)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, m := range members {
+		if set.remove(m) {
+			r.unlink(m, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		r.propagateValues(members, "SREM", key)
+		r.modified(s, NotifySet, "srem", key)
+	}
+	if set.len() == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return removed, nil
+}
+
+// SMembers returns all members of the set at key.
+func (r *InMemoryRepository) SMembers(key string) ([]string, error) {
+	var members []string
+	err := r.view(key, func(v value) error {
+		set, err := typed[*setValue](v)
+		if err != nil {
+			return err
+		}
+		members = append([]string(nil), set.members()...)
+		return nil
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return []string{}, nil
+	}
+	return members, err
+}
+
+// SIsMember reports whether member belongs to the set at key.
+func (r *InMemoryRepository) SIsMember(key, member string) (bool, error) {
+	var found bool
+	err := r.view(key, func(v value) error {
+		set, err := typed[*setValue](v)
+		if err != nil {
+			return err
+		}
+		found = set.has(member)
+		return nil
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return found, err
+}
+
+// SCard returns the number of members in the set at key.
+func (r *InMemoryRepository) SCard(key string) (int, error) {
+	var n int
+	err := r.view(key, func(v value) error {
+		set, err := typed[*setValue](v)
+		if err != nil {
+			return err
+		}
+		n = set.len()
+		return nil
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
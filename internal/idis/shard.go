@@ -0,0 +1,116 @@
+package idis
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultShards is the number of keyspace shards used by NewInMemoryRepository.
+const DefaultShards = 64
+
+// shard is an independently locked slice of the keyspace.
+type shard struct {
+	mu     sync.RWMutex
+	store  map[string]value
+	expiry map[string]time.Time
+	meta   map[string]*keyMeta // size and access of every key, see memory.go
+
+	// versions holds the version of keys modified since the shard was last
+	// reset; other keys, present or not, are at epoch. See version.go.
+	versions map[string]uint64
+	epoch    uint64
+
+	// snapshots being written that share values with the shard, see
+	// mutableLocked.
+	snapshots []*keyspaceSnapshot
+}
+
+func newShard() *shard {
+	return &shard{
+		store:    make(map[string]value),
+		expiry:   make(map[string]time.Time),
+		meta:     make(map[string]*keyMeta),
+		versions: make(map[string]uint64),
+	}
+}
+
+// indexShard is an independently locked slice of the reverse lookup,
+// mapping a value to the keys that hold it.
+type indexShard struct {
+	mu   sync.RWMutex
+	keys map[string][]string
+}
+
+func newIndexShard() *indexShard {
+	return &indexShard{keys: make(map[string][]string)}
+}
+
+// fnv32 is the 32-bit FNV-1a hash, inlined to avoid allocating a hash.Hash per call.
+func fnv32(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+// shardFor returns the shard owning key.
+func (r *InMemoryRepository) shardFor(key string) *shard {
+	return r.shards[fnv32(key)%uint32(len(r.shards))]
+}
+
+// indexFor returns the reverse lookup shard owning value.
+func (r *InMemoryRepository) indexFor(value string) *indexShard {
+	return r.index[fnv32(value)%uint32(len(r.index))]
+}
+
+// link records that key holds value in the reverse lookup.
+//
+// Lock ordering: a key shard lock may be held while taking an index shard
+// lock, never the other way round.
+func (r *InMemoryRepository) link(value, key string) {
+	ix := r.indexFor(value)
+	ix.mu.Lock()
+	ix.keys[value] = append(ix.keys[value], key)
+	ix.mu.Unlock()
+}
+
+// unlink removes one occurrence of key from the keys holding value.
+func (r *InMemoryRepository) unlink(value, key string) {
+	ix := r.indexFor(value)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	keys := ix.keys[value]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(ix.keys, value)
+	} else {
+		ix.keys[value] = keys
+	}
+}
+
+// lockAll write-locks every key and index shard, always in the same order.
+func (r *InMemoryRepository) lockAll() {
+	for _, s := range r.shards {
+		s.mu.Lock()
+	}
+	for _, ix := range r.index {
+		ix.mu.Lock()
+	}
+}
+
+func (r *InMemoryRepository) unlockAll() {
+	for _, ix := range r.index {
+		ix.mu.Unlock()
+	}
+	for _, s := range r.shards {
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,60 @@
+package idis
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+const benchKeys = 10000
+
+// benchShards compares a single shard, which reproduces a global lock, with
+// the default. Run with -cpu 1,2,4,8 to see how each scales:
+//
+//	go test ./internal/idis -run '^$' -bench . -cpu 1,2,4,8
+var benchShards = []int{1, DefaultShards}
+
+// seededRepository returns a repository split into shards holding
+// benchKeys keys, and their names.
+func seededRepository(shards int) (*InMemoryRepository, []string) {
+	r := NewShardedRepository(shards)
+	names := make([]string, benchKeys)
+	for i := range names {
+		names[i] = "key:" + strconv.Itoa(i)
+		r.Set(names[i], "seed")
+	}
+	return r, names
+}
+
+// benchmarkMixed runs a workload where setRatio of the operations replace a
+// key and the others read one, from GOMAXPROCS goroutines.
+func benchmarkMixed(b *testing.B, setRatio float64) {
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			r, names := seededRepository(shards)
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					key := names[rng.Intn(len(names))]
+					if rng.Float64() < setRatio {
+						// Replace the value so lists do not grow for the whole run
+						r.Delete(key)
+						r.Set(key, strconv.Itoa(rng.Int()))
+					} else {
+						r.Get(key)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) { benchmarkMixed(b, 0) }
+
+func BenchmarkSetGet(b *testing.B) { benchmarkMixed(b, 0.2) }
+
+func BenchmarkSet(b *testing.B) { benchmarkMixed(b, 1) }
@@ -0,0 +1,294 @@
+package idis
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// refZSet is the reference the skiplist is checked against: the members
+// sorted by (score, member).
+type refZSet []ScoredMember
+
+func (ref refZSet) index(member string) int {
+	for i, m := range ref {
+		if m.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ref refZSet) set(member string, score float64) refZSet {
+	if i := ref.index(member); i >= 0 {
+		ref = append(ref[:i], ref[i+1:]...)
+	}
+	ref = append(ref, ScoredMember{Member: member, Score: score})
+	sort.Slice(ref, func(i, j int) bool {
+		if ref[i].Score != ref[j].Score {
+			return ref[i].Score < ref[j].Score
+		}
+		return ref[i].Member < ref[j].Member
+	})
+	return ref
+}
+
+func (ref refZSet) remove(member string) refZSet {
+	if i := ref.index(member); i >= 0 {
+		ref = append(ref[:i], ref[i+1:]...)
+	}
+	return ref
+}
+
+// inRange returns the indexes of the first and last members of ref within
+// [min, max], or -1, -1 if there are none.
+func (ref refZSet) inRange(min, max ScoreBound) (first, last int) {
+	first, last = -1, -1
+	for i, m := range ref {
+		if min.aboveMin(m.Score) && max.belowMax(m.Score) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return first, last
+}
+
+// checkSkiplist verifies the links, spans, ranks and length of z.zsl against
+// ref.
+func checkSkiplist(t *testing.T, z *zsetValue, ref refZSet) {
+	t.Helper()
+	zsl := z.zsl
+	if zsl.length != len(ref) || len(z.dict) != len(ref) {
+		t.Fatalf("length = %d, dict has %d, want %d", zsl.length, len(z.dict), len(ref))
+	}
+
+	var forward []ScoredMember
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		forward = append(forward, ScoredMember{Member: x.member, Score: x.score})
+	}
+	if len(ref) > 0 && !reflect.DeepEqual(forward, []ScoredMember(ref)) {
+		t.Fatalf("forward walk = %v, want %v", forward, ref)
+	}
+	i := len(ref) - 1
+	for x := zsl.tail; x != nil; x = x.backward {
+		if i < 0 || x.member != ref[i].Member {
+			t.Fatalf("backward walk diverges at index %d", i)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("backward walk stopped at index %d", i)
+	}
+
+	// Every level must skip as many nodes as its span says
+	for level := 0; level < zsl.level; level++ {
+		rank := 0
+		for x := zsl.header; x.level[level].forward != nil; x = x.level[level].forward {
+			rank += x.level[level].span
+			next := x.level[level].forward
+			if rank > len(ref) || ref[rank-1].Member != next.member {
+				t.Fatalf("level %d: span leads to rank %d, which is not %q", level, rank, next.member)
+			}
+		}
+	}
+
+	for i, m := range ref {
+		if got := zsl.rank(m.Score, m.Member); got != i+1 {
+			t.Fatalf("rank(%v, %q) = %d, want %d", m.Score, m.Member, got, i+1)
+		}
+		if x := zsl.byRank(i + 1); x == nil || x.member != m.Member {
+			t.Fatalf("byRank(%d) = %v, want %q", i+1, x, m.Member)
+		}
+	}
+	if x := zsl.byRank(len(ref) + 1); x != nil {
+		t.Fatalf("byRank(%d) = %q, want nil", len(ref)+1, x.member)
+	}
+	if got := zsl.rank(1000, "missing"); got != 0 {
+		t.Fatalf("rank of a missing member = %d, want 0", got)
+	}
+}
+
+func TestSkiplistAgainstSortedSlice(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := newZSetValue()
+	var ref refZSet
+	for op := 0; op < 2000; op++ {
+		// Few distinct scores, so many members share one and are ordered
+		// by name
+		member := "m" + strconv.Itoa(rng.Intn(200))
+		score := float64(rng.Intn(20))
+		if rng.Intn(3) == 0 {
+			if got, want := z.remove(member), ref.index(member) >= 0; got != want {
+				t.Fatalf("remove(%q) = %v, want %v", member, got, want)
+			}
+			ref = ref.remove(member)
+		} else {
+			z.set(member, score)
+			ref = ref.set(member, score)
+		}
+		if op%50 == 0 {
+			checkSkiplist(t, z, ref)
+		}
+	}
+	checkSkiplist(t, z, ref)
+}
+
+func TestSkiplistScoreRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	z := newZSetValue()
+	var ref refZSet
+	for i := 0; i < 300; i++ {
+		member := "m" + strconv.Itoa(i)
+		score := float64(rng.Intn(30))
+		z.set(member, score)
+		ref = ref.set(member, score)
+	}
+
+	for i := 0; i < 1000; i++ {
+		min := ScoreBound{Value: float64(rng.Intn(34) - 2), Exclusive: rng.Intn(2) == 0}
+		max := ScoreBound{Value: float64(rng.Intn(34) - 2), Exclusive: rng.Intn(2) == 0}
+		first, last := ref.inRange(min, max)
+
+		gotFirst, gotLast := z.zsl.firstInRange(min, max), z.zsl.lastInRange(min, max)
+		if first < 0 {
+			if gotFirst != nil || gotLast != nil {
+				t.Fatalf("range %v..%v: got %v..%v, want nothing", min, max, gotFirst, gotLast)
+			}
+			continue
+		}
+		if gotFirst == nil || gotFirst.member != ref[first].Member {
+			t.Fatalf("firstInRange(%v, %v) = %v, want %q", min, max, gotFirst, ref[first].Member)
+		}
+		if gotLast == nil || gotLast.member != ref[last].Member {
+			t.Fatalf("lastInRange(%v, %v) = %v, want %q", min, max, gotLast, ref[last].Member)
+		}
+	}
+
+	// Infinite bounds cover everything
+	all := func(s string) ScoreBound {
+		b, err := ParseScoreBound(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	if x := z.zsl.firstInRange(all("-inf"), all("+inf")); x != z.zsl.header.level[0].forward {
+		t.Fatalf("firstInRange(-inf, +inf) is not the first node")
+	}
+	if x := z.zsl.lastInRange(all("-inf"), all("+inf")); x != z.zsl.tail {
+		t.Fatalf("lastInRange(-inf, +inf) is not the tail")
+	}
+}
+
+func TestSkiplistLexRange(t *testing.T) {
+	z := newZSetValue()
+	var ref refZSet
+	for _, member := range []string{"e", "a", "c", "g", "b", "f", "d"} {
+		z.set(member, 0)
+		ref = ref.set(member, 0)
+	}
+	checkSkiplist(t, z, ref)
+
+	tests := []struct {
+		min, max    string
+		first, last string // empty for no match
+	}{
+		{"-", "+", "a", "g"},
+		{"[b", "[d", "b", "d"},
+		{"(b", "(d", "c", "c"},
+		{"[bb", "(e", "c", "d"},
+		{"(g", "+", "", ""},
+		{"-", "(a", "", ""},
+		{"[d", "[c", "", ""},
+	}
+	for _, tt := range tests {
+		min, err := ParseLexBound(tt.min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		max, err := ParseLexBound(tt.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, last := z.zsl.firstInLexRange(min, max), z.zsl.lastInLexRange(min, max)
+		if tt.first == "" {
+			if first != nil || last != nil {
+				t.Errorf("lex range %s..%s: got a match, want none", tt.min, tt.max)
+			}
+			continue
+		}
+		if first == nil || first.member != tt.first || last == nil || last.member != tt.last {
+			t.Errorf("lex range %s..%s: got %v..%v, want %s..%s", tt.min, tt.max, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestSkiplistPopEnds(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	z := newZSetValue()
+	var ref refZSet
+	for i := 0; i < 200; i++ {
+		member := "m" + strconv.Itoa(i)
+		score := float64(rng.Intn(10))
+		z.set(member, score)
+		ref = ref.set(member, score)
+	}
+
+	// Pop alternately from both ends, as ZPOPMIN and ZPOPMAX do
+	for len(ref) > 0 {
+		var x *skiplistNode
+		var want ScoredMember
+		if len(ref)%2 == 0 {
+			x, want = z.zsl.header.level[0].forward, ref[0]
+			ref = ref[1:]
+		} else {
+			x, want = z.zsl.tail, ref[len(ref)-1]
+			ref = ref[:len(ref)-1]
+		}
+		if x.member != want.Member || x.score != want.Score {
+			t.Fatalf("popped %q (%v), want %q (%v)", x.member, x.score, want.Member, want.Score)
+		}
+		z.remove(x.member)
+		checkSkiplist(t, z, ref)
+	}
+	if z.zsl.tail != nil || z.zsl.header.level[0].forward != nil || z.zsl.level != 1 {
+		t.Fatalf("emptied skiplist still has nodes or levels")
+	}
+}
+
+func TestZPopDuplicateScores(t *testing.T) {
+	r := NewShardedRepository(1)
+	members := []ScoredMember{{"c", 1}, {"a", 1}, {"b", 1}, {"z", 0}, {"y", 2}}
+	if _, err := r.ZAdd("z", ZAddOptions{}, members...); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.ZPop("z", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ScoredMember{{"z", 0}, {"a", 1}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ZPop min = %v, want %v", got, want)
+	}
+	got, err = r.ZPop("z", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ScoredMember{{"y", 2}, {"c", 1}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ZPop max = %v, want %v", got, want)
+	}
+	got, err = r.ZPop("z", 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ScoredMember{{"b", 1}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ZPop rest = %v, want %v", got, want)
+	}
+	if r.Exists("z") {
+		t.Fatalf("key still exists once its last member is popped")
+	}
+}
@@ -0,0 +1,498 @@
+package idis
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Binary snapshots are a compact alternative to the JSON dump. A file is
+//
+//	"IDISSNAP" version:uint8 flags:uint8 body crc:uint64
+//
+// where body, DEFLATE-compressed when flags has snapshotCompressed set, is
+// a sequence of records, each an opcode byte followed by the uvarint length
+// of its payload and the payload, and ends with a snapshotEOF opcode. crc is
+// the big-endian CRC-64 (ECMA) of every byte before it.
+//
+// A key record holds the key, a type byte, the deadline in Unix milliseconds
+// (0 for none) and the value encoded for its type. Strings are a uvarint
+// length followed by the bytes, integers are varints and scores are the
+// IEEE 754 bits of the float64, big-endian. The reverse lookup is not
+// stored; it is rebuilt on load.
+
+// SnapshotFormat selects how DumpToFile writes a snapshot.
+type SnapshotFormat int32
+
+const (
+	// SnapshotJSON is the JSON dump.
+	SnapshotJSON SnapshotFormat = iota
+	// SnapshotBinary is the binary snapshot format.
+	SnapshotBinary
+)
+
+// ParseSnapshotFormat parses "json" or "binary".
+func ParseSnapshotFormat(s string) (SnapshotFormat, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return SnapshotJSON, nil
+	case "binary":
+		return SnapshotBinary, nil
+	}
+	return 0, fmt.Errorf("invalid snapshot format '%s', expected json or binary", s)
+}
+
+func (f SnapshotFormat) String() string {
+	if f == SnapshotBinary {
+		return "binary"
+	}
+	return "json"
+}
+
+const (
+	snapshotMagic   = "IDISSNAP"
+	snapshotVersion = 1
+
+	// snapshotCompressed is the flag of a compressed body.
+	snapshotCompressed = 1 << 0
+
+	// Record opcodes
+	snapshotKey = 0x01
+	snapshotEOF = 0xff
+)
+
+// Type bytes of key records
+const (
+	snapshotString byte = iota
+	snapshotList
+	snapshotSet
+	snapshotHash
+	snapshotZSet
+	snapshotStream
+)
+
+var snapshotCRC = crc64.MakeTable(crc64.ECMA)
+
+// SetSnapshotFormat sets the format of snapshots written to files whose
+// extension does not choose one.
+func (r *InMemoryRepository) SetSnapshotFormat(format SnapshotFormat) {
+	r.snapshotFormat.Store(int32(format))
+}
+
+// SnapshotFormat returns the default snapshot format.
+func (r *InMemoryRepository) SnapshotFormat() SnapshotFormat {
+	return SnapshotFormat(r.snapshotFormat.Load())
+}
+
+// SetSnapshotCompression sets whether binary snapshots are compressed.
+func (r *InMemoryRepository) SetSnapshotCompression(compress bool) {
+	r.snapshotCompression.Store(compress)
+}
+
+// SnapshotCompression reports whether binary snapshots are compressed.
+func (r *InMemoryRepository) SnapshotCompression() bool {
+	return r.snapshotCompression.Load()
+}
+
+// snapshotFormatFor returns the format of a snapshot written to filename:
+// ".json" files are JSON, ".snap" files binary and others use the default.
+func (r *InMemoryRepository) snapshotFormatFor(filename string) SnapshotFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return SnapshotJSON
+	case ".snap":
+		return SnapshotBinary
+	}
+	return r.SnapshotFormat()
+}
+
+// isBinarySnapshot reports whether data starts like a binary snapshot.
+func isBinarySnapshot(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(snapshotMagic))
+}
+
+// writeBinarySnapshot writes store and expiry to w as a binary snapshot,
+// counting the keys written in progress.
+func writeBinarySnapshot(w io.Writer, store map[string]value, expiry map[string]time.Time, compress bool, progress *atomic.Int64) error {
+	crc := crc64.New(snapshotCRC)
+	out := io.MultiWriter(w, crc)
+
+	var flags byte
+	if compress {
+		flags |= snapshotCompressed
+	}
+	if _, err := io.WriteString(out, snapshotMagic); err != nil {
+		return err
+	}
+	if _, err := out.Write([]byte{snapshotVersion, flags}); err != nil {
+		return err
+	}
+
+	body := out
+	var fw *flate.Writer
+	var err error
+	if compress {
+		if fw, err = flate.NewWriter(out, flate.BestSpeed); err != nil {
+			return err
+		}
+		body = fw
+	}
+
+	var payload, header []byte
+	writeRecord := func(opcode byte) error {
+		header = append(header[:0], opcode)
+		header = binary.AppendUvarint(header, uint64(len(payload)))
+		if _, err := body.Write(header); err != nil {
+			return err
+		}
+		_, err := body.Write(payload)
+		return err
+	}
+	for key, v := range store {
+		var ms int64
+		if expiration, ok := expiry[key]; ok {
+			ms = expiration.UnixMilli()
+		}
+		if payload, err = appendSnapshotKey(payload[:0], key, v, ms); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := writeRecord(snapshotKey); err != nil {
+			return err
+		}
+		progress.Add(1)
+	}
+	payload = payload[:0]
+	if err := writeRecord(snapshotEOF); err != nil {
+		return err
+	}
+	if fw != nil {
+		if err := fw.Close(); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, binary.BigEndian, crc.Sum64())
+}
+
+func appendSnapshotString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendSnapshotStrings(buf []byte, items []string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(items)))
+	for _, s := range items {
+		buf = appendSnapshotString(buf, s)
+	}
+	return buf
+}
+
+func appendSnapshotID(buf []byte, id StreamID) []byte {
+	buf = binary.AppendUvarint(buf, id.Ms)
+	return binary.AppendUvarint(buf, id.Seq)
+}
+
+// appendSnapshotKey appends the payload of the key record of key.
+func appendSnapshotKey(buf []byte, key string, v value, expiration int64) ([]byte, error) {
+	buf = appendSnapshotString(buf, key)
+	switch v := v.(type) {
+	case *stringValue:
+		buf = append(buf, snapshotString)
+		buf = binary.AppendVarint(buf, expiration)
+		buf = appendSnapshotString(buf, v.s)
+	case *listValue:
+		buf = append(buf, snapshotList)
+		buf = binary.AppendVarint(buf, expiration)
+		buf = appendSnapshotStrings(buf, v.items)
+	case *setValue:
+		buf = append(buf, snapshotSet)
+		buf = binary.AppendVarint(buf, expiration)
+		buf = appendSnapshotStrings(buf, v.members())
+	case *hashValue:
+		buf = append(buf, snapshotHash)
+		buf = binary.AppendVarint(buf, expiration)
+		entries := v.entries()
+		buf = binary.AppendUvarint(buf, uint64(len(entries)))
+		for _, fv := range entries {
+			buf = appendSnapshotString(buf, fv.Field)
+			buf = appendSnapshotString(buf, fv.Value)
+		}
+	case *zsetValue:
+		buf = append(buf, snapshotZSet)
+		buf = binary.AppendVarint(buf, expiration)
+		buf = binary.AppendUvarint(buf, uint64(v.zsl.length))
+		for x := v.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+			buf = appendSnapshotString(buf, x.member)
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(x.score))
+		}
+	case *streamValue:
+		buf = append(buf, snapshotStream)
+		buf = binary.AppendVarint(buf, expiration)
+		buf = appendSnapshotStream(buf, v)
+	default:
+		return nil, fmt.Errorf("cannot encode value of type %s", v.Type())
+	}
+	return buf, nil
+}
+
+func appendSnapshotStream(buf []byte, st *streamValue) []byte {
+	buf = appendSnapshotID(buf, st.lastID)
+	buf = binary.AppendUvarint(buf, uint64(len(st.entries)))
+	for _, e := range st.entries {
+		buf = appendSnapshotID(buf, e.ID)
+		buf = appendSnapshotStrings(buf, e.Fields)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(st.groups)))
+	for name, g := range st.groups {
+		buf = appendSnapshotString(buf, name)
+		buf = appendSnapshotID(buf, g.lastDelivered)
+		buf = binary.AppendUvarint(buf, uint64(len(g.consumers)))
+		for consumer, seen := range g.consumers {
+			buf = appendSnapshotString(buf, consumer)
+			buf = binary.AppendVarint(buf, seen.UnixMilli())
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(g.pending)))
+		for _, id := range g.pendingIDs("") {
+			p := g.pending[id]
+			buf = appendSnapshotID(buf, id)
+			buf = appendSnapshotString(buf, p.consumer)
+			buf = binary.AppendVarint(buf, p.deliveryTime.UnixMilli())
+			buf = binary.AppendUvarint(buf, uint64(p.deliveryCount))
+		}
+	}
+	return buf
+}
+
+// errSnapshotCorrupt is returned for a binary snapshot that cannot be decoded.
+var errSnapshotCorrupt = errors.New("corrupt snapshot")
+
+// readBinarySnapshot decodes a binary snapshot after checking its CRC.
+func readBinarySnapshot(data []byte) (map[string]value, map[string]time.Time, error) {
+	headerLen := len(snapshotMagic) + 2
+	if len(data) < headerLen+8 {
+		return nil, nil, fmt.Errorf("%w: file too short", errSnapshotCorrupt)
+	}
+	sum := binary.BigEndian.Uint64(data[len(data)-8:])
+	data = data[:len(data)-8]
+	if crc64.Checksum(data, snapshotCRC) != sum {
+		return nil, nil, fmt.Errorf("%w: checksum mismatch", errSnapshotCorrupt)
+	}
+	version, flags := data[len(snapshotMagic)], data[len(snapshotMagic)+1]
+	if version != snapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var body io.Reader = bytes.NewReader(data[headerLen:])
+	if flags&snapshotCompressed != 0 {
+		fr := flate.NewReader(body)
+		defer fr.Close()
+		body = fr
+	}
+	br := bufio.NewReader(body)
+
+	store := make(map[string]value)
+	expiry := make(map[string]time.Time)
+	for {
+		opcode, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, err)
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, err)
+		}
+		if opcode == snapshotEOF {
+			return store, expiry, nil
+		}
+		if opcode != snapshotKey {
+			return nil, nil, fmt.Errorf("%w: unknown record type 0x%02x", errSnapshotCorrupt, opcode)
+		}
+		if n > maxRecordArg {
+			return nil, nil, fmt.Errorf("%w: record of %d bytes", errSnapshotCorrupt, n)
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, err)
+		}
+
+		d := &snapshotDecoder{data: payload}
+		key, v, ms := d.key()
+		if d.err == nil && len(d.data) > 0 {
+			d.err = errors.New("trailing bytes in record")
+		}
+		if d.err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errSnapshotCorrupt, d.err)
+		}
+		store[key] = v
+		if ms != 0 {
+			expiry[key] = time.UnixMilli(ms)
+		}
+	}
+}
+
+// snapshotDecoder decodes the payload of a record. The first error is kept
+// in err and makes every later call return zero values.
+type snapshotDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *snapshotDecoder) fail(msg string) {
+	if d.err == nil {
+		d.err = errors.New(msg)
+	}
+	d.data = nil
+}
+
+func (d *snapshotDecoder) byte() byte {
+	if len(d.data) < 1 {
+		d.fail("unexpected end of record")
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *snapshotDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("invalid length")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *snapshotDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("invalid integer")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// count reads the number of elements of a collection. Every element takes
+// at least a byte, so a count larger than what is left is corrupt.
+func (d *snapshotDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("invalid element count")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *snapshotDecoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("string longer than record")
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *snapshotDecoder) strings() []string {
+	items := make([]string, d.count())
+	for i := range items {
+		items[i] = d.string()
+	}
+	return items
+}
+
+func (d *snapshotDecoder) float() float64 {
+	if len(d.data) < 8 {
+		d.fail("unexpected end of record")
+		return 0
+	}
+	f := math.Float64frombits(binary.BigEndian.Uint64(d.data))
+	d.data = d.data[8:]
+	return f
+}
+
+func (d *snapshotDecoder) id() StreamID {
+	return StreamID{Ms: d.uvarint(), Seq: d.uvarint()}
+}
+
+// key decodes a key record into the key, its value and its deadline.
+func (d *snapshotDecoder) key() (string, value, int64) {
+	key := d.string()
+	typ := d.byte()
+	expiration := d.varint()
+
+	var v value
+	switch typ {
+	case snapshotString:
+		v = &stringValue{s: d.string()}
+	case snapshotList:
+		v = &listValue{items: d.strings()}
+	case snapshotSet:
+		set := newSetValue()
+		for _, m := range d.strings() {
+			set.add(m)
+		}
+		v = set
+	case snapshotHash:
+		h := newHashValue()
+		for n := d.count(); n > 0; n-- {
+			h.set(d.string(), d.string())
+		}
+		v = h
+	case snapshotZSet:
+		z := newZSetValue()
+		for n := d.count(); n > 0; n-- {
+			member := d.string()
+			score := d.float()
+			if math.IsNaN(score) {
+				d.fail("NaN score")
+			}
+			z.set(member, score)
+		}
+		v = z
+	case snapshotStream:
+		v = d.stream()
+	default:
+		d.fail(fmt.Sprintf("unknown value type %d", typ))
+	}
+	return key, v, expiration
+}
+
+func (d *snapshotDecoder) stream() *streamValue {
+	st := newStreamValue()
+	st.lastID = d.id()
+	entries := d.count()
+	st.entries = make([]StreamEntry, 0, entries)
+	for ; entries > 0; entries-- {
+		st.entries = append(st.entries, StreamEntry{ID: d.id(), Fields: d.strings()})
+	}
+	for groups := d.count(); groups > 0; groups-- {
+		name := d.string()
+		g := newConsumerGroup(d.id())
+		for n := d.count(); n > 0; n-- {
+			consumer := d.string()
+			g.consumers[consumer] = time.UnixMilli(d.varint())
+		}
+		for n := d.count(); n > 0; n-- {
+			id := d.id()
+			p := &pendingEntry{consumer: d.string(), deliveryTime: time.UnixMilli(d.varint())}
+			p.deliveryCount = int(d.uvarint())
+			g.pending[id] = p
+		}
+		st.groups[name] = g
+	}
+	return st
+}
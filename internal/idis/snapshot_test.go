@@ -0,0 +1,305 @@
+package idis
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seededTypes returns a repository holding a key of every type, in both
+// encodings where there are two, some with deadlines.
+func seededTypes(t *testing.T) *InMemoryRepository {
+	t.Helper()
+	r := NewShardedRepository(4)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(r.SetString("str", "hello"))
+	must(r.SetString("empty", ""))
+	must(r.Set("list", "a", "b\r\nc", ""))
+	_, err := r.SAdd("smallset", "m1", "m2")
+	must(err)
+	var fields []FieldValue
+	for i := 0; i < 300; i++ {
+		n := strconv.Itoa(i)
+		_, err = r.SAdd("set", "m"+n)
+		must(err)
+		fields = append(fields, FieldValue{Field: "f" + n, Value: "v" + n})
+	}
+	_, err = r.HSet("smallhash", FieldValue{Field: "f", Value: "v"})
+	must(err)
+	_, err = r.HSet("hash", fields...)
+	must(err)
+	_, err = r.ZAdd("zset", ZAddOptions{},
+		ScoredMember{Member: "a", Score: 1.5},
+		ScoredMember{Member: "b", Score: 1.5},
+		ScoredMember{Member: "min", Score: math.Inf(-1)},
+		ScoredMember{Member: "max", Score: math.Inf(1)})
+	must(err)
+	for i := 0; i < 3; i++ {
+		_, _, err = r.XAdd("stream", "*", []string{"n", strconv.Itoa(i)}, false, NoTrim)
+		must(err)
+	}
+	must(r.XGroupCreate("stream", "group", "0", false))
+	_, err = r.XReadGroup(context.Background(), "group", "consumer", []string{"stream"}, []string{">"}, 2, false, false)
+	must(err)
+
+	for _, key := range []string{"str", "list", "set", "hash", "zset", "stream"} {
+		must(r.Expire(key, time.Hour))
+	}
+	return r
+}
+
+// sameValue reports whether a and b hold the same data.
+func sameValue(t *testing.T, a, b value) bool {
+	t.Helper()
+	if a.Type() != b.Type() || a.Encoding() != b.Encoding() {
+		return false
+	}
+	if as, ok := a.(*setValue); ok {
+		// Set members come out in no particular order
+		am, bm := as.members(), b.(*setValue).members()
+		sort.Strings(am)
+		sort.Strings(bm)
+		return reflect.DeepEqual(am, bm)
+	}
+	ad, err := encodeValue(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bd, err := encodeValue(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(ad, bd)
+}
+
+// checkSnapshot compares a decoded snapshot with the keyspace it was taken
+// from. Deadlines are kept to the millisecond.
+func checkSnapshot(t *testing.T, want *keyspaceSnapshot, store map[string]value, expiry map[string]time.Time) {
+	t.Helper()
+	if len(store) != len(want.store) {
+		t.Errorf("decoded %d keys, want %d", len(store), len(want.store))
+	}
+	for key, v := range want.store {
+		got, ok := store[key]
+		if !ok {
+			t.Errorf("%s is missing", key)
+			continue
+		}
+		if !sameValue(t, got, v) {
+			t.Errorf("%s decoded as %v, want %v", key, got, v)
+		}
+		if got, want := expiry[key].UnixMilli(), want.expiry[key].UnixMilli(); got != want {
+			t.Errorf("%s expires at %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestBinarySnapshotRoundTrip(t *testing.T) {
+	r := seededTypes(t)
+	snap := r.snapshot(nil)
+	defer r.releaseSnapshot(snap)
+	for _, compress := range []bool{false, true} {
+		t.Run("compress="+strconv.FormatBool(compress), func(t *testing.T) {
+			var buf bytes.Buffer
+			var progress atomic.Int64
+			if err := writeBinarySnapshot(&buf, snap.store, snap.expiry, compress, &progress); err != nil {
+				t.Fatal(err)
+			}
+			if got := progress.Load(); got != int64(len(snap.store)) {
+				t.Errorf("progress = %d, want %d", got, len(snap.store))
+			}
+			if !isBinarySnapshot(buf.Bytes()) {
+				t.Fatalf("isBinarySnapshot() = false")
+			}
+			store, expiry, err := readBinarySnapshot(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSnapshot(t, snap, store, expiry)
+		})
+	}
+}
+
+func TestDumpAndLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		compress bool
+	}{
+		{"json", "dump.json", false},
+		{"binary", "dump.snap", false},
+		{"compressed", "dump.snap", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := seededTypes(t)
+			r.SetSnapshotCompression(tt.compress)
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := r.DumpToFile(path); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewShardedRepository(8)
+			if err := loaded.LoadFromDump(path); err != nil {
+				t.Fatal(err)
+			}
+			want := r.snapshot(nil)
+			defer r.releaseSnapshot(want)
+			got := loaded.snapshot(nil)
+			defer loaded.releaseSnapshot(got)
+			checkSnapshot(t, want, got.store, got.expiry)
+
+			// The reverse lookup is rebuilt for the new sharding
+			if keys, _ := loaded.GetKeyFromValue("b\r\nc"); !reflect.DeepEqual(keys, []string{"list"}) {
+				t.Errorf("GetKeyFromValue() = %v, want [list]", keys)
+			}
+		})
+	}
+}
+
+// withCRC appends the checksum of data, as a valid snapshot ends.
+func withCRC(data []byte) []byte {
+	return binary.BigEndian.AppendUint64(data, crc64.Checksum(data, snapshotCRC))
+}
+
+// header returns the start of a snapshot with the given flags.
+func header(flags byte) []byte {
+	return append([]byte(snapshotMagic), snapshotVersion, flags)
+}
+
+func TestReadBinarySnapshotCorrupt(t *testing.T) {
+	r := seededTypes(t)
+	snap := r.snapshot(nil)
+	defer r.releaseSnapshot(snap)
+	encode := func(compress bool) []byte {
+		var buf bytes.Buffer
+		if err := writeBinarySnapshot(&buf, snap.store, snap.expiry, compress, new(atomic.Int64)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	plain, compressed := encode(false), encode(true)
+	flipped := append([]byte(nil), plain...)
+	flipped[len(flipped)/2] ^= 0xff
+	// The body cut short, with a checksum that matches so that decoding
+	// gets to find it out
+	body := plain[:len(plain)-8]
+	compressedBody := compressed[:len(compressed)-8]
+
+	tests := []struct {
+		name    string
+		data    []byte
+		corrupt bool // whether errSnapshotCorrupt is expected
+	}{
+		{"checksum mismatch", flipped, true},
+		{"checksum of a truncated file", plain[:len(plain)-20], true},
+		{"shorter than a header", plain[:10], true},
+		{"header only", withCRC(header(0)), true},
+		{"truncated record", withCRC(body[:len(body)/2]), true},
+		{"missing end of file", withCRC(body[:len(body)-2]), true},
+		{"unknown record type", withCRC(append(header(0), 0x7f, 0)), true},
+		{"oversized record", withCRC(binary.AppendUvarint(append(header(0), snapshotKey), maxRecordArg+1)), true},
+		{"malformed record", withCRC(append(header(0), snapshotKey, 1, 0, snapshotEOF, 0)), true},
+		{"invalid compressed block", withCRC(append(header(snapshotCompressed), 0x07)), true},
+		{"truncated compressed stream", withCRC(compressedBody[:len(compressedBody)/2]), true},
+		{"uncompressed body flagged as compressed", withCRC(append(header(snapshotCompressed), body[len(header(0)):]...)), true},
+		{"unknown version", withCRC(append([]byte(snapshotMagic), snapshotVersion+1, 0, snapshotEOF, 0)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _, err := readBinarySnapshot(tt.data)
+			if err == nil {
+				t.Fatalf("readBinarySnapshot() decoded %d keys, want an error", len(store))
+			}
+			if got := errors.Is(err, errSnapshotCorrupt); got != tt.corrupt {
+				t.Errorf("readBinarySnapshot() error = %v, corrupt = %v, want %v", err, got, tt.corrupt)
+			}
+		})
+	}
+}
+
+func TestLoadCorruptDumpKeepsStore(t *testing.T) {
+	r := seededTypes(t)
+	path := filepath.Join(t.TempDir(), "dump.snap")
+	if err := r.DumpToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewShardedRepository(4)
+	loaded.SetString("kept", "v")
+	if err := loaded.LoadFromDump(path); !errors.Is(err, errSnapshotCorrupt) {
+		t.Fatalf("LoadFromDump() error = %v, want %v", err, errSnapshotCorrupt)
+	}
+	if s, _ := loaded.GetString("kept"); s != "v" {
+		t.Errorf("the store was changed by a failed load")
+	}
+	if loaded.Exists("str") {
+		t.Errorf("keys of a corrupt snapshot were loaded")
+	}
+}
+
+func TestSnapshotCopyOnWrite(t *testing.T) {
+	r := NewShardedRepository(4)
+	r.Set("list", "a")
+	r.SAdd("set", "m1")
+	r.HSet("hash", FieldValue{Field: "f", Value: "v1"})
+
+	snap := r.snapshot(nil)
+	r.Push("list", false, false, "b")
+	r.SAdd("set", "m2")
+	r.HSet("hash", FieldValue{Field: "f", Value: "v2"})
+	r.SetString("new", "v")
+
+	// The snapshot keeps the values as they were when it was taken
+	if got := snap.store["list"].(*listValue).items; !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("snapshot list = %v, want [a]", got)
+	}
+	if got := len(snap.store["set"].(*setValue).members()); got != 1 {
+		t.Errorf("snapshot set has %d members, want 1", got)
+	}
+	if got, _ := snap.store["hash"].(*hashValue).get("f"); got != "v1" {
+		t.Errorf("snapshot hash field = %q, want v1", got)
+	}
+	if _, ok := snap.store["new"]; ok {
+		t.Errorf("a key set after the snapshot is in it")
+	}
+	if values, _ := r.Get("list"); !reflect.DeepEqual(values, []string{"a", "b"}) {
+		t.Errorf("Get(list) = %v, want [a b]", values)
+	}
+
+	// Once released, values are modified in place again
+	r.releaseSnapshot(snap)
+	s := r.shardFor("list")
+	before := s.store["list"]
+	r.Push("list", false, false, "c")
+	if s.store["list"] != before {
+		t.Errorf("list was cloned after the snapshot was released")
+	}
+	if len(s.snapshots) != 0 {
+		t.Errorf("shard still holds %d snapshots", len(s.snapshots))
+	}
+}
@@ -0,0 +1,1055 @@
+package idis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeStream is the type name of streams.
+const TypeStream = "stream"
+
+var (
+	// ErrInvalidStreamID is returned for a malformed stream ID argument.
+	ErrInvalidStreamID = errors.New("Invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall is returned when XADD is given an ID not above the last one.
+	ErrStreamIDTooSmall = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrBusyGroup is returned when creating a consumer group that exists.
+	ErrBusyGroup = &CodedError{Code: "BUSYGROUP", Msg: "Consumer Group name already exists"}
+)
+
+// StreamID identifies a stream entry: a millisecond timestamp plus a
+// sequence number for entries added within the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is the greatest possible stream ID.
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before other.
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+func (id StreamID) isZero() bool { return id.Ms == 0 && id.Seq == 0 }
+
+// next returns the smallest ID greater than id, and false on overflow.
+func (id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// prev returns the greatest ID smaller than id, and false on underflow.
+func (id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// parseStreamID parses "ms-seq", or "ms" with the sequence set to defaultSeq.
+func parseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// ParseStreamID parses a complete stream ID such as "1700000000000-0". A
+// bare millisecond value means sequence 0.
+func ParseStreamID(s string) (StreamID, error) {
+	return parseStreamID(s, 0)
+}
+
+// ParseStreamRangeBound parses an XRANGE bound: "-" and "+" for the smallest
+// and greatest IDs, a leading "(" for an exclusive bound, and a bare
+// millisecond value covering every sequence number of that millisecond.
+func ParseStreamRangeBound(s string, start bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	defaultSeq := uint64(0)
+	if !start {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := parseStreamID(s, defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	var ok bool
+	if start {
+		id, ok = id.next()
+	} else {
+		id, ok = id.prev()
+	}
+	if !ok {
+		return id, errors.New("invalid start or end ID for an exclusive range")
+	}
+	return id, nil
+}
+
+// StreamEntry is a stream entry and its field/value pairs. Fields is nil for
+// an entry that was pending in a consumer group but has since been deleted.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// MarshalJSON writes the ID as a string and the fields as a JSON object.
+func (e StreamEntry) MarshalJSON() ([]byte, error) {
+	var fields map[string]string
+	if e.Fields != nil {
+		fields = make(map[string]string, len(e.Fields)/2)
+		for i := 0; i+1 < len(e.Fields); i += 2 {
+			fields[e.Fields[i]] = e.Fields[i+1]
+		}
+	}
+	return json.Marshal(struct {
+		ID     string            `json:"id"`
+		Fields map[string]string `json:"fields"`
+	}{e.ID.String(), fields})
+}
+
+// StreamRead holds the entries read from one stream by XREAD or XREADGROUP.
+type StreamRead struct {
+	Key     string        `json:"key"`
+	Entries []StreamEntry `json:"entries"`
+}
+
+// StreamTrim describes a MAXLEN or MINID trimming strategy.
+type StreamTrim struct {
+	MaxLen  int64 // Keep at most this many entries; negative disables
+	MinID   StreamID
+	ByMinID bool // Evict entries with an ID lower than MinID
+}
+
+// NoTrim disables trimming.
+var NoTrim = StreamTrim{MaxLen: -1}
+
+// pendingEntry is an entry delivered to a consumer but not yet acknowledged.
+type pendingEntry struct {
+	consumer      string
+	deliveryTime  time.Time
+	deliveryCount int
+}
+
+// consumerGroup tracks what has been delivered to the consumers of a group.
+type consumerGroup struct {
+	lastDelivered StreamID
+	pending       map[StreamID]*pendingEntry
+	consumers     map[string]time.Time // consumer name to last seen time
+}
+
+func newConsumerGroup(lastDelivered StreamID) *consumerGroup {
+	return &consumerGroup{
+		lastDelivered: lastDelivered,
+		pending:       make(map[StreamID]*pendingEntry),
+		consumers:     make(map[string]time.Time),
+	}
+}
+
+// pendingIDs returns the pending IDs in ascending order, optionally only
+// those owned by consumer.
+func (g *consumerGroup) pendingIDs(consumer string) []StreamID {
+	ids := make([]StreamID, 0, len(g.pending))
+	for id, p := range g.pending {
+		if consumer == "" || p.consumer == consumer {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// streamValue is an append-only log of entries ordered by ID, together with
+// its consumer groups.
+type streamValue struct {
+	entries []StreamEntry
+	lastID  StreamID
+	groups  map[string]*consumerGroup
+}
+
+func newStreamValue() *streamValue {
+	return &streamValue{groups: make(map[string]*consumerGroup)}
+}
+
+func (st *streamValue) Type() string { return TypeStream }
+
+func (st *streamValue) Encoding() string { return "stream" }
+
+func (st *streamValue) clone() value {
+	c := &streamValue{
+		entries: append([]StreamEntry(nil), st.entries...),
+		lastID:  st.lastID,
+		groups:  make(map[string]*consumerGroup, len(st.groups)),
+	}
+	for name, g := range st.groups {
+		cg := newConsumerGroup(g.lastDelivered)
+		for id, p := range g.pending {
+			cp := *p
+			cg.pending[id] = &cp
+		}
+		for consumer, seen := range g.consumers {
+			cg.consumers[consumer] = seen
+		}
+		c.groups[name] = cg
+	}
+	return c
+}
+
+// search returns the index of the first entry with an ID not below id.
+func (st *streamValue) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
+
+// lookup returns the entry with the given ID.
+func (st *streamValue) lookup(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// rangeEntries returns up to count entries between start and end inclusive,
+// newest first when rev is set. count <= 0 means no limit.
+func (st *streamValue) rangeEntries(start, end StreamID, count int, rev bool) []StreamEntry {
+	entries := []StreamEntry{}
+	if end.Less(start) {
+		return entries
+	}
+	from, to := st.search(start), st.search(end)
+	if to < len(st.entries) && st.entries[to].ID == end {
+		to++
+	}
+	if rev {
+		for i := to - 1; i >= from && (count <= 0 || len(entries) < count); i-- {
+			entries = append(entries, st.entries[i])
+		}
+		return entries
+	}
+	for i := from; i < to && (count <= 0 || len(entries) < count); i++ {
+		entries = append(entries, st.entries[i])
+	}
+	return entries
+}
+
+// trim evicts entries according to t and returns how many were removed.
+func (st *streamValue) trim(t StreamTrim) int {
+	n := 0
+	if t.ByMinID {
+		n = st.search(t.MinID)
+	} else if t.MaxLen >= 0 && int64(len(st.entries)) > t.MaxLen {
+		n = len(st.entries) - int(t.MaxLen)
+	}
+	if n > 0 {
+		st.entries = append([]StreamEntry(nil), st.entries[n:]...)
+	}
+	return n
+}
+
+// nextID works out the ID of a new entry from the XADD ID argument: "*" for
+// a fully automatic ID, "ms-*" for an automatic sequence, or an explicit ID.
+func (st *streamValue) nextID(arg string) (StreamID, error) {
+	if arg == "*" {
+		now := uint64(time.Now().UnixMilli())
+		if now > st.lastID.Ms {
+			return StreamID{Ms: now}, nil
+		}
+		id, ok := st.lastID.next()
+		if !ok {
+			return id, errors.New("The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	}
+
+	var id StreamID
+	if msPart, ok := strings.CutSuffix(arg, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return id, ErrInvalidStreamID
+		}
+		id = StreamID{Ms: ms}
+		if ms == st.lastID.Ms {
+			if id, ok = st.lastID.next(); !ok || id.Ms != ms {
+				return id, ErrStreamIDTooSmall
+			}
+		}
+	} else {
+		var err error
+		if id, err = ParseStreamID(arg); err != nil {
+			return id, err
+		}
+	}
+	if id.isZero() {
+		return id, errors.New("The ID specified in XADD must be greater than 0-0")
+	}
+	if !st.lastID.Less(id) {
+		return id, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// streamForWriteLocked returns the stream at key, creating it when create is
+// set. It returns nil when the key is missing and create is not set. The
+// caller must hold the shard's write lock.
+func (r *InMemoryRepository) streamForWriteLocked(s *shard, key string, create bool) (*streamValue, error) {
+	r.expireIfNeededLocked(s, key)
+	if v, ok := r.mutableLocked(s, key); ok {
+		return typed[*streamValue](v)
+	}
+	if !create {
+		return nil, nil
+	}
+	st := newStreamValue()
+	s.store[key] = st
+	return st, nil
+}
+
+// viewStream calls fn with the stream stored at key under the shard's read lock.
+func (r *InMemoryRepository) viewStream(key string, fn func(st *streamValue)) error {
+	return r.view(key, func(v value) error {
+		st, err := typed[*streamValue](v)
+		if err != nil {
+			return err
+		}
+		fn(st)
+		return nil
+	})
+}
+
+// XAdd appends an entry to the stream at key and returns its ID. id is "*"
+// for an automatic ID, "ms-*" or an explicit ID. When noMkStream is set and
+// the stream does not exist nothing is added and false is returned. The
+// stream is trimmed according to trim after the entry is added.
+func (r *InMemoryRepository) XAdd(key, id string, fields []string, noMkStream bool, trim StreamTrim) (StreamID, bool, error) {
+	if err := r.freeMemory(); err != nil {
+		return StreamID{}, false, err
+	}
+
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return StreamID{}, false, errors.New("wrong number of arguments for XADD")
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if st == nil {
+		if noMkStream {
+			return StreamID{}, false, nil
+		}
+		st = newStreamValue()
+	}
+	newID, err := st.nextID(id)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	s.store[key] = st
+
+	st.entries = append(st.entries, StreamEntry{ID: newID, Fields: append([]string(nil), fields...)})
+	st.lastID = newID
+	if r.propagating() {
+		r.propagateValues(fields, "XADD", key, newID.String())
+	}
+	r.modified(s, NotifyStream, "xadd", key)
+	if st.trim(trim) > 0 {
+		strategy, threshold := recordTrim(trim)
+		r.propagate("XTRIM", key, strategy, threshold)
+		r.modified(s, NotifyStream, "xtrim", key)
+	}
+	r.signalStreamLocked(key)
+	return newID, true, nil
+}
+
+// XLen returns the number of entries in the stream at key.
+func (r *InMemoryRepository) XLen(key string) (int, error) {
+	var n int
+	err := r.viewStream(key, func(st *streamValue) {
+		n = len(st.entries)
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// XRange returns up to count entries with IDs between start and end
+// inclusive, newest first when rev is set. count <= 0 means no limit.
+func (r *InMemoryRepository) XRange(key string, start, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	var entries []StreamEntry
+	err := r.viewStream(key, func(st *streamValue) {
+		entries = st.rangeEntries(start, end, count, rev)
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return []StreamEntry{}, nil
+	}
+	return entries, err
+}
+
+// XDel removes entries by ID and returns how many existed.
+func (r *InMemoryRepository) XDel(key string, ids ...StreamID) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil || st == nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, id := range ids {
+		i := st.search(id)
+		if i < len(st.entries) && st.entries[i].ID == id {
+			st.entries = append(st.entries[:i], st.entries[i+1:]...)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		if r.propagating() {
+			r.propagateValues(streamIDStrings(ids), "XDEL", key)
+		}
+		r.modified(s, NotifyStream, "xdel", key)
+	}
+	return deleted, nil
+}
+
+// XTrim trims the stream at key and returns how many entries were evicted.
+func (r *InMemoryRepository) XTrim(key string, trim StreamTrim) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil || st == nil {
+		return 0, err
+	}
+	n := st.trim(trim)
+	if n > 0 {
+		strategy, threshold := recordTrim(trim)
+		r.propagate("XTRIM", key, strategy, threshold)
+		r.modified(s, NotifyStream, "xtrim", key)
+	}
+	return n, nil
+}
+
+// XRead returns entries with IDs greater than the matching entry of ids for
+// each of keys, at most count per stream (count <= 0 means no limit). An ID
+// of "$" stands for the last ID of the stream when the call is made. Streams
+// without new entries are left out of the result.
+//
+// When block is set and nothing is available, XRead waits for an entry to be
+// added to one of the streams or for ctx to be done, returning ctx.Err().
+func (r *InMemoryRepository) XRead(ctx context.Context, keys, ids []string, count int, block bool) ([]StreamRead, error) {
+	after := make([]StreamID, len(keys))
+	for i, key := range keys {
+		if ids[i] != "$" {
+			id, err := ParseStreamID(ids[i])
+			if err != nil {
+				return nil, err
+			}
+			after[i] = id
+			continue
+		}
+		err := r.viewStream(key, func(st *streamValue) {
+			after[i] = st.lastID
+		})
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+
+	var reads []StreamRead
+	read := func() (bool, error) {
+		reads = reads[:0]
+		for i, key := range keys {
+			start, ok := after[i].next()
+			if !ok {
+				continue
+			}
+			var entries []StreamEntry
+			err := r.viewStream(key, func(st *streamValue) {
+				entries = st.rangeEntries(start, MaxStreamID, count, false)
+			})
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if len(entries) > 0 {
+				reads = append(reads, StreamRead{Key: key, Entries: entries})
+			}
+		}
+		return len(reads) > 0, nil
+	}
+
+	if !block {
+		_, err := read()
+		return reads, err
+	}
+	if err := r.waitStreams(ctx, keys, read); err != nil {
+		return nil, err
+	}
+	return reads, nil
+}
+
+// XGroupCreate creates a consumer group starting after id, which may be "$"
+// for the last entry of the stream. mkStream creates an empty stream when
+// key does not exist.
+func (r *InMemoryRepository) XGroupCreate(key, group, id string, mkStream bool) error {
+	if err := r.freeMemory(); err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, mkStream)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return errors.New("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+	if _, ok := st.groups[group]; ok {
+		return ErrBusyGroup
+	}
+	start := st.lastID
+	if id != "$" {
+		if start, err = ParseStreamID(id); err != nil {
+			return err
+		}
+	}
+	st.groups[group] = newConsumerGroup(start)
+	if mkStream {
+		r.propagate("XGROUP", "CREATE", key, group, start.String(), "MKSTREAM")
+	} else {
+		r.propagate("XGROUP", "CREATE", key, group, start.String())
+	}
+	r.modified(s, NotifyStream, "xgroup-create", key)
+	return nil
+}
+
+// groupForWriteLocked returns the consumer group of the stream at key.
+// The caller must hold the shard's write lock.
+func (r *InMemoryRepository) groupForWriteLocked(s *shard, key, group, command string) (*streamValue, *consumerGroup, error) {
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st != nil {
+		if g, ok := st.groups[group]; ok {
+			return st, g, nil
+		}
+	}
+	return nil, nil, &CodedError{Code: "NOGROUP", Msg: fmt.Sprintf("No such key '%s' or consumer group '%s' in %s command", key, group, command)}
+}
+
+// XGroupDestroy deletes a consumer group and reports whether it existed.
+func (r *InMemoryRepository) XGroupDestroy(key, group string) (bool, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil {
+		return false, err
+	}
+	if st == nil {
+		return false, errors.New("The XGROUP subcommand requires the key to exist")
+	}
+	if _, ok := st.groups[group]; !ok {
+		return false, nil
+	}
+	delete(st.groups, group)
+	r.propagate("XGROUP", "DESTROY", key, group)
+	r.modified(s, NotifyStream, "xgroup-destroy", key)
+	return true, nil
+}
+
+// XGroupSetID moves the last delivered ID of a consumer group; id may be "$".
+func (r *InMemoryRepository) XGroupSetID(key, group, id string) error {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := r.groupForWriteLocked(s, key, group, "XGROUP")
+	if err != nil {
+		return err
+	}
+	start := st.lastID
+	if id != "$" {
+		if start, err = ParseStreamID(id); err != nil {
+			return err
+		}
+	}
+	g.lastDelivered = start
+	r.propagate("XGROUP", "SETID", key, group, start.String())
+	r.modified(s, NotifyStream, "xgroup-setid", key)
+	return nil
+}
+
+// XGroupCreateConsumer adds a consumer to a group and reports whether it is new.
+func (r *InMemoryRepository) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	if err := r.freeMemory(); err != nil {
+		return false, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := r.groupForWriteLocked(s, key, group, "XGROUP")
+	if err != nil {
+		return false, err
+	}
+	if _, ok := g.consumers[consumer]; ok {
+		return false, nil
+	}
+	g.consumers[consumer] = time.Now()
+	r.propagate("XGROUP", "CREATECONSUMER", key, group, consumer)
+	r.modified(s, NotifyStream, "xgroup-createconsumer", key)
+	return true, nil
+}
+
+// XGroupDelConsumer removes a consumer and its pending entries from a group
+// and returns how many entries were pending.
+func (r *InMemoryRepository) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := r.groupForWriteLocked(s, key, group, "XGROUP")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for id, p := range g.pending {
+		if p.consumer == consumer {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	if _, ok := g.consumers[consumer]; ok {
+		delete(g.consumers, consumer)
+		r.propagate("XGROUP", "DELCONSUMER", key, group, consumer)
+		r.modified(s, NotifyStream, "xgroup-delconsumer", key)
+	}
+	return n, nil
+}
+
+// XReadGroup reads from streams on behalf of consumer in group. An ID of ">"
+// delivers entries never delivered to the group, recording them as pending
+// for consumer unless noAck is set. Any other ID returns the consumer's
+// pending entries above it, with Fields nil for entries since deleted.
+//
+// Blocking, which only applies when every ID is ">", works as for XRead.
+func (r *InMemoryRepository) XReadGroup(ctx context.Context, group, consumer string, keys, ids []string, count int, noAck, block bool) ([]StreamRead, error) {
+	after := make([]StreamID, len(keys))
+	onlyNew := true
+	for i := range keys {
+		if ids[i] == ">" {
+			continue
+		}
+		onlyNew = false
+		id, err := ParseStreamID(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		after[i] = id
+	}
+
+	var reads []StreamRead
+	read := func() (bool, error) {
+		reads = reads[:0]
+		for i, key := range keys {
+			entries, err := r.readGroup(key, group, consumer, ids[i] == ">", after[i], count, noAck)
+			if err != nil {
+				return false, err
+			}
+			if len(entries) > 0 || ids[i] != ">" {
+				reads = append(reads, StreamRead{Key: key, Entries: entries})
+			}
+		}
+		return len(reads) > 0, nil
+	}
+
+	if !block || !onlyNew {
+		_, err := read()
+		return reads, err
+	}
+	if err := r.waitStreams(ctx, keys, read); err != nil {
+		return nil, err
+	}
+	return reads, nil
+}
+
+// readGroup performs XREADGROUP on a single stream.
+func (r *InMemoryRepository) readGroup(key, group, consumer string, onlyNew bool, after StreamID, count int, noAck bool) ([]StreamEntry, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, g, err := r.groupForWriteLocked(s, key, group, "XREADGROUP")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if _, ok := g.consumers[consumer]; !ok {
+		r.propagate("XGROUP", "CREATECONSUMER", key, group, consumer)
+	}
+	g.consumers[consumer] = now
+
+	if !onlyNew {
+		// History: the consumer's own pending entries
+		entries := []StreamEntry{}
+		for _, id := range g.pendingIDs(consumer) {
+			if !after.Less(id) {
+				continue
+			}
+			if count > 0 && len(entries) == count {
+				break
+			}
+			e, ok := st.lookup(id)
+			if !ok {
+				e = StreamEntry{ID: id}
+			}
+			entries = append(entries, e)
+		}
+		return entries, nil
+	}
+
+	start, ok := g.lastDelivered.next()
+	if !ok {
+		return nil, nil
+	}
+	entries := st.rangeEntries(start, MaxStreamID, count, false)
+	if len(entries) == 0 {
+		return entries, nil
+	}
+	ids := make([]StreamID, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	r.deliverLocked(g, consumer, now, noAck, ids)
+	if r.propagating() {
+		ack := "ACK"
+		if noAck {
+			ack = "NOACK"
+		}
+		r.propagateValues(streamIDStrings(ids), "XDELIVER", key, group, consumer, strconv.FormatInt(now.UnixMilli(), 10), ack)
+	}
+	return entries, nil
+}
+
+// deliverLocked records the delivery of ids, in order, to consumer: the
+// group's last delivered ID moves to the last of them and, unless noAck,
+// they become pending for the consumer. The caller must hold the write lock
+// of the stream's shard.
+func (r *InMemoryRepository) deliverLocked(g *consumerGroup, consumer string, now time.Time, noAck bool, ids []StreamID) {
+	g.consumers[consumer] = now
+	for _, id := range ids {
+		g.lastDelivered = id
+		if noAck {
+			continue
+		}
+		if p, ok := g.pending[id]; ok {
+			p.consumer, p.deliveryTime = consumer, now
+			p.deliveryCount++
+		} else {
+			g.pending[id] = &pendingEntry{consumer: consumer, deliveryTime: now, deliveryCount: 1}
+		}
+	}
+}
+
+// XAck acknowledges pending entries of a group and returns how many were pending.
+func (r *InMemoryRepository) XAck(key, group string, ids ...StreamID) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := r.streamForWriteLocked(s, key, false)
+	if err != nil || st == nil {
+		return 0, err
+	}
+	g, ok := st.groups[group]
+	if !ok {
+		return 0, nil
+	}
+	acked := 0
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	if acked > 0 && r.propagating() {
+		r.propagateValues(streamIDStrings(ids), "XACK", key, group)
+	}
+	return acked, nil
+}
+
+// PendingSummary is the short form of XPENDING.
+type PendingSummary struct {
+	Count     int            `json:"count"`
+	Lowest    string         `json:"lowest,omitempty"`
+	Highest   string         `json:"highest,omitempty"`
+	Consumers map[string]int `json:"consumers"`
+}
+
+// PendingEntry describes one pending entry, as in the extended form of XPENDING.
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      string
+	Idle          time.Duration
+	DeliveryCount int
+}
+
+// XPending summarises the pending entries of a group.
+func (r *InMemoryRepository) XPending(key, group string) (PendingSummary, error) {
+	summary := PendingSummary{Consumers: map[string]int{}}
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := r.groupForWriteLocked(s, key, group, "XPENDING")
+	if err != nil {
+		return summary, err
+	}
+	ids := g.pendingIDs("")
+	summary.Count = len(ids)
+	if len(ids) > 0 {
+		summary.Lowest, summary.Highest = ids[0].String(), ids[len(ids)-1].String()
+	}
+	for _, p := range g.pending {
+		summary.Consumers[p.consumer]++
+	}
+	return summary, nil
+}
+
+// XPendingRange lists up to count pending entries of a group with IDs between
+// start and end inclusive, optionally only those owned by consumer.
+func (r *InMemoryRepository) XPendingRange(key, group string, start, end StreamID, count int, consumer string) ([]PendingEntry, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, g, err := r.groupForWriteLocked(s, key, group, "XPENDING")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entries := []PendingEntry{}
+	for _, id := range g.pendingIDs(consumer) {
+		if id.Less(start) || end.Less(id) {
+			continue
+		}
+		if len(entries) == count {
+			break
+		}
+		p := g.pending[id]
+		entries = append(entries, PendingEntry{
+			ID:            id,
+			Consumer:      p.consumer,
+			Idle:          now.Sub(p.deliveryTime),
+			DeliveryCount: p.deliveryCount,
+		})
+	}
+	return entries, nil
+}
+
+// signalStreamLocked wakes the clients blocked reading key. The caller must
+// hold the key's shard write lock.
+func (r *InMemoryRepository) signalStreamLocked(key string) {
+	if r.blocked.Load() == 0 {
+		return
+	}
+	r.blockMu.Lock()
+	for _, ch := range r.streamWaiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	r.blockMu.Unlock()
+}
+
+// waitStreams calls read until it reports success or fails, waiting for an
+// entry to be added to one of keys between attempts. It returns ctx.Err()
+// once ctx is done.
+func (r *InMemoryRepository) waitStreams(ctx context.Context, keys []string, read func() (bool, error)) error {
+	ch := make(chan struct{}, 1)
+	r.blockMu.Lock()
+	for _, key := range keys {
+		r.streamWaiters[key] = append(r.streamWaiters[key], ch)
+	}
+	r.blocked.Add(1)
+	r.blockMu.Unlock()
+
+	defer func() {
+		r.blockMu.Lock()
+		for _, key := range keys {
+			waiters := r.streamWaiters[key]
+			kept := waiters[:0]
+			for _, other := range waiters {
+				if other != ch {
+					kept = append(kept, other)
+				}
+			}
+			if len(kept) == 0 {
+				delete(r.streamWaiters, key)
+			} else {
+				r.streamWaiters[key] = kept
+			}
+		}
+		r.blocked.Add(-1)
+		r.blockMu.Unlock()
+	}()
+
+	// Registering before the first attempt means no entry added in between
+	// can be missed.
+	for {
+		ok, err := read()
+		if ok || err != nil {
+			return err
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// streamDump is the JSON form of a stream.
+type streamDump struct {
+	LastID  string
+	Entries []streamDumpEntry
+	Groups  map[string]groupDump `json:",omitempty"`
+}
+
+type streamDumpEntry struct {
+	ID     string
+	Fields []string
+}
+
+type groupDump struct {
+	LastDelivered string
+	Consumers     []string
+	Pending       []pendingDump
+}
+
+type pendingDump struct {
+	ID            string
+	Consumer      string
+	DeliveryTime  int64 // Unix milliseconds
+	DeliveryCount int
+}
+
+func (st *streamValue) dump() streamDump {
+	d := streamDump{LastID: st.lastID.String(), Entries: make([]streamDumpEntry, 0, len(st.entries))}
+	for _, e := range st.entries {
+		d.Entries = append(d.Entries, streamDumpEntry{ID: e.ID.String(), Fields: e.Fields})
+	}
+	if len(st.groups) > 0 {
+		d.Groups = make(map[string]groupDump, len(st.groups))
+	}
+	for name, g := range st.groups {
+		gd := groupDump{LastDelivered: g.lastDelivered.String()}
+		for consumer := range g.consumers {
+			gd.Consumers = append(gd.Consumers, consumer)
+		}
+		for _, id := range g.pendingIDs("") {
+			p := g.pending[id]
+			gd.Pending = append(gd.Pending, pendingDump{
+				ID:            id.String(),
+				Consumer:      p.consumer,
+				DeliveryTime:  p.deliveryTime.UnixMilli(),
+				DeliveryCount: p.deliveryCount,
+			})
+		}
+		d.Groups[name] = gd
+	}
+	return d
+}
+
+func (d streamDump) restore() (*streamValue, error) {
+	st := newStreamValue()
+	var err error
+	if st.lastID, err = ParseStreamID(d.LastID); err != nil {
+		return nil, err
+	}
+	for _, e := range d.Entries {
+		id, err := ParseStreamID(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		st.entries = append(st.entries, StreamEntry{ID: id, Fields: e.Fields})
+	}
+	now := time.Now()
+	for name, gd := range d.Groups {
+		last, err := ParseStreamID(gd.LastDelivered)
+		if err != nil {
+			return nil, err
+		}
+		g := newConsumerGroup(last)
+		for _, consumer := range gd.Consumers {
+			g.consumers[consumer] = now
+		}
+		for _, pd := range gd.Pending {
+			id, err := ParseStreamID(pd.ID)
+			if err != nil {
+				return nil, err
+			}
+			g.pending[id] = &pendingEntry{
+				consumer:      pd.Consumer,
+				deliveryTime:  time.UnixMilli(pd.DeliveryTime),
+				deliveryCount: pd.DeliveryCount,
+			}
+		}
+		st.groups[name] = g
+	}
+	return st, nil
+}
@@ -0,0 +1,143 @@
+package idis
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// embstrMaxLen is the longest string Redis stores inline with its header.
+const embstrMaxLen = 44
+
+// ErrNotInteger is returned when a string value is not a valid integer.
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+
+// stringValue holds a single string.
+type stringValue struct {
+	s string
+}
+
+func (v *stringValue) Type() string { return TypeString }
+
+func (v *stringValue) Encoding() string {
+	if _, err := strconv.ParseInt(v.s, 10, 64); err == nil && len(v.s) <= 20 {
+		return "int"
+	}
+	if len(v.s) <= embstrMaxLen {
+		return "embstr"
+	}
+	return "raw"
+}
+
+func (v *stringValue) clone() value { return &stringValue{s: v.s} }
+
+// setStringLocked stores s at key as a string, keeping the reverse lookup
+// in sync. The caller must hold the shard's write lock.
+func (r *InMemoryRepository) setStringLocked(sh *shard, key, s string) {
+	if old, ok := sh.store[key]; ok {
+		for _, v := range indexedValues(old) {
+			r.unlink(v, key)
+		}
+	}
+	sh.store[key] = &stringValue{s: s}
+	r.link(s, key)
+}
+
+// SetString stores value at key as a string, replacing any existing value
+// and clearing its TTL.
+func (r *InMemoryRepository) SetString(key, value string) error {
+	if err := r.freeMemory(); err != nil {
+		return err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	r.setStringLocked(s, key, value)
+	delete(s.expiry, key)
+	r.propagate("SETSTR", key, value)
+	r.modified(s, NotifyString, "setstr", key)
+	return nil
+}
+
+// GetString returns the string stored at key.
+func (r *InMemoryRepository) GetString(key string) (string, error) {
+	var str string
+	err := r.view(key, func(v value) error {
+		sv, err := typed[*stringValue](v)
+		if err != nil {
+			return err
+		}
+		str = sv.s
+		return nil
+	})
+	return str, err
+}
+
+// IncrBy adds delta to the integer stored at key, creating it as 0 first if missing.
+func (r *InMemoryRepository) IncrBy(key string, delta int64) (int64, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	var current int64
+	if v, ok := s.store[key]; ok {
+		sv, err := typed[*stringValue](v)
+		if err != nil {
+			return 0, err
+		}
+		current, err = strconv.ParseInt(sv.s, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, errors.New("increment or decrement would overflow")
+	}
+	current += delta
+	r.setStringLocked(s, key, strconv.FormatInt(current, 10))
+	r.propagate("INCRBY", key, strconv.FormatInt(delta, 10))
+	r.modified(s, NotifyString, "incrby", key)
+	return current, nil
+}
+
+// Append appends value to the string at key and returns the new length.
+func (r *InMemoryRepository) Append(key, value string) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.expireIfNeededLocked(s, key)
+	current := ""
+	if v, ok := s.store[key]; ok {
+		sv, err := typed[*stringValue](v)
+		if err != nil {
+			return 0, err
+		}
+		current = sv.s
+	}
+	r.setStringLocked(s, key, current+value)
+	r.propagate("APPEND", key, value)
+	r.modified(s, NotifyString, "append", key)
+	return len(current) + len(value), nil
+}
+
+// StrLen returns the length of the string at key, or 0 if it does not exist.
+func (r *InMemoryRepository) StrLen(key string) (int, error) {
+	str, err := r.GetString(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return len(str), err
+}
@@ -0,0 +1,226 @@
+package idis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Type names reported by TYPE and stored in dumps.
+const (
+	TypeNone   = "none"
+	TypeString = "string"
+	TypeList   = "list"
+	TypeSet    = "set"
+)
+
+var (
+	// ErrKeyNotFound is returned when an operation needs an existing key.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrWrongType is returned when an operation does not match the type of the key.
+	ErrWrongType = &CodedError{Code: "WRONGTYPE", Msg: "Operation against a key holding the wrong kind of value"}
+)
+
+// CodedError is an error replied to RESP clients under its own error code,
+// such as WRONGTYPE, rather than the generic ERR.
+type CodedError struct {
+	Code string
+	Msg  string
+}
+
+func (e *CodedError) Error() string {
+	return e.Code + " " + e.Msg
+}
+
+// value is implemented by every data type that can be stored under a key.
+type value interface {
+	// Type returns the name of the data type, e.g. "list".
+	Type() string
+	// Encoding returns the internal representation currently in use.
+	Encoding() string
+	// clone returns a deep copy, used for snapshots.
+	clone() value
+}
+
+// typed returns v as the concrete type T, or ErrWrongType.
+func typed[T value](v value) (T, error) {
+	t, ok := v.(T)
+	if !ok {
+		return t, ErrWrongType
+	}
+	return t, nil
+}
+
+// indexedValues returns the elements of v recorded in the reverse lookup.
+// Strings, list elements and set members are indexed.
+func indexedValues(v value) []string {
+	switch v := v.(type) {
+	case *stringValue:
+		return []string{v.s}
+	case *listValue:
+		return v.items
+	case *setValue:
+		return v.members()
+	}
+	return nil
+}
+
+// view calls fn with the live value stored at key while holding the shard's
+// read lock, and records the access. Expired keys are evicted and reported as
+// ErrKeyNotFound.
+func (r *InMemoryRepository) view(key string, fn func(v value) error) error {
+	return r.peek(key, func(s *shard, v value, m *keyMeta) error {
+		err := fn(v)
+		if m != nil {
+			m.touch(time.Now())
+		}
+		return err
+	})
+}
+
+// peek is view without recording an access, for introspection; fn also gets
+// the key's shard and metadata.
+func (r *InMemoryRepository) peek(key string, fn func(s *shard, v value, m *keyMeta) error) error {
+	s := r.shardFor(key)
+	s.mu.RLock()
+	v, ok := s.store[key]
+	expired := ok && r.expiredLocked(s, key, time.Now())
+	var err error
+	if ok && !expired {
+		err = fn(s, v, s.meta[key])
+	}
+	s.mu.RUnlock()
+
+	if expired {
+		r.evictIfExpired(key)
+	}
+	if !ok || expired {
+		return ErrKeyNotFound
+	}
+	return err
+}
+
+// Type returns the type name of the value stored at key, or "none".
+func (r *InMemoryRepository) Type(key string) (string, error) {
+	var name string
+	err := r.view(key, func(v value) error {
+		name = v.Type()
+		return nil
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return TypeNone, nil
+	}
+	return name, err
+}
+
+// Encoding returns the internal representation of the value stored at key.
+func (r *InMemoryRepository) Encoding(key string) (string, error) {
+	var encoding string
+	err := r.view(key, func(v value) error {
+		encoding = v.Encoding()
+		return nil
+	})
+	return encoding, err
+}
+
+// dumpValue is the JSON form of a typed value.
+type dumpValue struct {
+	Type  string
+	Value json.RawMessage
+}
+
+// encodeValue converts v to its JSON dump form.
+func encodeValue(v value) (dumpValue, error) {
+	var payload interface{}
+	switch v := v.(type) {
+	case *stringValue:
+		payload = v.s
+	case *listValue:
+		payload = v.items
+	case *setValue:
+		payload = v.members()
+	case *hashValue:
+		fields := make(map[string]string, v.len())
+		for _, fv := range v.entries() {
+			fields[fv.Field] = fv.Value
+		}
+		payload = fields
+	case *streamValue:
+		payload = v.dump()
+	case *zsetValue:
+		// Scores are written as strings so infinite scores survive JSON
+		members := make([][2]string, 0, v.zsl.length)
+		for x := v.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+			members = append(members, [2]string{x.member, strconv.FormatFloat(x.score, 'g', -1, 64)})
+		}
+		payload = members
+	default:
+		return dumpValue{}, fmt.Errorf("cannot encode value of type %s", v.Type())
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return dumpValue{}, err
+	}
+	return dumpValue{Type: v.Type(), Value: raw}, nil
+}
+
+// decodeValue rebuilds a typed value from its JSON dump form.
+func decodeValue(d dumpValue) (value, error) {
+	switch d.Type {
+	case TypeString:
+		var s string
+		if err := json.Unmarshal(d.Value, &s); err != nil {
+			return nil, err
+		}
+		return &stringValue{s: s}, nil
+	case TypeList:
+		var items []string
+		if err := json.Unmarshal(d.Value, &items); err != nil {
+			return nil, err
+		}
+		return &listValue{items: items}, nil
+	case TypeSet:
+		var members []string
+		if err := json.Unmarshal(d.Value, &members); err != nil {
+			return nil, err
+		}
+		set := newSetValue()
+		for _, m := range members {
+			set.add(m)
+		}
+		return set, nil
+	case TypeHash:
+		var fields map[string]string
+		if err := json.Unmarshal(d.Value, &fields); err != nil {
+			return nil, err
+		}
+		h := newHashValue()
+		for f, v := range fields {
+			h.set(f, v)
+		}
+		return h, nil
+	case TypeStream:
+		var st streamDump
+		if err := json.Unmarshal(d.Value, &st); err != nil {
+			return nil, err
+		}
+		return st.restore()
+	case TypeZSet:
+		var members [][2]string
+		if err := json.Unmarshal(d.Value, &members); err != nil {
+			return nil, err
+		}
+		z := newZSetValue()
+		for _, m := range members {
+			score, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			z.set(m[0], score)
+		}
+		return z, nil
+	}
+	return nil, fmt.Errorf("unknown value type %q in dump", d.Type)
+}
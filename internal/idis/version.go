@@ -0,0 +1,41 @@
+package idis
+
+import "time"
+
+// Every key has a version that changes whenever the key is modified, which
+// lets transactions WATCH keys optimistically. Keys modified since their
+// shard was last reset have their own version; every other key, present or
+// not, shares the shard's epoch. Deleting a key moves the epoch on, so a key
+// created and deleted again still changes version. The price is that the
+// deletion also changes the version of the other keys sharing the epoch,
+// which can only make a transaction abort unnecessarily, never miss a change.
+
+// modified records that key was just modified: it moves the key's version on,
+// updates its size and access time and publishes a keyspace notification for
+// event. The caller must hold the write lock of the key's shard.
+func (r *InMemoryRepository) modified(s *shard, class int, event, key string) {
+	if _, ok := s.store[key]; ok {
+		s.versions[key] = r.clock.Add(1)
+		now := time.Now()
+		r.account(s, key, now).touch(now)
+	} else {
+		r.account(s, key, time.Time{})
+		delete(s.versions, key)
+		s.epoch = r.clock.Add(1)
+	}
+	r.notify(class, event, key)
+}
+
+// Version returns the current version of key. Two calls return the same
+// version only if the key was not modified in between. A key whose TTL has
+// passed is removed first, so its expiry counts as a modification.
+func (r *InMemoryRepository) Version(key string) uint64 {
+	r.evictIfExpired(key)
+	s := r.shardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.versions[key]; ok {
+		return v
+	}
+	return s.epoch
+}
@@ -0,0 +1,500 @@
+package idis
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TypeZSet is the type name of sorted sets.
+const TypeZSet = "zset"
+
+// ErrNaNScore is returned when an increment would produce a NaN score.
+var ErrNaNScore = errors.New("resulting score is not a number (NaN)")
+
+// ScoredMember is a sorted set member together with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// MarshalJSON writes infinite scores as the strings "inf" and "-inf", which
+// plain JSON numbers cannot represent.
+func (m ScoredMember) MarshalJSON() ([]byte, error) {
+	var score interface{} = m.Score
+	switch {
+	case math.IsInf(m.Score, 1):
+		score = "inf"
+	case math.IsInf(m.Score, -1):
+		score = "-inf"
+	}
+	return json.Marshal(struct {
+		Member string      `json:"member"`
+		Score  interface{} `json:"score"`
+	}{m.Member, score})
+}
+
+// ZAddOptions mirrors the ZADD flags.
+type ZAddOptions struct {
+	NX bool // Only add new members
+	XX bool // Only update existing members
+	GT bool // Only update when the new score is greater
+	LT bool // Only update when the new score is less
+	CH bool // Count changed members, not only added ones
+}
+
+// zsetValue is a sorted set: a map from member to score for O(1) lookups
+// plus a skiplist ordered by score for ranges and ranks.
+type zsetValue struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+func newZSetValue() *zsetValue {
+	return &zsetValue{dict: make(map[string]float64), zsl: newSkiplist()}
+}
+
+func (z *zsetValue) Type() string { return TypeZSet }
+
+func (z *zsetValue) Encoding() string { return "skiplist" }
+
+func (z *zsetValue) clone() value {
+	c := newZSetValue()
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		c.set(x.member, x.score)
+	}
+	return c
+}
+
+// set inserts member or moves it to score.
+func (z *zsetValue) set(member string, score float64) {
+	if cur, ok := z.dict[member]; ok {
+		if cur == score {
+			return
+		}
+		z.zsl.delete(cur, member)
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+}
+
+// remove deletes member and reports whether it was present.
+func (z *zsetValue) remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// add applies one ZADD element. It returns the resulting score and whether
+// the member was added or had its score changed.
+func (z *zsetValue) add(m ScoredMember, opts ZAddOptions, incr bool) (score float64, added, updated, ok bool, err error) {
+	cur, exists := z.dict[m.Member]
+	if exists {
+		if opts.NX {
+			return cur, false, false, false, nil
+		}
+		score = m.Score
+		if incr {
+			score += cur
+			if math.IsNaN(score) {
+				return 0, false, false, false, ErrNaNScore
+			}
+		}
+		if (opts.LT && score >= cur) || (opts.GT && score <= cur) {
+			return cur, false, false, false, nil
+		}
+		if score != cur {
+			z.set(m.Member, score)
+			updated = true
+		}
+		return score, false, updated, true, nil
+	}
+	if opts.XX {
+		return 0, false, false, false, nil
+	}
+	z.set(m.Member, m.Score)
+	return m.Score, true, false, true, nil
+}
+
+func (z *zsetValue) members(from *skiplistNode, rev bool, offset, count int, inRange func(*skiplistNode) bool) []ScoredMember {
+	next := func(x *skiplistNode) *skiplistNode {
+		if rev {
+			return x.backward
+		}
+		return x.level[0].forward
+	}
+	x := from
+	for ; x != nil && offset > 0; offset-- {
+		x = next(x)
+	}
+	result := []ScoredMember{}
+	for ; x != nil && count != 0 && inRange(x); x = next(x) {
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		count--
+	}
+	return result
+}
+
+// zsetForWriteLocked returns the sorted set at key, creating it if create
+// is set. The caller must hold the shard's write lock.
+func (r *InMemoryRepository) zsetForWriteLocked(s *shard, key string, create bool) (*zsetValue, error) {
+	r.expireIfNeededLocked(s, key)
+	if v, ok := r.mutableLocked(s, key); ok {
+		return typed[*zsetValue](v)
+	}
+	if !create {
+		return nil, ErrKeyNotFound
+	}
+	z := newZSetValue()
+	s.store[key] = z
+	return z, nil
+}
+
+// viewZSet calls fn with the sorted set at key under the shard's read lock.
+func (r *InMemoryRepository) viewZSet(key string, fn func(z *zsetValue)) error {
+	return r.view(key, func(v value) error {
+		z, err := typed[*zsetValue](v)
+		if err != nil {
+			return err
+		}
+		fn(z)
+		return nil
+	})
+}
+
+// ZAdd adds or updates members of the sorted set at key. It returns the
+// number of added members, or of added and updated members with CH.
+func (r *InMemoryRepository) ZAdd(key string, opts ZAddOptions, members ...ScoredMember) (int, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, err := r.zsetForWriteLocked(s, key, !opts.XX)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	changed, touched := 0, false
+	var record []string
+	for _, m := range members {
+		score, added, updated, _, err := z.add(m, opts, false)
+		if err != nil {
+			return changed, err
+		}
+		if added || (opts.CH && updated) {
+			changed++
+		}
+		if (added || updated) && r.propagating() {
+			record = append(record, formatScore(score), m.Member)
+		}
+		touched = touched || added || updated
+	}
+	if z.zsl.length == 0 {
+		r.removeKeyLocked(s, key)
+	} else if touched {
+		r.propagateValues(record, "ZADD", key)
+		r.modified(s, NotifyZSet, "zadd", key)
+	}
+	return changed, nil
+}
+
+// ZAddIncr increments the score of a single member, as ZADD INCR does. The
+// boolean is false when the flags prevented the update.
+func (r *InMemoryRepository) ZAddIncr(key string, opts ZAddOptions, m ScoredMember) (float64, bool, error) {
+	if err := r.freeMemory(); err != nil {
+		return 0, false, err
+	}
+
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, err := r.zsetForWriteLocked(s, key, !opts.XX)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	score, _, _, ok, err := z.add(m, opts, true)
+	if z.zsl.length == 0 {
+		r.removeKeyLocked(s, key)
+	} else if ok && err == nil {
+		r.propagate("ZADD", key, formatScore(score), m.Member)
+		r.modified(s, NotifyZSet, "zincr", key)
+	}
+	return score, ok, err
+}
+
+// ZRem removes members from the sorted set at key and returns how many were removed.
+func (r *InMemoryRepository) ZRem(key string, members ...string) (int, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, err := r.zsetForWriteLocked(s, key, false)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, m := range members {
+		if z.remove(m) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		r.propagateValues(members, "ZREM", key)
+		r.modified(s, NotifyZSet, "zrem", key)
+	}
+	if z.zsl.length == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return removed, nil
+}
+
+// ZScore returns the score of member. The boolean is false if it is missing.
+func (r *InMemoryRepository) ZScore(key, member string) (float64, bool, error) {
+	var score float64
+	var found bool
+	err := r.viewZSet(key, func(z *zsetValue) {
+		score, found = z.dict[member]
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	return score, found, err
+}
+
+// ZCard returns the number of members in the sorted set at key.
+func (r *InMemoryRepository) ZCard(key string) (int, error) {
+	n := 0
+	err := r.viewZSet(key, func(z *zsetValue) {
+		n = z.zsl.length
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// ZRank returns the 0-based rank of member, counted from the highest score
+// when rev is set. The boolean is false if the member is missing.
+func (r *InMemoryRepository) ZRank(key, member string, rev bool) (int, bool, error) {
+	rank := 0
+	found := false
+	err := r.viewZSet(key, func(z *zsetValue) {
+		score, ok := z.dict[member]
+		if !ok {
+			return
+		}
+		found = true
+		rank = z.zsl.rank(score, member)
+		if rev {
+			rank = z.zsl.length - rank
+		} else {
+			rank--
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	return rank, found, err
+}
+
+// ZRangeByRank returns the members between the start and stop indexes.
+// Negative indexes count from the end, as in Redis.
+func (r *InMemoryRepository) ZRangeByRank(key string, start, stop int, rev bool) ([]ScoredMember, error) {
+	result := []ScoredMember{}
+	err := r.viewZSet(key, func(z *zsetValue) {
+		n := z.zsl.length
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		if start < 0 {
+			start = 0
+		}
+		if start > stop || start >= n {
+			return
+		}
+		if stop >= n {
+			stop = n - 1
+		}
+
+		var from *skiplistNode
+		if rev {
+			from = z.zsl.byRank(n - start)
+		} else {
+			from = z.zsl.byRank(start + 1)
+		}
+		result = z.members(from, rev, 0, stop-start+1, func(*skiplistNode) bool { return true })
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return result, nil
+	}
+	return result, err
+}
+
+// ZRangeByScore returns members with scores between min and max, walking
+// from max down to min when rev is set. A negative count means no limit.
+func (r *InMemoryRepository) ZRangeByScore(key string, min, max ScoreBound, rev bool, offset, count int) ([]ScoredMember, error) {
+	result := []ScoredMember{}
+	err := r.viewZSet(key, func(z *zsetValue) {
+		if rev {
+			from := z.zsl.lastInRange(min, max)
+			result = z.members(from, true, offset, count, func(x *skiplistNode) bool { return min.aboveMin(x.score) })
+		} else {
+			from := z.zsl.firstInRange(min, max)
+			result = z.members(from, false, offset, count, func(x *skiplistNode) bool { return max.belowMax(x.score) })
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return result, nil
+	}
+	return result, err
+}
+
+// ZRangeByLex returns members between min and max in lexicographical order,
+// which is only meaningful when all members share the same score.
+func (r *InMemoryRepository) ZRangeByLex(key string, min, max LexBound, rev bool, offset, count int) ([]ScoredMember, error) {
+	result := []ScoredMember{}
+	err := r.viewZSet(key, func(z *zsetValue) {
+		if rev {
+			from := z.zsl.lastInLexRange(min, max)
+			result = z.members(from, true, offset, count, func(x *skiplistNode) bool { return min.aboveMin(x.member) })
+		} else {
+			from := z.zsl.firstInLexRange(min, max)
+			result = z.members(from, false, offset, count, func(x *skiplistNode) bool { return max.belowMax(x.member) })
+		}
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return result, nil
+	}
+	return result, err
+}
+
+// ZCount returns the number of members with scores between min and max.
+func (r *InMemoryRepository) ZCount(key string, min, max ScoreBound) (int, error) {
+	n := 0
+	err := r.viewZSet(key, func(z *zsetValue) {
+		first := z.zsl.firstInRange(min, max)
+		if first == nil {
+			return
+		}
+		last := z.zsl.lastInRange(min, max)
+		n = z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+	})
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// ZPop removes and returns up to count members with the lowest scores, or
+// the highest when max is set.
+func (r *InMemoryRepository) ZPop(key string, count int, max bool) ([]ScoredMember, error) {
+	s := r.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []ScoredMember{}
+	z, err := r.zsetForWriteLocked(s, key, false)
+	if errors.Is(err, ErrKeyNotFound) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for ; count > 0 && z.zsl.length > 0; count-- {
+		x := z.zsl.header.level[0].forward
+		if max {
+			x = z.zsl.tail
+		}
+		result = append(result, ScoredMember{Member: x.member, Score: x.score})
+		z.remove(x.member)
+	}
+	if len(result) > 0 {
+		if r.propagating() {
+			popped := make([]string, len(result))
+			for i, m := range result {
+				popped[i] = m.Member
+			}
+			r.propagateValues(popped, "ZREM", key)
+		}
+		if max {
+			r.modified(s, NotifyZSet, "zpopmax", key)
+		} else {
+			r.modified(s, NotifyZSet, "zpopmin", key)
+		}
+	}
+	if z.zsl.length == 0 {
+		r.removeKeyLocked(s, key)
+		r.modified(s, NotifyGeneric, "del", key)
+	}
+	return result, nil
+}
+
+// formatScore formats a score so that ParseScore reads it back exactly.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// ParseScore parses a score, accepting "inf", "+inf" and "-inf".
+func ParseScore(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, errors.New("value is not a valid float")
+	}
+	return f, nil
+}
+
+// ParseScoreBound parses a score range bound such as "1.5", "(1.5" or "-inf".
+func ParseScoreBound(s string) (ScoreBound, error) {
+	b := ScoreBound{}
+	if strings.HasPrefix(s, "(") {
+		b.Exclusive = true
+		s = s[1:]
+	}
+	f, err := ParseScore(s)
+	if err != nil {
+		return b, errors.New("min or max is not a float")
+	}
+	b.Value = f
+	return b, nil
+}
+
+// ParseLexBound parses a lexicographical range bound: "-", "+", "[member" or "(member".
+func ParseLexBound(s string) (LexBound, error) {
+	switch {
+	case s == "-":
+		return LexBound{Inf: -1}, nil
+	case s == "+":
+		return LexBound{Inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return LexBound{Value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return LexBound{Value: s[1:], Exclusive: true}, nil
+	}
+	return LexBound{}, errors.New("min or max not valid string range item")
+}
@@ -0,0 +1,250 @@
+// Package pubsub routes messages published on channels to the subscribers of
+// those channels or of glob patterns matching them.
+package pubsub
+
+import (
+	"sort"
+	"sync"
+
+	"go-idis/internal/idis"
+)
+
+// DefaultBuffer is the number of messages a subscriber may fall behind by
+// before it is dropped, like the Redis pubsub output buffer limit.
+const DefaultBuffer = 1024
+
+// Message is a message delivered to a subscriber. Pattern is set when it was
+// matched through a pattern subscription.
+type Message struct {
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// Subscriber receives the messages of the channels and patterns it is
+// subscribed to.
+type Subscriber struct {
+	broker   *Broker
+	ch       chan Message
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+	dropped  bool
+}
+
+// Messages returns the channel messages are delivered on. It is closed when
+// the subscriber is closed or dropped for falling behind.
+func (s *Subscriber) Messages() <-chan Message { return s.ch }
+
+// Dropped reports whether the subscriber was dropped for falling behind.
+// It is only meaningful once Messages has been closed.
+func (s *Subscriber) Dropped() bool { return s.dropped }
+
+// Count returns the number of channels and patterns subscribed to.
+func (s *Subscriber) Count() int {
+	s.broker.mu.RLock()
+	defer s.broker.mu.RUnlock()
+	return s.count()
+}
+
+func (s *Subscriber) count() int { return len(s.channels) + len(s.patterns) }
+
+// Channels returns the subscribed channels in sorted order.
+func (s *Subscriber) Channels() []string {
+	s.broker.mu.RLock()
+	defer s.broker.mu.RUnlock()
+	return sortedKeys(s.channels)
+}
+
+// Patterns returns the subscribed patterns in sorted order.
+func (s *Subscriber) Patterns() []string {
+	s.broker.mu.RLock()
+	defer s.broker.mu.RUnlock()
+	return sortedKeys(s.patterns)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Broker tracks subscriptions and delivers published messages.
+type Broker struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+}
+
+// NewBroker creates an empty Broker.
+func NewBroker() *Broker {
+	return &Broker{
+		channels: make(map[string]map[*Subscriber]struct{}),
+		patterns: make(map[string]map[*Subscriber]struct{}),
+	}
+}
+
+// NewSubscriber creates a subscriber with room for buffer undelivered messages.
+func (b *Broker) NewSubscriber(buffer int) *Subscriber {
+	if buffer < 1 {
+		buffer = DefaultBuffer
+	}
+	return &Subscriber{
+		broker:   b,
+		ch:       make(chan Message, buffer),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func add(index map[string]map[*Subscriber]struct{}, name string, sub *Subscriber) {
+	subs, ok := index[name]
+	if !ok {
+		subs = make(map[*Subscriber]struct{})
+		index[name] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func remove(index map[string]map[*Subscriber]struct{}, name string, sub *Subscriber) {
+	if subs, ok := index[name]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(index, name)
+		}
+	}
+}
+
+// Subscribe subscribes sub to a channel and returns its subscription count.
+func (b *Broker) Subscribe(sub *Subscriber, channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !sub.closed {
+		sub.channels[channel] = struct{}{}
+		add(b.channels, channel, sub)
+	}
+	return sub.count()
+}
+
+// Unsubscribe unsubscribes sub from a channel and returns its subscription count.
+func (b *Broker) Unsubscribe(sub *Subscriber, channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(sub.channels, channel)
+	remove(b.channels, channel, sub)
+	return sub.count()
+}
+
+// PSubscribe subscribes sub to a glob pattern and returns its subscription count.
+func (b *Broker) PSubscribe(sub *Subscriber, pattern string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !sub.closed {
+		sub.patterns[pattern] = struct{}{}
+		add(b.patterns, pattern, sub)
+	}
+	return sub.count()
+}
+
+// PUnsubscribe unsubscribes sub from a pattern and returns its subscription count.
+func (b *Broker) PUnsubscribe(sub *Subscriber, pattern string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(sub.patterns, pattern)
+	remove(b.patterns, pattern, sub)
+	return sub.count()
+}
+
+// Close removes every subscription of sub and closes its message channel.
+func (b *Broker) Close(sub *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeLocked(sub)
+}
+
+func (b *Broker) closeLocked(sub *Subscriber) {
+	if sub.closed {
+		return
+	}
+	for channel := range sub.channels {
+		remove(b.channels, channel, sub)
+	}
+	for pattern := range sub.patterns {
+		remove(b.patterns, pattern, sub)
+	}
+	sub.closed = true
+	close(sub.ch)
+}
+
+// Publish delivers payload to the subscribers of channel and of matching
+// patterns, and returns how many deliveries were made. A subscriber whose
+// buffer is full is dropped rather than holding up the publisher.
+func (b *Broker) Publish(channel, payload string) int {
+	b.mu.RLock()
+	var slow []*Subscriber
+	n := 0
+	deliver := func(sub *Subscriber, msg Message) {
+		select {
+		case sub.ch <- msg:
+			n++
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	for sub := range b.channels[channel] {
+		deliver(sub, Message{Channel: channel, Payload: payload})
+	}
+	for pattern, subs := range b.patterns {
+		if !idis.MatchPattern(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			deliver(sub, Message{Pattern: pattern, Channel: channel, Payload: payload})
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(slow) > 0 {
+		b.mu.Lock()
+		for _, sub := range slow {
+			if !sub.closed {
+				sub.dropped = true
+				b.closeLocked(sub)
+			}
+		}
+		b.mu.Unlock()
+	}
+	return n
+}
+
+// Channels returns the channels with at least one subscriber, optionally
+// only those matching pattern.
+func (b *Broker) Channels(pattern string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	channels := []string{}
+	for channel := range b.channels {
+		if pattern == "" || idis.MatchPattern(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of channel, not counting patterns.
+func (b *Broker) NumSub(channel string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.channels[channel])
+}
+
+// NumPat returns the number of distinct subscribed patterns.
+func (b *Broker) NumPat() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.patterns)
+}
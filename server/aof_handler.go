@@ -0,0 +1,18 @@
+package server
+
+import (
+	"fmt"
+)
+
+// handleBgRewriteAOF starts compacting the append-only file in the
+// background. INFO persistence reports its progress.
+func (s *Server) handleBgRewriteAOF(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: BGREWRITEAOF")
+	}
+	if err := s.store.BgRewriteAOF(); err != nil {
+		return err
+	}
+	c.reply.Status("Background append only file rewriting started")
+	return nil
+}
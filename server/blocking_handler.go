@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimeout parses a blocking command timeout in seconds; 0 blocks forever.
+func parseTimeout(arg string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, fmt.Errorf("timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, fmt.Errorf("timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// block returns a context for a blocking command that is done once timeout
+// elapses, 0 meaning never, the client disconnects or the server shuts down.
+// The returned function must be called when the command finishes; it stops
+// watching the connection and reports whether the client has gone away.
+//
+// The connection is watched by peeking at it from another goroutine, so only
+// a disconnect while no further input is pending can be noticed.
+//
+// The caller holds c.mu, which is released until the returned function is
+// called, so that pub/sub messages keep flowing to the client while it waits.
+//
+// Inside a transaction the context is already done, so, as in Redis, blocking
+// commands return at once instead of holding up the transaction.
+func (c *client) block(timeout time.Duration) (context.Context, func() bool) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.execing {
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		return ctx, func() bool { return false }
+	}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.ctx)
+	}
+
+	c.blocked.Store(true)
+	c.mu.Unlock()
+	done := make(chan struct{})
+	gone := false
+	go func() {
+		defer close(done)
+		_, err := c.reader.Peek(1)
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			gone = true
+			cancel()
+		}
+	}()
+
+	return ctx, func() bool {
+		// Wake the watcher and wait for it before the connection is read again
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+		cancel()
+		c.mu.Lock()
+		c.blocked.Store(false)
+		return gone
+	}
+}
+
+// handleBlockingPop serves BLPOP and BRPOP.
+func (s *Server) handleBlockingPop(c *client, args []string, left bool) error {
+	if len(args) < 2 {
+		if left {
+			return fmt.Errorf("usage: BLPOP key [key ...] timeout")
+		}
+		return fmt.Errorf("usage: BRPOP key [key ...] timeout")
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	// Replies already queued must reach the client before it is parked
+	c.out.Flush()
+	ctx, stop := c.block(timeout)
+	key, item, err := s.store.BlockingPop(ctx, args[:len(args)-1], left)
+	if stop() && err == nil {
+		// The element was handed over as the client disconnected
+		_, err = s.store.Push(key, left, false, item)
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		c.reply.NullArray()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply.Strings([]string{key, item})
+	return nil
+}
+
+// parseDirection parses the LEFT|RIGHT arguments of LMOVE and BLMOVE.
+func parseDirection(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, fmt.Errorf("syntax error")
+}
+
+func (s *Server) handleLMove(c *client, args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: LMOVE source destination LEFT|RIGHT LEFT|RIGHT")
+	}
+	srcLeft, err := parseDirection(args[2])
+	if err != nil {
+		return err
+	}
+	dstLeft, err := parseDirection(args[3])
+	if err != nil {
+		return err
+	}
+	item, ok, err := s.store.Move(args[0], args[1], srcLeft, dstLeft)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Bulk(item)
+	}
+	return nil
+}
+
+func (s *Server) handleBLMove(c *client, args []string) error {
+	if len(args) != 5 {
+		return fmt.Errorf("usage: BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout")
+	}
+	srcLeft, err := parseDirection(args[2])
+	if err != nil {
+		return err
+	}
+	dstLeft, err := parseDirection(args[3])
+	if err != nil {
+		return err
+	}
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return err
+	}
+
+	c.out.Flush()
+	ctx, stop := c.block(timeout)
+	item, err := s.store.BlockingMove(ctx, args[0], args[1], srcLeft, dstLeft)
+	stop()
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		c.reply.Null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply.Bulk(item)
+	return nil
+}
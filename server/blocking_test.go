@@ -0,0 +1,47 @@
+package server
+
+import (
+	"go-idis/internal/pubsub"
+	"strconv"
+	"testing"
+)
+
+func TestBlockingWhileSubscribed(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   []string // the blocking command
+		unblock []string // run by another client to serve it
+		want    interface{}
+	}{
+		{"BLPOP", []string{"BLPOP", "list", "0"}, []string{"RPUSH", "list", "v"}, []interface{}{"list", "v"}},
+		{"BLMOVE", []string{"BLMOVE", "list", "dst", "LEFT", "RIGHT", "0"}, []string{"RPUSH", "list", "v"}, "v"},
+		{"XREAD", []string{"XREAD", "BLOCK", "0", "STREAMS", "stream", "$"}, []string{"XADD", "stream", "1-1", "f", "v"},
+			[]interface{}{"stream", []interface{}{[]interface{}{"1-1", []interface{}{"f", "v"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			sub, other := dial(t, s), dial(t, s)
+			if _, ok := sub.do("HELLO", "3").([]interface{}); !ok {
+				t.Fatalf("HELLO 3 did not reply with a map")
+			}
+			expect(t, "SUBSCRIBE", sub.do("SUBSCRIBE", "ch"), push{"subscribe", "ch", int64(1)})
+			sub.send(tt.block...)
+
+			// Many more messages than the subscriber may fall behind by reach
+			// it while it is blocked, a batch at a time
+			const batch = 100
+			for sent := 0; sent < pubsub.DefaultBuffer*4; sent += batch {
+				for i := sent; i < sent+batch; i++ {
+					expect(t, "PUBLISH", other.do("PUBLISH", "ch", strconv.Itoa(i)), int64(1))
+				}
+				for i := sent; i < sent+batch; i++ {
+					expect(t, "message", sub.read(), push{"message", "ch", strconv.Itoa(i)})
+				}
+			}
+
+			other.do(tt.unblock...)
+			expect(t, tt.name, sub.read(), tt.want)
+		})
+	}
+}
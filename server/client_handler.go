@@ -0,0 +1,282 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientMode is the state of a client shown in the flags of CLIENT LIST.
+type clientMode struct {
+	multi   int // commands queued since MULTI, -1 outside a transaction
+	sub     int // channels subscribed to
+	psub    int // patterns subscribed to
+	monitor bool
+}
+
+// clientInfo describes a connected client, as reported by CLIENT LIST and
+// /admin/clients.
+type clientInfo struct {
+	ID        int64  `json:"id"`
+	Addr      string `json:"addr"`
+	LocalAddr string `json:"laddr"`
+	Listener  string `json:"listener"`
+	Name      string `json:"name"`
+	Age       int64  `json:"age"`  // seconds since the client connected
+	Idle      int64  `json:"idle"` // seconds since its last command
+	Flags     string `json:"flags"`
+	Sub       int    `json:"sub"`
+	PSub      int    `json:"psub"`
+	Multi     int    `json:"multi"`
+	Cmd       string `json:"cmd"` // last command run
+}
+
+// String formats the client as a line of CLIENT LIST.
+func (ci clientInfo) String() string {
+	return fmt.Sprintf("id=%d addr=%s laddr=%s listener=%s name=%s age=%d idle=%d flags=%s sub=%d psub=%d multi=%d cmd=%s",
+		ci.ID, ci.Addr, ci.LocalAddr, ci.Listener, ci.Name, ci.Age, ci.Idle, ci.Flags, ci.Sub, ci.PSub, ci.Multi, ci.Cmd)
+}
+
+// begin records that the client started running command.
+func (c *client) begin(command string) {
+	c.stateMu.Lock()
+	c.lastCmd = strings.ToLower(command)
+	c.lastActive = time.Now()
+	c.stateMu.Unlock()
+}
+
+// end records the state the client is left in by its last command.
+func (c *client) end() {
+	mode := clientMode{multi: -1, monitor: c.monitor != nil}
+	if c.multi {
+		mode.multi = len(c.queued)
+	}
+	if c.sub != nil {
+		mode.sub = len(c.sub.Channels())
+		mode.psub = len(c.sub.Patterns())
+	}
+	c.stateMu.Lock()
+	c.lastActive = time.Now()
+	c.mode = mode
+	c.stateMu.Unlock()
+}
+
+func (c *client) setName(name string) {
+	c.stateMu.Lock()
+	c.name = name
+	c.stateMu.Unlock()
+}
+
+// info describes the client; it may be called from any goroutine.
+func (c *client) info(now time.Time) clientInfo {
+	c.stateMu.Lock()
+	ci := clientInfo{
+		ID:       c.id,
+		Addr:     c.addr,
+		Listener: c.listener,
+		Name:     c.name,
+		Age:      int64(now.Sub(c.created).Seconds()),
+		Idle:     int64(now.Sub(c.lastActive).Seconds()),
+		Sub:      c.mode.sub,
+		PSub:     c.mode.psub,
+		Multi:    c.mode.multi,
+		Cmd:      c.lastCmd,
+	}
+	monitor := c.mode.monitor
+	c.stateMu.Unlock()
+
+	if c.conn != nil {
+		ci.LocalAddr = c.conn.LocalAddr().String()
+	}
+	if ci.Multi >= 0 {
+		ci.Flags += "x"
+	}
+	if ci.Sub+ci.PSub > 0 {
+		ci.Flags += "P"
+	}
+	if monitor {
+		ci.Flags += "O"
+	}
+	if c.blocked.Load() {
+		ci.Flags += "b"
+	}
+	if ci.Flags == "" {
+		ci.Flags = "N"
+	}
+	if ci.Cmd == "" {
+		ci.Cmd = "NULL"
+	}
+	return ci
+}
+
+// clientList returns the connected telnet and RESP clients by ID.
+func (s *Server) clientList() []*client {
+	s.clientsMu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.clientsMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+// killClients disconnects the clients matching filter and returns how many
+// there were. self, the client asking, if any, is only disconnected once it
+// has been replied to, and not at all if skipSelf is set.
+func (s *Server) killClients(self *client, skipSelf bool, filter func(c *client) bool) int {
+	killed := 0
+	for _, c := range s.clientList() {
+		if !filter(c) || (c == self && skipSelf) {
+			continue
+		}
+		killed++
+		if c == self {
+			c.quit = true
+			continue
+		}
+		c.killed.Store(true)
+		c.conn.Close()
+	}
+	return killed
+}
+
+// validClientName reports whether name can be set with CLIENT SETNAME.
+func validClientName(name string) bool {
+	for _, r := range name {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// handleClient serves CLIENT ID, INFO, LIST [ID id ...], SETNAME name,
+// GETNAME and KILL. KILL takes either an address, replying OK, or any of
+// ID id, ADDR addr, NAME name and SKIPME yes|no, replying with the number of
+// clients disconnected; as in Redis, the client asking is skipped unless
+// SKIPME no is given.
+func (s *Server) handleClient(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: CLIENT ID | INFO | LIST [ID id ...] | SETNAME name | GETNAME | KILL ...")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ID":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: CLIENT ID")
+		}
+		c.reply.Int(c.id)
+	case "INFO":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: CLIENT INFO")
+		}
+		c.reply.Bulk(c.info(time.Now()).String() + "\n")
+	case "LIST":
+		ids := make(map[int64]bool)
+		if len(args) > 1 {
+			if len(args) < 3 || !strings.EqualFold(args[1], "ID") {
+				return fmt.Errorf("usage: CLIENT LIST [ID id ...]")
+			}
+			for _, arg := range args[2:] {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil || id <= 0 {
+					return fmt.Errorf("Invalid client ID")
+				}
+				ids[id] = true
+			}
+		}
+		now := time.Now()
+		var b strings.Builder
+		for _, other := range s.clientList() {
+			if len(ids) == 0 || ids[other.id] {
+				b.WriteString(other.info(now).String())
+				b.WriteByte('\n')
+			}
+		}
+		c.reply.Bulk(b.String())
+	case "SETNAME":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: CLIENT SETNAME name")
+		}
+		if !validClientName(args[1]) {
+			return fmt.Errorf("Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.setName(args[1])
+		c.reply.Status("OK")
+	case "GETNAME":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: CLIENT GETNAME")
+		}
+		if c.name == "" {
+			c.reply.Null()
+		} else {
+			c.reply.Bulk(c.name)
+		}
+	case "KILL":
+		return s.handleClientKill(c, args[1:])
+	default:
+		return fmt.Errorf("unknown subcommand '%s', expected ID, INFO, LIST, SETNAME, GETNAME or KILL", args[0])
+	}
+	return nil
+}
+
+func (s *Server) handleClientKill(c *client, args []string) error {
+	if len(args) == 1 {
+		// Old form: CLIENT KILL addr
+		addr := args[0]
+		if s.killClients(c, false, func(other *client) bool { return other.addr == addr }) == 0 {
+			return fmt.Errorf("No such client")
+		}
+		c.reply.Status("OK")
+		return nil
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return fmt.Errorf("usage: CLIENT KILL addr | [ID id] [ADDR addr] [NAME name] [SKIPME yes|no]")
+	}
+
+	var filters []func(other *client) bool
+	skipSelf := true
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("client-id should be greater than 0")
+			}
+			filters = append(filters, func(other *client) bool { return other.id == id })
+		case "ADDR":
+			filters = append(filters, func(other *client) bool { return other.addr == value })
+		case "NAME":
+			filters = append(filters, func(other *client) bool {
+				other.stateMu.Lock()
+				defer other.stateMu.Unlock()
+				return other.name == value
+			})
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipSelf = true
+			case "no":
+				skipSelf = false
+			default:
+				return fmt.Errorf("syntax error")
+			}
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+
+	killed := s.killClients(c, skipSelf, func(other *client) bool {
+		for _, match := range filters {
+			if !match(other) {
+				return false
+			}
+		}
+		return true
+	})
+	c.reply.Int(int64(killed))
+	return nil
+}
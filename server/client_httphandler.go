@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerClients returns an HTTP handler listing the telnet and RESP clients
+// connected, as CLIENT LIST does.
+func (s *Server) handlerClients() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		clients := s.clientList()
+		infos := make([]clientInfo, len(clients))
+		for i, c := range clients {
+			infos[i] = c.info(now)
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: infos}, http.StatusOK, nil)
+	}
+}
+
+// handlerKillClient returns an HTTP handler disconnecting the client with
+// the ID given in the path.
+func (s *Server) handlerKillClient() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid client ID", http.StatusBadRequest)
+			return
+		}
+
+		if s.killClients(nil, false, func(c *client) bool { return c.id == id }) == 0 {
+			http.Error(w, fmt.Sprintf("No such client: %d", id), http.StatusNotFound)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: fmt.Sprintf("Client %d killed", id)}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/config"
+	"go-idis/internal/idis"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// configParam is a runtime setting readable with CONFIG GET and, when set is
+// not nil, writable with CONFIG SET.
+type configParam struct {
+	name string
+	get  func(s *Server) string
+	set  func(s *Server, value string) error
+}
+
+// startupParam is a setting only read at startup, reported as loaded.
+func startupParam(name string) configParam {
+	return configParam{
+		name: name,
+		get: func(s *Server) string {
+			value, _ := s.cfg.Get(name)
+			return value
+		},
+	}
+}
+
+// configParams lists the settings CONFIG knows about, in the order CONFIG GET
+// replies with them.
+var configParams = []configParam{
+	startupParam("http-addr"),
+	startupParam("telnet-addr"),
+	startupParam("resp-addr"),
+	startupParam("shards"),
+	startupParam("expire-cycle"),
+	startupParam("reset-interval"),
+	startupParam("dbfilename"),
+	startupParam("save-interval"),
+	startupParam("appendonly"),
+	startupParam("appendfilename"),
+	startupParam("shutdown-timeout"),
+	{
+		name: "notify-keyspace-events",
+		get: func(s *Server) string {
+			return idis.NotifyFlagsString(s.store.NotifyFlags())
+		},
+		set: func(s *Server, value string) error {
+			flags, err := idis.ParseNotifyFlags(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetNotifyFlags(flags)
+			return nil
+		},
+	},
+	{
+		name: "appendfsync",
+		get: func(s *Server) string {
+			return s.store.FsyncPolicy().String()
+		},
+		set: func(s *Server, value string) error {
+			policy, err := idis.ParseFsyncPolicy(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetFsyncPolicy(policy)
+			return nil
+		},
+	},
+	{
+		name: "snapshot-format",
+		get: func(s *Server) string {
+			return s.store.SnapshotFormat().String()
+		},
+		set: func(s *Server, value string) error {
+			format, err := idis.ParseSnapshotFormat(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetSnapshotFormat(format)
+			return nil
+		},
+	},
+	{
+		name: "snapshot-compression",
+		get: func(s *Server) string {
+			return config.YesNo(s.store.SnapshotCompression())
+		},
+		set: func(s *Server, value string) error {
+			compress, err := config.ParseYesNo(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetSnapshotCompression(compress)
+			return nil
+		},
+	},
+	{
+		name: "maxmemory",
+		get: func(s *Server) string {
+			return config.FormatMemory(s.store.MaxMemory())
+		},
+		set: func(s *Server, value string) error {
+			limit, err := config.ParseMemory(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetMaxMemory(limit)
+			return nil
+		},
+	},
+	{
+		name: "maxmemory-policy",
+		get: func(s *Server) string {
+			return s.store.EvictionPolicy().String()
+		},
+		set: func(s *Server, value string) error {
+			policy, err := idis.ParseEvictionPolicy(value)
+			if err != nil {
+				return err
+			}
+			s.store.SetEvictionPolicy(policy)
+			return nil
+		},
+	},
+	{
+		name: "maxmemory-samples",
+		get: func(s *Server) string {
+			return strconv.Itoa(s.store.MaxMemorySamples())
+		},
+		set: func(s *Server, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			s.store.SetMaxMemorySamples(n)
+			return nil
+		},
+	},
+	{
+		name: "slowlog-log-slower-than",
+		get: func(s *Server) string {
+			return strconv.FormatInt(s.slowlog.slowerThan.Load(), 10)
+		},
+		set: func(s *Server, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("argument must be an integer")
+			}
+			s.slowlog.slowerThan.Store(n)
+			return nil
+		},
+	},
+	{
+		name: "slowlog-max-len",
+		get: func(s *Server) string {
+			return strconv.Itoa(s.slowlog.getMaxLen())
+		},
+		set: func(s *Server, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			s.slowlog.setMaxLen(n)
+			return nil
+		},
+	},
+	{
+		name: "runtime-memory-limit",
+		get: func(s *Server) string {
+			limit := debug.SetMemoryLimit(-1)
+			if limit == math.MaxInt64 {
+				limit = 0
+			}
+			return config.FormatMemory(limit)
+		},
+		set: func(s *Server, value string) error {
+			limit, err := config.ParseMemory(value)
+			if err != nil {
+				return err
+			}
+			if limit == 0 {
+				limit = math.MaxInt64
+			}
+			debug.SetMemoryLimit(limit)
+			return nil
+		},
+	},
+}
+
+// handleConfig serves CONFIG GET pattern [pattern ...],
+// CONFIG SET parameter value [parameter value ...] and CONFIG REWRITE.
+func (s *Server) handleConfig(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: CONFIG GET pattern [pattern ...] | SET parameter value [parameter value ...] | REWRITE")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: CONFIG GET pattern [pattern ...]")
+		}
+		var matched []configParam
+		for _, p := range configParams {
+			for _, pattern := range args[1:] {
+				if idis.MatchPattern(strings.ToLower(pattern), p.name) {
+					matched = append(matched, p)
+					break
+				}
+			}
+		}
+		c.reply.Map(len(matched))
+		for _, p := range matched {
+			c.reply.Bulk(p.name)
+			c.reply.Bulk(p.get(s))
+		}
+	case "SET":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return fmt.Errorf("usage: CONFIG SET parameter value [parameter value ...]")
+		}
+		// Validate every parameter before applying any of them
+		params := make([]configParam, 0, len(args)/2)
+		for i := 1; i < len(args); i += 2 {
+			p, ok := findConfigParam(args[i])
+			if !ok {
+				return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+			}
+			if p.set == nil {
+				return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", p.name)
+			}
+			params = append(params, p)
+		}
+		for i, p := range params {
+			if err := p.set(s, args[2*i+2]); err != nil {
+				return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", p.name, err)
+			}
+		}
+		c.reply.Status("OK")
+	case "REWRITE":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: CONFIG REWRITE")
+		}
+		if err := s.rewriteConfig(); err != nil {
+			return fmt.Errorf("Rewriting config file: %v", err)
+		}
+		c.reply.Status("OK")
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	return nil
+}
+
+// findConfigParam looks a setting up by name, ignoring case.
+func findConfigParam(name string) (configParam, bool) {
+	for _, p := range configParams {
+		if strings.EqualFold(p.name, name) {
+			return p, true
+		}
+	}
+	return configParam{}, false
+}
+
+// rewriteConfig writes the settings in effect back to the configuration
+// file, taking the runtime ones from where CONFIG SET applied them.
+func (s *Server) rewriteConfig() error {
+	for _, p := range configParams {
+		if p.set == nil {
+			continue
+		}
+		if err := s.cfg.Set(p.name, p.get(s)); err != nil {
+			return err
+		}
+	}
+	return s.cfg.Rewrite()
+}
@@ -2,10 +2,9 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleDelete(conn net.Conn, args []string) error {
+func (s *Server) handleDelete(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: DELETE key")
 	}
@@ -13,6 +12,6 @@ func (s *Server) handleDelete(conn net.Conn, args []string) error {
 	if err := s.store.Delete(key); err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "Deleted\n")
+	c.reply.Status("Deleted")
 	return nil
 }
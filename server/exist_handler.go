@@ -2,19 +2,18 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleExists(conn net.Conn, args []string) error {
+func (s *Server) handleExists(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: EXISTS key")
 	}
 	key := args[0]
 	exists := s.store.Exists(key)
 	if exists {
-		fmt.Fprint(conn, "1\n")
+		c.reply.Int(1)
 	} else {
-		fmt.Fprint(conn, "0\n")
+		c.reply.Int(0)
 	}
 	return nil
 }
@@ -2,11 +2,10 @@ package server
 
 import (
 	"fmt"
-	"net"
 	"time"
 )
 
-func (s *Server) handleExpire(conn net.Conn, args []string) error {
+func (s *Server) handleExpire(c *client, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage: EXPIRE key ttl_in_seconds")
 	}
@@ -18,11 +17,11 @@ func (s *Server) handleExpire(conn net.Conn, args []string) error {
 	if err := s.store.Expire(key, ttl); err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "OK\n")
+	c.reply.Status("OK")
 	return nil
 }
 
-func (s *Server) handleTTL(conn net.Conn, args []string) error {
+func (s *Server) handleTTL(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: TTL key")
 	}
@@ -31,6 +30,11 @@ func (s *Server) handleTTL(conn net.Conn, args []string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(conn, "TTL: %d seconds\n", int(ttl.Seconds()))
+	if t, ok := c.reply.(*textWriter); ok {
+		t.Lines(fmt.Sprintf("TTL: %d seconds", int(ttl.Seconds())))
+		return nil
+	}
+	// Remaining seconds as an integer reply
+	c.reply.Int(int64(ttl.Seconds()))
 	return nil
 }
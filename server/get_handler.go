@@ -2,10 +2,9 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleGet(conn net.Conn, args []string) error {
+func (s *Server) handleGet(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: GET key")
 	}
@@ -15,19 +14,16 @@ func (s *Server) handleGet(conn net.Conn, args []string) error {
 		return err
 	}
 
-	if len(values) == 0 {
-		fmt.Fprint(conn, "No values found for key: "+key+"\n")
+	if t, ok := c.reply.(*textWriter); ok && len(values) == 0 {
+		t.Lines("No values found for key: " + key)
 		return nil
 	}
-
-	// Numbered list of values
-	for i, value := range values {
-		fmt.Fprintf(conn, "%d: %s\n", i+1, value)
-	}
+	// Numbered list of values on telnet, an array on RESP
+	c.reply.Strings(values)
 	return nil
 }
 
-func (s *Server) handleGetUnique(conn net.Conn, args []string) error {
+func (s *Server) handleGetUnique(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: GETUQ key")
 	}
@@ -37,19 +33,16 @@ func (s *Server) handleGetUnique(conn net.Conn, args []string) error {
 		return err
 	}
 
-	if len(values) == 0 {
-		fmt.Fprint(conn, "No unique values found for key: "+key+"\n")
+	if t, ok := c.reply.(*textWriter); ok && len(values) == 0 {
+		t.Lines("No unique values found for key: " + key)
 		return nil
 	}
-
-	// Numbered list of unique values
-	for i, value := range values {
-		fmt.Fprintf(conn, "%d: %s\n", i+1, value)
-	}
+	// Numbered list of unique values on telnet, an array on RESP
+	c.reply.Strings(values)
 	return nil
 }
 
-func (s *Server) handleGetKey(conn net.Conn, args []string) error {
+func (s *Server) handleGetKey(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: GETKEY value")
 	}
@@ -59,14 +52,19 @@ func (s *Server) handleGetKey(conn net.Conn, args []string) error {
 		return err
 	}
 
-	if len(keys) == 0 {
-		fmt.Fprint(conn, "value not found\n")
-	} else {
-		for _, key := range keys {
-			fmt.Fprintf(conn, "Key: %s\n", key)
+	if t, ok := c.reply.(*textWriter); ok {
+		if len(keys) == 0 {
+			t.Lines("value not found")
+			return nil
 		}
+		lines := make([]string, len(keys))
+		for i, key := range keys {
+			lines[i] = "Key: " + key
+		}
+		t.Lines(lines...)
+		return nil
 	}
-
+	c.reply.Strings(keys)
 	return nil
 }
 
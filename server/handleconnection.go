@@ -2,77 +2,451 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"go-idis/internal/pubsub"
 	"log"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// client holds the state of a single telnet or RESP connection.
+type client struct {
+	id     int64
+	ctx    context.Context // done once the server shuts down
+	conn   net.Conn
+	addr   string // remote address
+	reader *bufio.Reader
+	// mu guards out and reply, which pub/sub deliveries write to from
+	// another goroutine.
+	mu       sync.Mutex
+	out      *bufio.Writer
+	reply    replyWriter
+	proto    int    // 0 for telnet clients, otherwise the negotiated RESP version
+	listener string // "telnet", "resp" or "http"; set once, so other goroutines may read it
+	created  time.Time
+	quit     bool
+	sub      *pubsub.Subscriber // set once the client first subscribes
+	monitor  *monitor           // set while the client runs MONITOR
+
+	// What CLIENT LIST reports, see client_handler.go. The client's own
+	// goroutine writes these under stateMu and reads them without it.
+	stateMu    sync.Mutex
+	name       string
+	lastCmd    string
+	lastActive time.Time
+	mode       clientMode
+	blocked    atomic.Bool // set while a blocking command waits
+	killed     atomic.Bool // disconnected by CLIENT KILL
+
+	// Transaction state, see tx_handler.go
+	multi   bool
+	failed  bool       // a command could not be queued, EXEC will abort
+	queued  [][]string // commands queued since MULTI
+	watched map[string]uint64
+	execing bool // set while EXEC runs the queued commands
+}
+
+func (s *Server) newClient(conn net.Conn, proto int) *client {
+	c := &client{
+		id:      s.nextClientID.Add(1),
+		ctx:     s.ctx,
+		conn:    conn,
+		addr:    conn.RemoteAddr().String(),
+		reader:  bufio.NewReader(conn),
+		out:     bufio.NewWriter(conn),
+		proto:   proto,
+		created: time.Now(),
+	}
+	c.lastActive = c.created
+	if proto == 0 {
+		c.listener = "telnet"
+		c.reply = newTextWriter(c.out)
+	} else {
+		c.listener = "resp"
+		c.reply = newRESPWriter(c.out)
+	}
+	s.clientsMu.Lock()
+	s.clients[c] = struct{}{}
+	s.clientsMu.Unlock()
+	return c
+}
+
+// clientCounts returns the number of clients connected to the telnet and
+// RESP listeners.
+func (s *Server) clientCounts() (telnet, resp int) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	for c := range s.clients {
+		if c.listener == "telnet" {
+			telnet++
+		} else {
+			resp++
+		}
+	}
+	return telnet, resp
+}
+
+// closeClient releases the resources held by a client once it disconnects.
+func (s *Server) closeClient(c *client) {
+	if c.sub != nil {
+		s.broker.Close(c.sub)
+	}
+	if c.monitor != nil {
+		s.removeMonitor(c.monitor)
+	}
+	s.clientsMu.Lock()
+	delete(s.clients, c)
+	s.clientsMu.Unlock()
+	c.conn.Close()
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
-	reader := bufio.NewReader(conn)
+	c := s.newClient(conn, 0)
+	defer s.closeClient(c)
 	prompt := "go-idis> "
 
-	for {
+	for !c.quit && !s.closing.Load() {
 		// Display prompt to the client
-		fmt.Fprint(conn, prompt)
+		c.mu.Lock()
+		c.out.WriteString(prompt)
+		err := c.out.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			log.Println("Write error:", err)
+			return
+		}
 
 		// Read client input
-		message, err := reader.ReadString('\n')
+		message, err := c.reader.ReadString('\n')
 		if err != nil {
-			log.Println("Read error:", err)
+			if !s.closing.Load() && !c.killed.Load() {
+				log.Println("Read error:", err)
+			}
 			return
 		}
 
 		// Process the command
-		if err := s.processCommand(conn, strings.TrimSpace(message)); err != nil {
-			fmt.Fprint(conn, err.Error()+"\n")
+		c.mu.Lock()
+		if err := s.processCommand(c, strings.Fields(message)); err != nil {
+			c.reply.Error(err)
 		}
+		c.mu.Unlock()
 	}
+	c.mu.Lock()
+	c.out.Flush()
+	c.mu.Unlock()
 }
 
-func (s *Server) processCommand(conn net.Conn, message string) error {
-	parts := strings.Fields(message) // Split by whitespace
+// handleRESPConnection serves a client speaking the Redis serialization protocol.
+func (s *Server) handleRESPConnection(conn net.Conn) {
+	c := s.newClient(conn, 2)
+	defer s.closeClient(c)
+
+	for !c.quit && !s.closing.Load() {
+		args, err := readRESPCommand(c.reader)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.mu.Lock()
+				c.reply.Error(err)
+				c.out.Flush()
+				c.mu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		c.mu.Lock()
+		if err := s.processCommand(c, args); err != nil {
+			c.reply.Error(err)
+		}
+
+		// Pipelined commands are answered together once the input is drained
+		if c.reader.Buffered() == 0 || c.quit {
+			err = c.out.Flush()
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
 
+func (s *Server) processCommand(c *client, parts []string) error {
 	if len(parts) == 0 {
 		return fmt.Errorf("invalid command")
 	}
 
 	command := strings.ToUpper(parts[0]) // First part is the command
-	args := parts[1:]                    // Remaining parts are arguments
+	c.begin(command)
+	defer c.end()
+
+	if c.subscribed() && c.proto < 3 && !subscriberCommands[command] {
+		return fmt.Errorf("Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(command))
+	}
+	if c.monitor != nil && command != "QUIT" && command != "EXIT" {
+		return fmt.Errorf("Can't execute '%s': only QUIT is allowed while monitoring", strings.ToLower(command))
+	}
+	if c.multi && !txCommands[command] {
+		return s.queueCommand(c, command, parts)
+	}
+
+	// Commands run under the transaction lock so none interleaves with an
+	// EXEC. Blocking commands, which are single atomic store operations, do
+	// not take it as they would hold it while waiting.
+	if command != "EXEC" && !blockingCommands[command] {
+		s.txMu.RLock()
+		defer s.txMu.RUnlock()
+	}
+	return s.execute(c, parts)
+}
+
+// execute runs a single command, replying to c, after handing it to the
+// monitors, and counts it for INFO and /metrics. Slow commands are logged,
+// except blocking ones, which mostly wait.
+func (s *Server) execute(c *client, parts []string) error {
+	s.feedMonitors(c.listener, c.addr, parts)
+	start := time.Now()
+	err := s.dispatch(c, parts)
+	d := time.Since(start)
+	command := strings.ToUpper(parts[0])
+	s.stats.record(command, d, err)
+	if !blockingCommands[command] {
+		s.slowlog.record(parts, d, c.addr, c.name)
+	}
+	return err
+}
+
+// commandFunc handles a command, given its arguments.
+type commandFunc func(c *client, args []string) error
+
+// dispatch runs a single command through its handler.
+func (s *Server) dispatch(c *client, parts []string) error {
+	handler := s.lookupCommand(strings.ToUpper(parts[0]))
+	if handler == nil {
+		return fmt.Errorf("%w '%s'", errUnknownCommand, parts[0])
+	}
+	return handler(c, parts[1:])
+}
 
+// lookupCommand returns the handler of an upper-case command name, or nil if
+// there is no such command.
+func (s *Server) lookupCommand(command string) commandFunc {
 	switch command {
 	case "SET":
-		return s.handleSet(conn, args)
+		return s.handleSet
 	case "GET":
-		return s.handleGet(conn, args)
+		return s.handleGet
 	case "DELETE":
-		return s.handleDelete(conn, args)
+		return s.handleDelete
 	case "EXISTS":
-		return s.handleExists(conn, args)
+		return s.handleExists
 	case "EXPIRE":
-		return s.handleExpire(conn, args)
+		return s.handleExpire
 	case "TTL":
-		return s.handleTTL(conn, args)
+		return s.handleTTL
 	case "RAND":
-		return s.handleRand(conn, args)
+		return s.handleRand
 	case "SETUQ":
-		return s.handleSetUnique(conn, args)
+		return s.handleSetUnique
 	case "REMOVE":
-		return s.handleRemove(conn, args)
+		return s.handleRemove
 	case "GETUQ":
-		return s.handleGetUnique(conn, args)
+		return s.handleGetUnique
 	case "GETKEY":
-		return s.handleGetKey(conn, args)
+		return s.handleGetKey
 	case "LOADDUMP":
-		return s.handleLoadDump(conn, args)
-	case "EXIT":
-		fmt.Fprint(conn, "Goodbye!\n")
-		conn.Close()
-		return nil
+		return s.handleLoadDump
+	case "TYPE":
+		return s.handleType
+	case "SETSTR":
+		return s.handleSetString
+	case "GETSTR":
+		return s.handleGetString
+	case "INCR", "INCRBY":
+		return func(c *client, args []string) error { return s.handleIncrBy(c, args, command, 1) }
+	case "DECR", "DECRBY":
+		return func(c *client, args []string) error { return s.handleIncrBy(c, args, command, -1) }
+	case "APPEND":
+		return s.handleAppend
+	case "STRLEN":
+		return s.handleStrLen
+	case "SADD":
+		return s.handleSAdd
+	case "SREM":
+		return s.handleSRem
+	case "SMEMBERS":
+		return s.handleSMembers
+	case "SISMEMBER":
+		return s.handleSIsMember
+	case "SCARD":
+		return s.handleSCard
+	case "ZADD":
+		return s.handleZAdd
+	case "ZREM":
+		return s.handleZRem
+	case "ZSCORE":
+		return s.handleZScore
+	case "ZCARD":
+		return s.handleZCard
+	case "ZRANK":
+		return func(c *client, args []string) error { return s.handleZRank(c, args, false) }
+	case "ZREVRANK":
+		return func(c *client, args []string) error { return s.handleZRank(c, args, true) }
+	case "ZRANGE":
+		return s.handleZRange
+	case "ZRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGE":
+		return func(c *client, args []string) error { return s.handleZRangeBy(c, args, command) }
+	case "ZCOUNT":
+		return s.handleZCount
+	case "ZPOPMIN":
+		return func(c *client, args []string) error { return s.handleZPop(c, args, false) }
+	case "ZPOPMAX":
+		return func(c *client, args []string) error { return s.handleZPop(c, args, true) }
+	case "HSET":
+		return s.handleHSet
+	case "HGET":
+		return s.handleHGet
+	case "HDEL":
+		return s.handleHDel
+	case "HGETALL":
+		return s.handleHGetAll
+	case "HEXISTS":
+		return s.handleHExists
+	case "HLEN":
+		return s.handleHLen
+	case "HINCRBY":
+		return s.handleHIncrBy
+	case "HINCRBYFLOAT":
+		return s.handleHIncrByFloat
+	case "HSCAN":
+		return s.handleHScan
+	case "LPUSH", "RPUSH", "LPUSHX", "RPUSHX":
+		return func(c *client, args []string) error { return s.handlePush(c, args, command) }
+	case "LPOP":
+		return func(c *client, args []string) error { return s.handlePop(c, args, true) }
+	case "RPOP":
+		return func(c *client, args []string) error { return s.handlePop(c, args, false) }
+	case "LLEN":
+		return s.handleLLen
+	case "LRANGE":
+		return s.handleLRange
+	case "LINDEX":
+		return s.handleLIndex
+	case "LSET":
+		return s.handleLSet
+	case "LINSERT":
+		return s.handleLInsert
+	case "LPOS":
+		return s.handleLPos
+	case "LREM":
+		return s.handleLRem
+	case "LTRIM":
+		return s.handleLTrim
+	case "BLPOP":
+		return func(c *client, args []string) error { return s.handleBlockingPop(c, args, true) }
+	case "BRPOP":
+		return func(c *client, args []string) error { return s.handleBlockingPop(c, args, false) }
+	case "LMOVE":
+		return s.handleLMove
+	case "BLMOVE":
+		return s.handleBLMove
+	case "XADD":
+		return s.handleXAdd
+	case "XLEN":
+		return s.handleXLen
+	case "XRANGE":
+		return func(c *client, args []string) error { return s.handleXRange(c, args, false) }
+	case "XREVRANGE":
+		return func(c *client, args []string) error { return s.handleXRange(c, args, true) }
+	case "XDEL":
+		return s.handleXDel
+	case "XTRIM":
+		return s.handleXTrim
+	case "XREAD":
+		return s.handleXRead
+	case "XGROUP":
+		return s.handleXGroup
+	case "XREADGROUP":
+		return s.handleXReadGroup
+	case "XACK":
+		return s.handleXAck
+	case "XPENDING":
+		return s.handleXPending
+	case "SUBSCRIBE":
+		return func(c *client, args []string) error { return s.handleSubscribe(c, args, false) }
+	case "PSUBSCRIBE":
+		return func(c *client, args []string) error { return s.handleSubscribe(c, args, true) }
+	case "UNSUBSCRIBE":
+		return func(c *client, args []string) error { return s.handleUnsubscribe(c, args, false) }
+	case "PUNSUBSCRIBE":
+		return func(c *client, args []string) error { return s.handleUnsubscribe(c, args, true) }
+	case "PUBLISH":
+		return s.handlePublish
+	case "PUBSUB":
+		return s.handlePubSub
+	case "CONFIG":
+		return s.handleConfig
+	case "MULTI":
+		return s.handleMulti
+	case "EXEC":
+		return s.handleExec
+	case "DISCARD":
+		return s.handleDiscard
+	case "WATCH":
+		return s.handleWatch
+	case "UNWATCH":
+		return s.handleUnwatch
+	case "SAVE":
+		return s.handleSave
+	case "BGSAVE":
+		return s.handleBgSave
+	case "LASTSAVE":
+		return s.handleLastSave
+	case "BGREWRITEAOF":
+		return s.handleBgRewriteAOF
+	case "INFO":
+		return s.handleInfo
+	case "OBJECT":
+		return s.handleObject
+	case "MEMORY":
+		return s.handleMemory
+	case "SLOWLOG":
+		return s.handleSlowlog
+	case "MONITOR":
+		return s.handleMonitor
+	case "CLIENT":
+		return s.handleClient
+	case "HELLO":
+		return s.handleHello
+	case "PING":
+		return s.handlePing
+	case "ECHO":
+		return s.handleEcho
+	case "SELECT":
+		return s.handleSelect
+	case "COMMAND":
+		return s.handleCommand
+	case "EXIT", "QUIT":
+		return func(c *client, _ []string) error {
+			if c.proto == 0 {
+				c.reply.Status("Goodbye!")
+			} else {
+				c.reply.Status("OK")
+			}
+			c.quit = true
+			return nil
+		}
+	case "SHUTDOWN":
+		return s.handleShutdown
 	case "HELP":
-		return s.handleHelp(conn)
-	default:
-		return fmt.Errorf("unknown command")
+		return func(c *client, _ []string) error { return s.handleHelp(c) }
 	}
+	return nil
 }
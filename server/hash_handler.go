@@ -0,0 +1,176 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/idis"
+	"strconv"
+	"strings"
+)
+
+func (s *Server) handleHSet(c *client, args []string) error {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return fmt.Errorf("usage: HSET key field value [field value ...]")
+	}
+	fields := make([]idis.FieldValue, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, idis.FieldValue{Field: args[i], Value: args[i+1]})
+	}
+	n, err := s.store.HSet(args[0], fields...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleHGet(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: HGET key field")
+	}
+	val, ok, err := s.store.HGet(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Bulk(val)
+	}
+	return nil
+}
+
+func (s *Server) handleHDel(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: HDEL key field1 field2 ... fieldN")
+	}
+	n, err := s.store.HDel(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleHGetAll(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: HGETALL key")
+	}
+	fields, err := s.store.HGetAll(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Map(len(fields))
+	for _, fv := range fields {
+		c.reply.Bulk(fv.Field)
+		c.reply.Bulk(fv.Value)
+	}
+	return nil
+}
+
+func (s *Server) handleHExists(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: HEXISTS key field")
+	}
+	ok, err := s.store.HExists(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if ok {
+		c.reply.Int(1)
+	} else {
+		c.reply.Int(0)
+	}
+	return nil
+}
+
+func (s *Server) handleHLen(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: HLEN key")
+	}
+	n, err := s.store.HLen(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleHIncrBy(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: HINCRBY key field increment")
+	}
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return idis.ErrNotInteger
+	}
+	n, err := s.store.HIncrBy(args[0], args[1], delta)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(n)
+	return nil
+}
+
+func (s *Server) handleHIncrByFloat(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: HINCRBYFLOAT key field increment")
+	}
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return fmt.Errorf("value is not a valid float")
+	}
+	val, err := s.store.HIncrByFloat(args[0], args[1], delta)
+	if err != nil {
+		return err
+	}
+	c.reply.Bulk(val)
+	return nil
+}
+
+// handleHScan serves HSCAN key cursor [MATCH pattern] [COUNT count].
+func (s *Server) handleHScan(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: HSCAN key cursor [MATCH pattern] [COUNT count]")
+	}
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid cursor")
+	}
+
+	match, count := "", 10
+	opts := args[2:]
+	for i := 0; i < len(opts); i++ {
+		if i+1 >= len(opts) {
+			return fmt.Errorf("syntax error")
+		}
+		switch strings.ToUpper(opts[i]) {
+		case "MATCH":
+			match = opts[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(opts[i+1])
+			if err != nil {
+				return idis.ErrNotInteger
+			}
+			if n < 1 {
+				return fmt.Errorf("syntax error")
+			}
+			count = n
+		default:
+			return fmt.Errorf("syntax error")
+		}
+		i++
+	}
+
+	next, fields, err := s.store.HScan(args[0], cursor, match, count)
+	if err != nil {
+		return err
+	}
+	c.reply.Array(2)
+	c.reply.Bulk(strconv.FormatUint(next, 10))
+	c.reply.Array(len(fields) * 2)
+	for _, fv := range fields {
+		c.reply.Bulk(fv.Field)
+		c.reply.Bulk(fv.Value)
+	}
+	return nil
+}
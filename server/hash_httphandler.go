@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-idis/internal/idis"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerHGetAll returns an HTTP handler for retrieving a hash as a JSON object.
+func (s *Server) handlerHGetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := s.store.HGetAll(key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving hash '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		fields := make(map[string]string, len(entries))
+		for _, fv := range entries {
+			fields[fv.Field] = fv.Value
+		}
+		response := map[string]interface{}{
+			"key":    key,
+			"fields": fields,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerHSet returns an HTTP handler for setting hash fields from a JSON object.
+// Fields not present in the body are left untouched.
+func (s *Server) handlerHSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for fields
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body) == 0 {
+			http.Error(w, "Invalid request body. Expected a non-empty JSON object of string fields.", http.StatusBadRequest)
+			return
+		}
+
+		fields := make([]idis.FieldValue, 0, len(body))
+		for f, v := range body {
+			fields = append(fields, idis.FieldValue{Field: f, Value: v})
+		}
+		added, err := s.store.HSet(key, fields...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error setting fields of key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"added": added}}, http.StatusOK, nil)
+	}
+}
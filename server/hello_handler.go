@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/idis"
+	"strconv"
+	"strings"
+)
+
+// Version is reported to clients by HELLO.
+const Version = "1.0.0"
+
+// handleHello negotiates the RESP protocol version and replies with server details.
+func (s *Server) handleHello(c *client, args []string) error {
+	if c.proto == 0 {
+		return fmt.Errorf("HELLO is only supported on the RESP listener")
+	}
+
+	proto := c.proto
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("Protocol version is not an integer or out of range")
+		}
+		if version < 2 || version > 3 {
+			return &idis.CodedError{Code: "NOPROTO", Msg: "unsupported protocol version"}
+		}
+		proto = version
+		args = args[1:]
+	}
+
+	name := c.name
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return fmt.Errorf("syntax error")
+			}
+			return fmt.Errorf("AUTH <password> called without any password configured for the default user")
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return fmt.Errorf("syntax error")
+			}
+			name = args[i+1]
+			i++
+		default:
+			return fmt.Errorf("syntax error in HELLO option '%s'", args[i])
+		}
+	}
+
+	c.proto = proto
+	c.setName(name)
+	if w, ok := c.reply.(*respWriter); ok {
+		w.proto = proto
+	}
+
+	c.reply.Map(7)
+	c.reply.Bulk("server")
+	c.reply.Bulk("go-idis")
+	c.reply.Bulk("version")
+	c.reply.Bulk(Version)
+	c.reply.Bulk("proto")
+	c.reply.Int(int64(proto))
+	c.reply.Bulk("id")
+	c.reply.Int(c.id)
+	c.reply.Bulk("mode")
+	c.reply.Bulk("standalone")
+	c.reply.Bulk("role")
+	c.reply.Bulk("master")
+	c.reply.Bulk("modules")
+	c.reply.Array(0)
+	return nil
+}
+
+func (s *Server) handlePing(c *client, args []string) error {
+	if len(args) <= 1 && c.subscribed() && c.proto < 3 {
+		// Subscribers get a pong message like any other pushed message
+		c.reply.Array(2)
+		c.reply.Bulk("pong")
+		c.reply.Bulk(strings.Join(args, ""))
+		return nil
+	}
+	switch len(args) {
+	case 0:
+		c.reply.Status("PONG")
+	case 1:
+		c.reply.Bulk(args[0])
+	default:
+		return fmt.Errorf("usage: PING [message]")
+	}
+	return nil
+}
+
+func (s *Server) handleEcho(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ECHO message")
+	}
+	c.reply.Bulk(args[0])
+	return nil
+}
+
+// handleSelect accepts database 0 only; go-idis has a single keyspace.
+func (s *Server) handleSelect(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: SELECT index")
+	}
+	if args[0] != "0" {
+		return fmt.Errorf("DB index is out of range")
+	}
+	c.reply.Status("OK")
+	return nil
+}
+
+// handleCommand answers the introspection calls made by redis-cli and client
+// libraries on connect. Command documentation is not available.
+func (s *Server) handleCommand(c *client, args []string) error {
+	if len(args) > 0 && strings.ToUpper(args[0]) == "DOCS" {
+		c.reply.Map(0)
+		return nil
+	}
+	c.reply.Array(0)
+	return nil
+}
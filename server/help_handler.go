@@ -1,11 +1,8 @@
 package server
 
-import (
-	"fmt"
-	"net"
-)
+import "strings"
 
-func (s *Server) handleHelp(conn net.Conn) error {
+func (s *Server) handleHelp(c *client) error {
 	helpText := `Available commands and their usage:
 
 1. SET key value1 value2 ...
@@ -61,8 +58,236 @@ func (s *Server) handleHelp(conn net.Conn) error {
 13. HELP
     - Displays this help message.
 
+14. PING [message]
+    - Replies with PONG, or with the message when one is given.
+    - Example: PING
+
+15. ECHO message
+    - Replies with the given message.
+    - Example: ECHO hello
+
+16. HELLO [2|3] [SETNAME name]
+    - Negotiates the RESP protocol version on the RESP listener (port 6379).
+    - Example: HELLO 3
+
+17. TYPE key
+    - Returns the type of the value stored at key: string, list, set, zset, hash, stream or none.
+    - Keys created by SET and SETUQ are lists.
+    - Example: TYPE mykey
+
+18. SETSTR key value / GETSTR key
+    - Stores or retrieves a single string value.
+    - Example: SETSTR greeting hello
+
+19. INCR key / DECR key / INCRBY key n / DECRBY key n
+    - Increments or decrements the integer stored as a string at key.
+    - Example: INCRBY counter 5
+
+20. APPEND key value / STRLEN key
+    - Appends to the string at key, or returns its length.
+    - Example: APPEND greeting " world"
+
+21. SADD key member1 member2 ... / SREM key member1 member2 ...
+    - Adds or removes members of the set stored at key.
+    - Example: SADD tags go redis
+
+22. SMEMBERS key / SISMEMBER key member / SCARD key
+    - Returns all members, checks membership, or counts the members of a set.
+    - Example: SISMEMBER tags go
+
+23. ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+    - Adds members with scores to the sorted set stored at key.
+    - Example: ZADD board 100 alice 85 bob
+
+24. ZREM key member ... / ZSCORE key member / ZCARD key
+    - Removes members, returns the score of a member, or counts the members.
+    - Example: ZSCORE board alice
+
+25. ZRANK key member / ZREVRANK key member
+    - Returns the 0-based position of a member by ascending or descending score.
+    - Example: ZREVRANK board alice
+
+26. ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+    - Returns members by index, score or lexicographical range.
+    - ZRANGEBYSCORE, ZRANGEBYLEX and ZREVRANGE are also available.
+    - Example: ZRANGE board 0 -1 WITHSCORES
+    - Example: ZRANGE board (90 +inf BYSCORE
+
+27. ZCOUNT key min max
+    - Counts members with a score between min and max.
+    - Example: ZCOUNT board 80 100
+
+28. ZPOPMIN key [count] / ZPOPMAX key [count]
+    - Removes and returns the members with the lowest or highest scores.
+    - Example: ZPOPMAX board
+
+29. HSET key field value [field value ...] / HGET key field / HDEL key field ...
+    - Sets, retrieves or removes fields of the hash stored at key.
+    - Example: HSET user:1 name alice age 30
+
+30. HGETALL key / HEXISTS key field / HLEN key
+    - Returns all fields and values, checks a field, or counts the fields of a hash.
+    - Example: HGETALL user:1
+
+31. HINCRBY key field n / HINCRBYFLOAT key field n
+    - Increments the integer or float stored in a hash field.
+    - Example: HINCRBYFLOAT user:1 balance 2.5
+
+32. HSCAN key cursor [MATCH pattern] [COUNT count]
+    - Iterates the fields of a hash. Start with cursor 0 and stop when 0 is returned.
+    - Example: HSCAN user:1 0 MATCH a*
+
+33. LPUSH key element ... / RPUSH key element ... / LPUSHX / RPUSHX
+    - Pushes elements to the head or tail of a list; the X forms only push to existing lists.
+    - Example: RPUSH queue job1 job2
+
+34. LPOP key [count] / RPOP key [count] / LLEN key
+    - Removes and returns elements from the head or tail of a list, or returns its length.
+    - Example: LPOP queue
+
+35. LRANGE key start stop / LINDEX key index / LSET key index element
+    - Reads a range or a single element, or replaces an element. Negative indices count from the tail.
+    - Example: LRANGE queue 0 -1
+
+36. LINSERT key BEFORE|AFTER pivot element / LPOS key element [RANK r] [COUNT n] [MAXLEN m]
+    - Inserts next to the first occurrence of pivot, or finds the positions of an element.
+    - Example: LPOS queue job2
+
+37. LREM key count element / LTRIM key start stop
+    - Removes occurrences of an element (count > 0 from the head, < 0 from the tail, 0 all), or keeps only a range.
+    - Example: LTRIM log 0 99
+
+38. BLPOP key [key ...] timeout / BRPOP key [key ...] timeout
+    - Pops from the first non-empty list, waiting up to timeout seconds (0 waits forever) for one to be pushed to.
+    - Waiting clients are served in arrival order.
+    - Example: BLPOP queue 5
+
+39. LMOVE source destination LEFT|RIGHT LEFT|RIGHT / BLMOVE ... timeout
+    - Moves an element between lists; BLMOVE waits for source like BLPOP.
+    - Example: BLMOVE queue processing LEFT RIGHT 0
+
+40. XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold] *|id field value ...
+    - Appends an entry to a stream and returns its ID. Use * for an automatic ID.
+    - Example: XADD events MAXLEN 1000 * type login user alice
+
+41. XRANGE key start end [COUNT n] / XREVRANGE key end start [COUNT n] / XLEN key
+    - Reads entries by ID range; - and + are the smallest and greatest IDs.
+    - Example: XRANGE events - + COUNT 10
+
+42. XDEL key id ... / XTRIM key MAXLEN|MINID [=|~] threshold
+    - Deletes entries by ID, or trims a stream to a length or minimum ID.
+    - Example: XTRIM events MAXLEN 100
+
+43. XREAD [COUNT n] [BLOCK ms] STREAMS key ... id ...
+    - Reads entries after the given IDs; $ means only new entries. BLOCK 0 waits forever.
+    - Example: XREAD BLOCK 5000 STREAMS events $
+
+44. XGROUP CREATE key group id|$ [MKSTREAM] / DESTROY / SETID / CREATECONSUMER / DELCONSUMER
+    - Manages consumer groups, which track delivered and pending entries.
+    - Example: XGROUP CREATE events workers $ MKSTREAM
+
+45. XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] [NOACK] STREAMS key ... id ...
+    - Reads as a group consumer; > delivers new entries, other IDs replay the consumer's pending ones.
+    - Example: XREADGROUP GROUP workers w1 COUNT 10 STREAMS events >
+
+46. XACK key group id ... / XPENDING key group [start end count [consumer]]
+    - Acknowledges processed entries, or lists entries delivered but not acknowledged.
+    - Example: XACK events workers 1700000000000-0
+
+47. SUBSCRIBE channel ... / PSUBSCRIBE pattern ... / UNSUBSCRIBE / PUNSUBSCRIBE
+    - Receives messages published to channels, or to channels matching glob patterns.
+    - While subscribed, only subscription commands, PING and QUIT are accepted (RESP3 clients excepted).
+    - Example: PSUBSCRIBE news.*
+
+48. PUBLISH channel message / PUBSUB CHANNELS [pattern] / PUBSUB NUMSUB channel ... / PUBSUB NUMPAT
+    - Publishes a message and returns how many subscribers received it, or inspects subscriptions.
+    - Example: PUBLISH news.tech "hello"
+
+49. CONFIG GET pattern ... / CONFIG SET parameter value ... / CONFIG REWRITE
+    - Reads or changes settings; addresses, file names and intervals are only read at startup.
+    - CONFIG REWRITE saves the settings in effect to the configuration file given with -config.
+    - notify-keyspace-events publishes key changes on
+      __keyspace@0__:<key> (K) and __keyevent@0__:<event> (E) for the chosen classes:
+      g generic, $ string, l list, s set, h hash, z sorted set, t stream, x expired, e evicted, A all.
+    - appendfsync sets how often the append-only file is synced to disk: always, everysec or no.
+    - snapshot-format (json or binary) and snapshot-compression (yes or no) choose how dumps are
+      written; files ending in .json are always JSON and files ending in .snap always binary.
+    - slowlog-log-slower-than (microseconds, negative to disable) and slowlog-max-len set what
+      the slow log keeps, see SLOWLOG.
+    - runtime-memory-limit sets a soft memory limit for the Go runtime, such as 512mb; 0 for none.
+    - maxmemory caps the memory used by the data, such as 100mb; 0 for none. Once it is reached,
+      writes evict keys chosen by maxmemory-policy: allkeys-lru, allkeys-lfu, allkeys-random,
+      volatile-lru, volatile-lfu, volatile-random (keys with a TTL only), volatile-ttl (nearest
+      expiry first) or noeviction, which fails writes with an OOM error instead.
+      maxmemory-samples sets how many keys are sampled per eviction; more is closer to exact.
+    - Example: CONFIG SET notify-keyspace-events KEA
+
+50. MULTI / EXEC / DISCARD / WATCH key ... / UNWATCH
+    - MULTI queues the following commands and EXEC runs them as one atomic step.
+    - EXEC returns nil without running anything if a key named by WATCH was modified meanwhile.
+    - Example: WATCH src, MULTI, REMOVE src v, SET dst v, EXEC
+
+51. BGREWRITEAOF / INFO [section ...]
+    - BGREWRITEAOF compacts the append-only file in the background into the fewest records
+      rebuilding the current data; writes made meanwhile are carried over.
+    - INFO reports server status in the server, clients, memory, persistence, stats and keyspace
+      sections: uptime, connected clients, command and error counts, key and expiry counts, the
+      reverse lookup size, used memory and evictions, the last snapshot and rewrite progress.
+      Name sections to see only those; commandstats, with the calls, time and errors of every
+      command, is only reported when named or with INFO all.
+    - Example: INFO persistence
+
+52. SAVE / BGSAVE / LASTSAVE
+    - SAVE writes a snapshot to the dump file and replies once it is on disk; BGSAVE writes it in
+      the background. Snapshots are written to a temporary file and renamed into place.
+    - LASTSAVE returns the Unix time of the last successful snapshot.
+    - Example: BGSAVE
+
+53. SHUTDOWN [SAVE|NOSAVE]
+    - Stops the server: new connections are refused, running commands finish, the append-only
+      file is closed and a final snapshot is written, unless NOSAVE is given or save-interval is 0
+      and SAVE is not. SIGINT and SIGTERM do the same without an option.
+    - Example: SHUTDOWN NOSAVE
+
+54. OBJECT ENCODING|IDLETIME|FREQ key / MEMORY USAGE key [SAMPLES count] / MEMORY STATS
+    - OBJECT reports the internal representation of a value, the seconds since the key was last
+      read or written and its logarithmic access frequency, as used by LFU eviction.
+    - MEMORY USAGE estimates the bytes held by a key, counting its entries in the reverse lookup;
+      collections are estimated from 32 elements, or SAMPLES of them, 0 for all.
+    - MEMORY STATS reports the memory used by the data, per key and by the reverse lookup.
+    - Inspecting a key does not count as an access; missing keys return nil.
+    - Example: MEMORY USAGE mylist SAMPLES 0
+
+55. SLOWLOG GET [count] / SLOWLOG LEN / SLOWLOG RESET
+    - Commands and HTTP requests taking at least slowlog-log-slower-than microseconds are logged
+      with an ID, the Unix time, the duration in microseconds, the arguments (or method and path),
+      the client address and the client name, "http" for HTTP requests. The latest
+      slowlog-max-len entries are kept. Blocking commands and event streams are not logged.
+    - GET returns the 10 latest entries, newest first, or count of them, -1 for all.
+    - Example: CONFIG SET slowlog-log-slower-than 1000, SLOWLOG GET 5
+
+56. MONITOR
+    - Streams every command run by any client, and every HTTP request, as it happens, one line
+      each with the Unix time, the source (telnet, resp or http), the client address and the
+      quoted arguments. Only QUIT is accepted afterwards. A monitor that cannot keep up is
+      disconnected.
+    - Example: MONITOR
+
+57. CLIENT LIST [ID id ...] / CLIENT INFO / CLIENT ID / CLIENT SETNAME name / CLIENT GETNAME
+    CLIENT KILL addr / CLIENT KILL [ID id] [ADDR addr] [NAME name] [SKIPME yes|no]
+    - LIST reports one line per telnet and RESP client with its ID, addresses, listener, name,
+      age and idle seconds, flags (N normal, x in MULTI, P subscribed, b blocked, O monitor),
+      subscriptions, commands queued and last command. INFO reports the current client.
+    - SETNAME names the current client; names may not contain spaces. An empty name clears it.
+    - KILL disconnects the clients matching every filter and returns how many there were; the
+      current client is skipped unless SKIPME no is given. KILL addr replies OK, or an error if
+      no client has that address.
+    - Example: CLIENT SETNAME worker-1, CLIENT KILL NAME worker-1
+
+Operations against a key holding a different type fail with a WRONGTYPE error.
+
 For any issues or questions, please help yourself.
 `
-	fmt.Fprint(conn, helpText)
+	c.reply.Bulk(strings.TrimSuffix(helpText, "\n"))
 	return nil
 }
@@ -93,6 +93,169 @@ func (s *Server) handlerHelp() http.HandlerFunc {
       - Curl:
         curl -X GET http://localhost:1234/help
 
+14. TYPE key
+    - Returns the type of the value stored at key: string, list, set, zset, hash, stream or none.
+    - Example:
+      - Command: TYPE mykey
+      - Curl:
+        curl -X GET http://localhost:1234/type/mykey
+
+15. SETSTR key value / GETSTR key
+    - Stores or retrieves a single string value.
+    - Example:
+      - Command: SETSTR greeting hello
+      - Curl:
+        curl -X POST http://localhost:1234/setstr/greeting -d '"hello"'
+        curl -X GET http://localhost:1234/getstr/greeting
+
+16. SADD key member1 member2 ... / SREM key member1 ... / SMEMBERS key
+    - Adds, removes or lists the members of a set.
+    - Example:
+      - Command: SADD tags go redis
+      - Curl:
+        curl -X POST http://localhost:1234/sadd/tags -d '["go", "redis"]'
+        curl -X POST http://localhost:1234/srem/tags -d '["redis"]'
+        curl -X GET http://localhost:1234/smembers/tags
+
+17. ZADD key score member ... / ZREM key member ...
+    - Adds scored members to, or removes members from, a sorted set.
+    - ZADD flags (nx, xx, gt, lt, ch) are passed as query parameters.
+    - Example:
+      - Command: ZADD board 100 alice 85 bob
+      - Curl:
+        curl -X POST http://localhost:1234/zadd/board -d '[{"member": "alice", "score": 100}, {"member": "bob", "score": 85}]'
+        curl -X POST http://localhost:1234/zrem/board -d '["bob"]'
+
+18. ZSCORE key member / ZRANK key member
+    - Returns the score or the 0-based rank of a member.
+    - Example:
+      - Command: ZRANK board alice
+      - Curl:
+        curl -X GET http://localhost:1234/zscore/board/alice
+        curl -X GET "http://localhost:1234/zrank/board/alice?rev=true"
+
+19. ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+    - Returns members by index, score or lexicographical range.
+    - Example:
+      - Command: ZRANGE board 0 -1
+      - Curl:
+        curl -X GET "http://localhost:1234/zrange/board?start=0&stop=-1"
+        curl -X GET "http://localhost:1234/zrange/board?by=score&min=90&max=%2Binf&rev=true"
+
+20. ZCOUNT key min max / ZPOPMIN key [count] / ZPOPMAX key [count]
+    - Counts members in a score range, or pops the lowest or highest members.
+    - Example:
+      - Command: ZPOPMAX board
+      - Curl:
+        curl -X GET "http://localhost:1234/zcount/board?min=80&max=100"
+        curl -X POST "http://localhost:1234/zpopmax/board?count=1"
+
+21. HGETALL key / HSET key field value ...
+    - Returns a hash as a JSON object, or sets the fields given in a JSON object.
+    - Example:
+      - Command: HSET user:1 name alice age 30
+      - Curl:
+        curl -X GET http://localhost:1234/hash/user:1
+        curl -X POST http://localhost:1234/hash/user:1 -d '{"name": "alice", "age": "30"}'
+
+22. LPUSH/RPUSH key element ... / LPOP/RPOP key [count]
+    - Pushes to or pops from the head or tail of a list. Pass x=true to only push to existing lists.
+    - Example:
+      - Command: RPUSH queue job1 job2
+      - Curl:
+        curl -X POST http://localhost:1234/rpush/queue -d '["job1", "job2"]'
+        curl -X POST "http://localhost:1234/lpop/queue?count=1"
+
+23. LRANGE key start stop / LINDEX key index / LSET key index element
+    - Reads a range or a single element, or replaces an element. Negative indices count from the tail.
+    - Example:
+      - Command: LRANGE queue 0 -1
+      - Curl:
+        curl -X GET "http://localhost:1234/lrange/queue?start=0&stop=-1"
+        curl -X GET http://localhost:1234/lindex/queue/-1
+        curl -X POST http://localhost:1234/lset/queue/0 -d '"job0"'
+
+24. LINSERT / LPOS / LREM / LTRIM
+    - Inserts next to a pivot, finds positions, removes occurrences or trims a list.
+    - Example:
+      - Command: LTRIM log 0 99
+      - Curl:
+        curl -X POST http://localhost:1234/linsert/queue -d '{"position": "before", "pivot": "job2", "element": "job1.5"}'
+        curl -X GET "http://localhost:1234/lpos/queue/job2?rank=1&count=0"
+        curl -X POST "http://localhost:1234/lrem/queue/job2?count=0"
+        curl -X POST "http://localhost:1234/ltrim/log?start=0&stop=99"
+
+25. XADD key * field value ... / XRANGE key start end [COUNT n]
+    - Appends an entry built from a JSON object to a stream, or reads a range of entries.
+    - Example:
+      - Command: XADD events * type login
+      - Curl:
+        curl -X POST "http://localhost:1234/xadd/events?maxlen=1000" -d '{"type": "login", "user": "alice"}'
+        curl -X GET "http://localhost:1234/xrange/events?start=-&end=%2B&count=10"
+
+26. SUBSCRIBE channel / PUBLISH channel message
+    - Streams the messages of a channel as Server-Sent Events, or publishes a JSON string.
+    - Pass pattern=true to subscribe to a glob pattern such as news.*.
+    - Example:
+      - Command: PUBLISH news "hello"
+      - Curl:
+        curl -N http://localhost:1234/subscribe/news
+        curl -X POST http://localhost:1234/publish/news -d '"hello"'
+
+27. MULTI ... EXEC / WATCH
+    - Runs a batch of commands atomically and returns their results in order.
+    - Watch maps keys to versions from /version/{key}; the batch is aborted with 409 if any changed.
+    - Example:
+      - Command: MULTI, REMOVE src v, SET dst v, EXEC
+      - Curl:
+        curl -X GET http://localhost:1234/version/src
+        curl -X POST http://localhost:1234/tx -d '{"watch": {"src": 42}, "commands": [["REMOVE", "src", "v"], ["SET", "dst", "v"]]}'
+
+28. SAVE / BGSAVE / LASTSAVE
+    - Writes a snapshot to the dump file, now or in the background, and reports its progress,
+      the time of the last successful snapshot and the last error.
+    - Example:
+      - Command: BGSAVE
+      - Curl:
+        curl -X POST http://localhost:1234/admin/bgsave
+        curl -X GET http://localhost:1234/admin/lastsave
+
+29. OBJECT / MEMORY USAGE
+    - Describes a key without counting as an access: its type, encoding, approximate size in
+      bytes, creation and last access times, idle seconds and access frequency.
+    - Example:
+      - Command: OBJECT IDLETIME mykey
+      - Curl: curl -X GET http://localhost:1234/object/mykey
+
+30. INFO [section ...]
+    - Reports the INFO sections as JSON objects: server, clients, memory, persistence, stats and
+      keyspace by default, or those named with section, which may be repeated or comma separated.
+    - Example:
+      - Command: INFO memory keyspace
+      - Curl: curl -X GET "http://localhost:1234/info?section=memory,keyspace"
+
+31. /metrics
+    - Exports metrics in the Prometheus text format: calls, errors and latency histograms per
+      command and per HTTP route, and gauges for keys, keys with a TTL, connected clients, memory
+      and the age of the last snapshot.
+    - Example:
+      - Curl: curl -X GET http://localhost:1234/metrics
+
+32. MONITOR
+    - Streams every command and HTTP request as Server-Sent Events, each carrying a JSON object
+      with the Unix time, the source (telnet, resp or http), the client address and the arguments.
+    - Example:
+      - Command: MONITOR
+      - Curl: curl -N http://localhost:1234/monitor
+
+33. /admin/clients
+    - GET lists the telnet and RESP clients connected, as CLIENT LIST does, with their ID,
+      addresses, name, age and idle seconds, flags and last command.
+    - DELETE /admin/clients/{id} disconnects a client, 404 if there is none with that ID.
+    - Example:
+      - Command: CLIENT LIST, CLIENT KILL ID 7
+      - Curl: curl -X DELETE http://localhost:1234/admin/clients/7
+
 For any issues or questions, please help yourself.
 `
 
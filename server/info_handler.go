@@ -0,0 +1,215 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/config"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// infoField is one line of INFO output.
+type infoField struct {
+	name  string
+	value interface{}
+}
+
+// infoSection is a titled group of INFO fields.
+type infoSection struct {
+	name   string
+	fields func(s *Server) []infoField
+	// extra sections are only reported when named or with INFO all
+	extra bool
+}
+
+// infoSections lists the INFO sections in the order they are reported.
+var infoSections = []infoSection{
+	{name: "Server", fields: (*Server).serverInfo},
+	{name: "Clients", fields: (*Server).clientsInfo},
+	{name: "Memory", fields: (*Server).memoryInfo},
+	{name: "Persistence", fields: (*Server).persistenceInfo},
+	{name: "Stats", fields: (*Server).statsInfo},
+	{name: "Commandstats", fields: (*Server).commandstatsInfo, extra: true},
+	{name: "Keyspace", fields: (*Server).keyspaceInfo},
+}
+
+func (s *Server) serverInfo() []infoField {
+	uptime := time.Since(s.stats.started)
+	return []infoField{
+		{"go_idis_version", Version},
+		{"go_version", runtime.Version()},
+		{"os", runtime.GOOS},
+		{"arch", runtime.GOARCH},
+		{"process_id", os.Getpid()},
+		{"http_addr", s.httpAddr},
+		{"telnet_addr", s.telnetAddr},
+		{"resp_addr", s.respAddr},
+		{"config_file", s.cfg.Path()},
+		{"shards", s.cfg.Shards},
+		{"uptime_in_seconds", int64(uptime.Seconds())},
+		{"uptime_in_days", int64(uptime.Hours() / 24)},
+	}
+}
+
+func (s *Server) clientsInfo() []infoField {
+	telnet, resp := s.clientCounts()
+	return []infoField{
+		{"connected_clients", telnet + resp},
+		{"telnet_clients", telnet},
+		{"resp_clients", resp},
+	}
+}
+
+func (s *Server) memoryInfo() []infoField {
+	mem := s.store.MemoryStatus()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return []infoField{
+		{"used_memory", mem.UsedMemory},
+		{"used_memory_human", config.FormatHuman(mem.UsedMemory)},
+		{"used_memory_runtime", ms.HeapAlloc},
+		{"used_memory_runtime_human", config.FormatHuman(int64(ms.HeapAlloc))},
+		{"maxmemory", mem.MaxMemory},
+		{"maxmemory_human", config.FormatHuman(mem.MaxMemory)},
+		{"maxmemory_policy", mem.Policy},
+		{"maxmemory_samples", mem.Samples},
+		{"evicted_keys", mem.EvictedKeys},
+	}
+}
+
+func (s *Server) persistenceInfo() []infoField {
+	save := s.store.SaveStatus()
+	var lastSave int64
+	if !save.LastSave.IsZero() {
+		lastSave = save.LastSave.Unix()
+	}
+	lastSaveTime, currentSaveTime := int64(-1), int64(-1)
+	if save.LastStatus != "" {
+		lastSaveTime = int64(save.LastDuration.Seconds())
+	}
+	if save.InProgress {
+		currentSaveTime = int64(save.CurrentTime.Seconds())
+	}
+	lastSaveStatus := save.LastStatus
+	if lastSaveStatus == "" {
+		lastSaveStatus = "ok"
+	}
+
+	aof := s.store.AOFStatus()
+	lastRewrite, currentRewrite := int64(-1), int64(-1)
+	if aof.LastRewriteStatus != "" {
+		lastRewrite = int64(aof.LastRewriteDuration.Seconds())
+	}
+	if aof.RewriteInProgress {
+		currentRewrite = int64(aof.CurrentRewriteTime.Seconds())
+	}
+	lastStatus := aof.LastRewriteStatus
+	if lastStatus == "" {
+		lastStatus = "ok"
+	}
+	return []infoField{
+		{"dump_filename", save.Filename},
+		{"dump_changes_since_last_save", save.ChangesSinceSave},
+		{"dump_bgsave_in_progress", boolInt(save.InProgress)},
+		{"dump_keys_total", save.KeysTotal},
+		{"dump_keys_saved", save.KeysDone},
+		{"dump_saves", save.Saves},
+		{"dump_last_save_time", lastSave},
+		{"dump_last_bgsave_status", lastSaveStatus},
+		{"dump_last_bgsave_time_sec", lastSaveTime},
+		{"dump_current_bgsave_time_sec", currentSaveTime},
+		{"aof_enabled", boolInt(aof.Enabled)},
+		{"aof_fsync", aof.FsyncPolicy},
+		{"aof_rewrite_in_progress", boolInt(aof.RewriteInProgress)},
+		{"aof_rewrites", aof.Rewrites},
+		{"aof_last_rewrite_time_sec", lastRewrite},
+		{"aof_current_rewrite_time_sec", currentRewrite},
+		{"aof_last_bgrewrite_status", lastStatus},
+		{"aof_last_write_status", aof.LastWriteStatus},
+		{"aof_current_size", aof.CurrentSize},
+		{"aof_base_size", aof.BaseSize},
+	}
+}
+
+func (s *Server) statsInfo() []infoField {
+	return []infoField{
+		{"total_connections_received", s.stats.connections.Load()},
+		{"total_commands_processed", s.stats.processed.Load()},
+		{"total_error_replies", s.stats.failed.Load()},
+		{"total_http_requests", s.stats.httpRequests.Load()},
+		{"pubsub_channels", len(s.broker.Channels(""))},
+		{"pubsub_patterns", s.broker.NumPat()},
+	}
+}
+
+func (s *Server) commandstatsInfo() []infoField {
+	counts := s.stats.commandCounts()
+	fields := make([]infoField, len(counts))
+	for i, cc := range counts {
+		fields[i] = infoField{
+			"cmdstat_" + strings.ToLower(cc.name),
+			fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f,failed_calls=%d",
+				cc.calls, cc.sum.Microseconds(), float64(cc.sum.Microseconds())/float64(max(cc.calls, 1)), cc.failed),
+		}
+	}
+	return fields
+}
+
+func (s *Server) keyspaceInfo() []infoField {
+	stats := s.store.MemoryStats()
+	return []infoField{
+		{"db0", fmt.Sprintf("keys=%d,expires=%d", stats.Keys, stats.Expires)},
+		{"reverse_index_values", stats.IndexValues},
+		{"reverse_index_entries", stats.IndexEntries},
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// selectInfo returns the sections named by args, case-insensitively. With
+// none, or "default", every section but the extra ones is returned; "all"
+// and "everything" add those.
+func selectInfo(args []string) []infoSection {
+	wanted := make(map[string]bool, len(args))
+	defaults, all := len(args) == 0, false
+	for _, arg := range args {
+		switch arg = strings.ToLower(arg); arg {
+		case "default":
+			defaults = true
+		case "all", "everything":
+			all = true
+		default:
+			wanted[arg] = true
+		}
+	}
+
+	var sections []infoSection
+	for _, section := range infoSections {
+		if all || (defaults && !section.extra) || wanted[strings.ToLower(section.name)] {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// handleInfo serves INFO [section ...], see selectInfo.
+func (s *Server) handleInfo(c *client, args []string) error {
+	var b strings.Builder
+	for _, section := range selectInfo(args) {
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", section.name)
+		for _, f := range section.fields(s) {
+			fmt.Fprintf(&b, "%s:%v\r\n", f.name, f.value)
+		}
+	}
+	c.reply.Bulk(b.String())
+	return nil
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// handlerInfo returns an HTTP handler reporting the INFO sections as a JSON
+// object per section, e.g. /info?section=memory,keyspace. Sections are
+// selected as by INFO; without any, the default ones are reported.
+func (s *Server) handlerInfo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var args []string
+		for _, v := range r.URL.Query()["section"] {
+			args = append(args, strings.Split(v, ",")...)
+		}
+
+		response := make(map[string]interface{})
+		for _, section := range selectInfo(args) {
+			fields := make(map[string]interface{})
+			for _, f := range section.fields(s) {
+				fields[f.name] = f.value
+			}
+			response[strings.ToLower(section.name)] = fields
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
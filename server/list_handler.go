@@ -0,0 +1,249 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"strconv"
+	"strings"
+)
+
+// atoi parses a command argument as an integer.
+func atoi(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, idis.ErrNotInteger
+	}
+	return n, nil
+}
+
+// handlePush serves LPUSH, RPUSH, LPUSHX and RPUSHX.
+func (s *Server) handlePush(c *client, args []string, name string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s key element1 element2 ... elementN", name)
+	}
+	left := name[0] == 'L'
+	onlyExisting := strings.HasSuffix(name, "X")
+	n, err := s.store.Push(args[0], left, onlyExisting, args[1:]...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handlePop serves LPOP and RPOP. Without a count a single element is
+// returned; with one, an array.
+func (s *Server) handlePop(c *client, args []string, left bool) error {
+	if len(args) < 1 || len(args) > 2 {
+		if left {
+			return fmt.Errorf("usage: LPOP key [count]")
+		}
+		return fmt.Errorf("usage: RPOP key [count]")
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	items, err := s.store.Pop(args[0], left, count)
+	if errors.Is(err, idis.ErrKeyNotFound) {
+		c.reply.Null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		c.reply.Strings(items)
+	} else {
+		c.reply.Bulk(items[0])
+	}
+	return nil
+}
+
+func (s *Server) handleLLen(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: LLEN key")
+	}
+	n, err := s.store.LLen(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleLRange(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: LRANGE key start stop")
+	}
+	start, err := atoi(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := atoi(args[2])
+	if err != nil {
+		return err
+	}
+	items, err := s.store.LRange(args[0], start, stop)
+	if err != nil {
+		return err
+	}
+	c.reply.Strings(items)
+	return nil
+}
+
+func (s *Server) handleLIndex(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: LINDEX key index")
+	}
+	index, err := atoi(args[1])
+	if err != nil {
+		return err
+	}
+	item, ok, err := s.store.LIndex(args[0], index)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Bulk(item)
+	}
+	return nil
+}
+
+func (s *Server) handleLSet(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: LSET key index element")
+	}
+	index, err := atoi(args[1])
+	if err != nil {
+		return err
+	}
+	err = s.store.LSet(args[0], index, args[2])
+	if errors.Is(err, idis.ErrKeyNotFound) {
+		return fmt.Errorf("no such key")
+	}
+	if err != nil {
+		return err
+	}
+	c.reply.Status("OK")
+	return nil
+}
+
+func (s *Server) handleLInsert(c *client, args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: LINSERT key BEFORE|AFTER pivot element")
+	}
+	var before bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+	default:
+		return fmt.Errorf("syntax error")
+	}
+	n, err := s.store.LInsert(args[0], before, args[2], args[3])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleLPos serves LPOS key element [RANK rank] [COUNT num] [MAXLEN len].
+func (s *Server) handleLPos(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: LPOS key element [RANK rank] [COUNT num] [MAXLEN len]")
+	}
+	rank, count, maxLen := 1, 1, 0
+	withCount := false
+	opts := args[2:]
+	for i := 0; i < len(opts); i += 2 {
+		if i+1 >= len(opts) {
+			return fmt.Errorf("syntax error")
+		}
+		n, err := atoi(opts[i+1])
+		if err != nil {
+			return err
+		}
+		switch strings.ToUpper(opts[i]) {
+		case "RANK":
+			if n == 0 {
+				return fmt.Errorf("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return fmt.Errorf("COUNT can't be negative")
+			}
+			count, withCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return fmt.Errorf("MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+
+	positions, err := s.store.LPos(args[0], args[1], rank, count, maxLen)
+	if err != nil {
+		return err
+	}
+	if withCount {
+		c.reply.Array(len(positions))
+		for _, p := range positions {
+			c.reply.Int(int64(p))
+		}
+		return nil
+	}
+	if len(positions) == 0 {
+		c.reply.Null()
+	} else {
+		c.reply.Int(int64(positions[0]))
+	}
+	return nil
+}
+
+func (s *Server) handleLRem(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: LREM key count element")
+	}
+	count, err := atoi(args[1])
+	if err != nil {
+		return err
+	}
+	n, err := s.store.LRem(args[0], count, args[2])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleLTrim(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: LTRIM key start stop")
+	}
+	start, err := atoi(args[1])
+	if err != nil {
+		return err
+	}
+	stop, err := atoi(args[2])
+	if err != nil {
+		return err
+	}
+	if err := s.store.LTrim(args[0], start, stop); err != nil {
+		return err
+	}
+	c.reply.Status("OK")
+	return nil
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerPush returns an HTTP handler pushing a JSON array of elements to the
+// head, or the tail when left is false, of a list.
+func (s *Server) handlerPush(left bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for elements
+		var values []string
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil || len(values) == 0 {
+			http.Error(w, "Invalid request body. Expected a non-empty JSON array of elements.", http.StatusBadRequest)
+			return
+		}
+
+		n, err := s.store.Push(key, left, r.URL.Query().Get("x") == "true", values...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error pushing to key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"length": n}}, http.StatusOK, nil)
+	}
+}
+
+// handlerPop returns an HTTP handler popping elements from the head, or the
+// tail when left is false, of a list.
+func (s *Server) handlerPop(left bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		count, err := strconv.Atoi(queryDefault(r.URL.Query().Get("count"), "1"))
+		if err != nil || count < 0 {
+			http.Error(w, "Invalid count value", http.StatusBadRequest)
+			return
+		}
+
+		items, err := s.store.Pop(key, left, count)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error popping from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":      key,
+			"elements": items,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerLRange returns an HTTP handler for reading a range of a list,
+// e.g. /lrange/queue?start=0&stop=-1.
+func (s *Server) handlerLRange() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		start, err1 := strconv.Atoi(queryDefault(query.Get("start"), "0"))
+		stop, err2 := strconv.Atoi(queryDefault(query.Get("stop"), "-1"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid start or stop value", http.StatusBadRequest)
+			return
+		}
+
+		items, err := s.store.LRange(key, start, stop)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving range from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":      key,
+			"elements": items,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerLIndex returns an HTTP handler for reading the element at an index.
+func (s *Server) handlerLIndex() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key := vars["key"]
+		index, err := strconv.Atoi(vars["index"])
+		if err != nil {
+			http.Error(w, "Invalid index value", http.StatusBadRequest)
+			return
+		}
+
+		item, found, err := s.store.LIndex(key, index)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving index from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Index %d not found in key '%s'", index, key), http.StatusNotFound)
+			return
+		}
+
+		response := map[string]interface{}{
+			"index":   index,
+			"element": item,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerLSet returns an HTTP handler replacing the element at an index with
+// the JSON string in the request body.
+func (s *Server) handlerLSet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key := vars["key"]
+		index, err := strconv.Atoi(vars["index"])
+		if err != nil {
+			http.Error(w, "Invalid index value", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for the element
+		var value string
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON string.", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.store.LSet(key, index, value); err != nil {
+			status := statusFor(err)
+			if errors.Is(err, idis.ErrIndexOutOfRange) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, fmt.Sprintf("Error setting index of key '%s': %v", key, err), status)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: "OK"}, http.StatusOK, nil)
+	}
+}
+
+// linsertRequest is the body of an LINSERT request.
+type linsertRequest struct {
+	Position string `json:"position"` // "before" or "after"
+	Pivot    string `json:"pivot"`
+	Element  string `json:"element"`
+}
+
+// handlerLInsert returns an HTTP handler inserting an element next to a pivot.
+func (s *Server) handlerLInsert() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		var req linsertRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Position != "before" && req.Position != "after") {
+			http.Error(w, `Invalid request body. Expected {"position": "before"|"after", "pivot": ..., "element": ...}.`, http.StatusBadRequest)
+			return
+		}
+
+		n, err := s.store.LInsert(key, req.Position == "before", req.Pivot, req.Element)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error inserting into key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"length": n}}, http.StatusOK, nil)
+	}
+}
+
+// handlerLPos returns an HTTP handler for finding the positions of an element,
+// e.g. /lpos/queue/job?rank=-1&count=0&maxlen=100.
+func (s *Server) handlerLPos() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, element := vars["key"], vars["element"]
+
+		query := r.URL.Query()
+		rank, err1 := strconv.Atoi(queryDefault(query.Get("rank"), "1"))
+		count, err2 := strconv.Atoi(queryDefault(query.Get("count"), "0"))
+		maxLen, err3 := strconv.Atoi(queryDefault(query.Get("maxlen"), "0"))
+		if err1 != nil || err2 != nil || err3 != nil || rank == 0 || count < 0 || maxLen < 0 {
+			http.Error(w, "Invalid rank, count or maxlen value", http.StatusBadRequest)
+			return
+		}
+
+		positions, err := s.store.LPos(key, element, rank, count, maxLen)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error searching key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"element":   element,
+			"positions": positions,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerLRem returns an HTTP handler removing occurrences of an element,
+// e.g. /lrem/queue/job?count=-2.
+func (s *Server) handlerLRem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, element := vars["key"], vars["element"]
+
+		count, err := strconv.Atoi(queryDefault(r.URL.Query().Get("count"), "0"))
+		if err != nil {
+			http.Error(w, "Invalid count value", http.StatusBadRequest)
+			return
+		}
+
+		removed, err := s.store.LRem(key, count, element)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error removing from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"removed": removed}}, http.StatusOK, nil)
+	}
+}
+
+// handlerLTrim returns an HTTP handler trimming a list to a range,
+// e.g. /ltrim/log?start=0&stop=99 to keep the newest 100 entries.
+func (s *Server) handlerLTrim() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		start, err1 := strconv.Atoi(query.Get("start"))
+		stop, err2 := strconv.Atoi(query.Get("stop"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid start or stop value", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.store.LTrim(key, start, stop); err != nil {
+			http.Error(w, fmt.Sprintf("Error trimming key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: "OK"}, http.StatusOK, nil)
+	}
+}
@@ -2,10 +2,9 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleLoadDump(conn net.Conn, args []string) error {
+func (s *Server) handleLoadDump(c *client, args []string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("usage: LOADDUMP filepath")
 	}
@@ -14,6 +13,6 @@ func (s *Server) handleLoadDump(conn net.Conn, args []string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(conn, "Data successfully loaded from file: %s\n", filepath)
+	c.reply.Status("Data successfully loaded from file: " + filepath)
 	return nil
 }
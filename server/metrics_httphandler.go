@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsWriter renders metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	b bytes.Buffer
+}
+
+// family starts a metric family with its help text and type.
+func (m *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(&m.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of name with labels given as name, value pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.b.WriteString(name)
+	if len(labels) > 0 {
+		m.b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				m.b.WriteByte(',')
+			}
+			fmt.Fprintf(&m.b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.b.WriteByte('}')
+	}
+	m.b.WriteByte(' ')
+	m.b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.b.WriteByte('\n')
+}
+
+// single writes a metric family holding a single unlabelled sample.
+func (m *metricsWriter) single(name, typ, help string, value float64) {
+	m.family(name, typ, help)
+	m.sample(name, value)
+}
+
+// histograms writes the latency histograms of counts, labelled by labels.
+func (m *metricsWriter) histograms(name, help string, counts []callCount, labels func(cc callCount) []string) {
+	m.family(name, "histogram", help)
+	for _, cc := range counts {
+		l := labels(cc)
+		for i, le := range latencyBuckets {
+			m.sample(name+"_bucket", float64(cc.buckets[i]), append(l, "le", strconv.FormatFloat(le, 'g', -1, 64))...)
+		}
+		m.sample(name+"_bucket", float64(cc.calls), append(l, "le", "+Inf")...)
+		m.sample(name+"_sum", cc.sum.Seconds(), l...)
+		m.sample(name+"_count", float64(cc.calls), l...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// handlerMetrics returns an HTTP handler exporting the server statistics in
+// the Prometheus text format: calls, errors and latency histograms per
+// command and per HTTP route, and gauges for keys, clients, memory and
+// snapshots.
+func (s *Server) handlerMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var m metricsWriter
+
+		m.single("idis_uptime_seconds", "gauge", "Seconds since the server started.",
+			time.Since(s.stats.started).Seconds())
+
+		// Clients
+		telnet, resp := s.clientCounts()
+		m.family("idis_connected_clients", "gauge", "Clients connected, by listener.")
+		m.sample("idis_connected_clients", float64(telnet), "listener", "telnet")
+		m.sample("idis_connected_clients", float64(resp), "listener", "resp")
+		m.single("idis_connections_received_total", "counter", "TCP connections accepted.",
+			float64(s.stats.connections.Load()))
+
+		// Commands
+		commands := s.stats.commandCounts()
+		m.single("idis_commands_processed_total", "counter", "Commands run, including unknown ones.",
+			float64(s.stats.processed.Load()))
+		m.family("idis_commands_total", "counter", "Commands run, by command.")
+		for _, cc := range commands {
+			m.sample("idis_commands_total", float64(cc.calls), "command", strings.ToLower(cc.name))
+		}
+		m.family("idis_command_errors_total", "counter", "Commands that replied with an error, by command.")
+		for _, cc := range commands {
+			m.sample("idis_command_errors_total", float64(cc.failed), "command", strings.ToLower(cc.name))
+		}
+		m.histograms("idis_command_duration_seconds", "Time taken to run commands, by command.", commands,
+			func(cc callCount) []string { return []string{"command", strings.ToLower(cc.name)} })
+
+		// HTTP routes
+		routes := s.stats.routeCounts()
+		m.family("idis_http_requests_total", "counter", "HTTP requests, by method and route.")
+		for _, cc := range routes {
+			m.sample("idis_http_requests_total", float64(cc.calls), "method", cc.method, "route", cc.name)
+		}
+		m.family("idis_http_request_errors_total", "counter", "HTTP requests answered with a 4xx or 5xx status, by method and route.")
+		for _, cc := range routes {
+			m.sample("idis_http_request_errors_total", float64(cc.failed), "method", cc.method, "route", cc.name)
+		}
+		m.histograms("idis_http_request_duration_seconds", "Time taken to serve HTTP requests, by method and route.", routes,
+			func(cc callCount) []string { return []string{"method", cc.method, "route", cc.name} })
+
+		// Keyspace and memory
+		stats := s.store.MemoryStats()
+		m.single("idis_keys", "gauge", "Keys in the keyspace.", float64(stats.Keys))
+		m.single("idis_expiring_keys", "gauge", "Keys with a TTL.", float64(stats.Expires))
+		m.single("idis_reverse_index_values", "gauge", "Distinct values in the reverse lookup.", float64(stats.IndexValues))
+		m.single("idis_memory_used_bytes", "gauge", "Approximate bytes held by the keyspace.", float64(stats.UsedMemory))
+		m.single("idis_memory_max_bytes", "gauge", "The maxmemory limit, 0 for none.", float64(stats.MaxMemory))
+		m.single("idis_evicted_keys_total", "counter", "Keys evicted to stay within maxmemory.", float64(stats.EvictedKeys))
+
+		// Snapshots
+		save := s.store.SaveStatus()
+		var lastSave float64
+		since := s.stats.started
+		if !save.LastSave.IsZero() {
+			lastSave = float64(save.LastSave.Unix())
+			since = save.LastSave
+		}
+		m.single("idis_last_save_timestamp_seconds", "gauge", "Unix time of the last successful snapshot, 0 if none.", lastSave)
+		m.single("idis_last_save_age_seconds", "gauge", "Seconds since the last successful snapshot, or since the server started if none.",
+			time.Since(since).Seconds())
+		m.single("idis_changes_since_last_save", "gauge", "Changes not yet written to a snapshot.", float64(save.ChangesSinceSave))
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(m.b.Bytes())
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBuffer is the number of commands a monitor may fall behind by
+// before it is dropped, as Redis does once the output buffer limit is
+// reached.
+const monitorBuffer = 1024
+
+// monitor receives every command run while it is attached, see MONITOR.
+type monitor struct {
+	ch      chan monitorEvent // closed once removed
+	dropped atomic.Bool       // removed for falling behind
+}
+
+// monitorEvent is a command or HTTP request seen by the monitors.
+type monitorEvent struct {
+	time   time.Time
+	source string // "telnet", "resp" or "http"
+	addr   string
+	args   []string
+}
+
+// String formats the event as Redis does, with the source in place of the
+// database number:
+//
+//	1339518083.107412 [resp 127.0.0.1:60866] "SET" "key" "value"
+func (e monitorEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%s %s]", e.time.Unix(), e.time.Nanosecond()/1000, e.source, e.addr)
+	for _, arg := range e.args {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(arg))
+	}
+	return b.String()
+}
+
+// addMonitor attaches a new monitor.
+func (s *Server) addMonitor() *monitor {
+	m := &monitor{ch: make(chan monitorEvent, monitorBuffer)}
+	s.monitorsMu.Lock()
+	s.monitors[m] = struct{}{}
+	s.monitorCount.Store(int32(len(s.monitors)))
+	s.monitorsMu.Unlock()
+	return m
+}
+
+// removeMonitor detaches m and closes its channel, if it is still attached.
+func (s *Server) removeMonitor(m *monitor) {
+	s.monitorsMu.Lock()
+	defer s.monitorsMu.Unlock()
+	if _, ok := s.monitors[m]; ok {
+		delete(s.monitors, m)
+		close(m.ch)
+		s.monitorCount.Store(int32(len(s.monitors)))
+	}
+}
+
+// feedMonitors hands a command to the attached monitors, dropping those that
+// fell behind. Without monitors it only costs an atomic load.
+func (s *Server) feedMonitors(source, addr string, args []string) {
+	if s.monitorCount.Load() == 0 {
+		return
+	}
+	e := monitorEvent{time: time.Now(), source: source, addr: addr, args: append([]string(nil), args...)}
+
+	var behind []*monitor
+	s.monitorsMu.RLock()
+	for m := range s.monitors {
+		select {
+		case m.ch <- e:
+		default:
+			behind = append(behind, m)
+		}
+	}
+	s.monitorsMu.RUnlock()
+	for _, m := range behind {
+		m.dropped.Store(true)
+		s.removeMonitor(m)
+	}
+}
+
+// forwardMonitor writes the events of m to the client until m is removed.
+// A monitor dropped for falling behind has its connection closed.
+func (s *Server) forwardMonitor(c *client, m *monitor) {
+	forward(c, m.ch, func(e monitorEvent) { c.reply.Status(e.String()) })
+	if m.dropped.Load() {
+		c.conn.Close()
+	}
+}
+
+// handleMonitor serves MONITOR, which streams every command run by other
+// clients, and every HTTP request, to this one. Only QUIT is accepted
+// afterwards.
+func (s *Server) handleMonitor(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: MONITOR")
+	}
+	c.reply.Status("OK")
+	c.monitor = s.addMonitor()
+	go s.forwardMonitor(c, c.monitor)
+	return nil
+}
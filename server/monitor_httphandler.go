@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// handlerMonitor returns an HTTP handler streaming every command run and
+// every HTTP request served as Server-Sent Events, like MONITOR. Each event
+// carries a JSON object with the Unix time in seconds, the source protocol,
+// the client address and the arguments, or the method and path of requests.
+// A stream that falls behind is ended.
+func (s *Server) handlerMonitor() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		m := s.addMonitor()
+		defer s.removeMonitor(m)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": monitoring\n\n")
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case e, ok := <-m.ch:
+				if !ok {
+					// Dropped for falling behind
+					return
+				}
+				data, _ := json.Marshal(map[string]interface{}{
+					"time":   float64(e.time.UnixMicro()) / 1e6,
+					"source": e.source,
+					"addr":   e.addr,
+					"args":   e.args,
+				})
+				fmt.Fprintf(w, "event: command\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
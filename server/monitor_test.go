@@ -0,0 +1,23 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	s := newTestServer(t)
+	m, other := dial(t, s), dial(t, s)
+	expect(t, "MONITOR", m.do("MONITOR"), "OK")
+
+	for i := 0; i < 3; i++ {
+		expect(t, "SETSTR", other.do("SETSTR", "k", "v"), "OK")
+	}
+	for i := 0; i < 3; i++ {
+		line, ok := m.read().(string)
+		if !ok || !strings.HasSuffix(line, `"SETSTR" "k" "v"`) || !strings.Contains(line, "[resp ") {
+			t.Fatalf("monitor line = %q, want the SETSTR run over RESP", line)
+		}
+	}
+	expectError(t, "GETSTR while monitoring", m.do("GETSTR", "k"), "ERR Can't execute 'getstr'")
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// handleObject serves OBJECT ENCODING|IDLETIME|FREQ key. Missing keys get a
+// nil reply, and looking at a key does not count as an access.
+func (s *Server) handleObject(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: OBJECT ENCODING|IDLETIME|FREQ key")
+	}
+	sub := strings.ToUpper(args[0])
+	if sub != "ENCODING" && sub != "IDLETIME" && sub != "FREQ" {
+		return fmt.Errorf("unknown subcommand '%s', expected ENCODING, IDLETIME or FREQ", args[0])
+	}
+	info, err := s.store.Object(args[1])
+	if errors.Is(err, idis.ErrKeyNotFound) {
+		c.reply.Null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch sub {
+	case "ENCODING":
+		c.reply.Bulk(info.Encoding)
+	case "IDLETIME":
+		c.reply.Int(int64(info.Idle.Seconds()))
+	case "FREQ":
+		c.reply.Int(int64(info.Freq))
+	}
+	return nil
+}
+
+// handleMemory serves MEMORY USAGE key [SAMPLES count] and MEMORY STATS.
+// SAMPLES 0 measures every element of a collection.
+func (s *Server) handleMemory(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: MEMORY USAGE key [SAMPLES count] | STATS")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "USAGE":
+		samples := idis.MemoryUsageSamples
+		switch {
+		case len(args) == 2:
+		case len(args) == 4 && strings.EqualFold(args[2], "SAMPLES"):
+			n, err := strconv.Atoi(args[3])
+			if err != nil || n < 0 {
+				return fmt.Errorf("value is out of range, must be positive")
+			}
+			samples = n
+		default:
+			return fmt.Errorf("usage: MEMORY USAGE key [SAMPLES count]")
+		}
+		size, err := s.store.MemoryUsage(args[1], samples)
+		if errors.Is(err, idis.ErrKeyNotFound) {
+			c.reply.Null()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.reply.Int(size)
+	case "STATS":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: MEMORY STATS")
+		}
+		stats := s.store.MemoryStats()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		counts := []struct {
+			name  string
+			value int64
+		}{
+			{"total.allocated", int64(ms.HeapAlloc)},
+			{"dataset.bytes", stats.UsedMemory},
+			{"keys.count", int64(stats.Keys)},
+			{"keys.bytes-per-key", stats.BytesPerKey},
+			{"expires.count", int64(stats.Expires)},
+			{"index.values", int64(stats.IndexValues)},
+			{"index.entries", int64(stats.IndexEntries)},
+			{"maxmemory", stats.MaxMemory},
+			{"evicted.keys", stats.EvictedKeys},
+		}
+		c.reply.Map(len(counts) + 1)
+		for _, f := range counts {
+			c.reply.Bulk(f.name)
+			c.reply.Int(f.value)
+		}
+		c.reply.Bulk("maxmemory.policy")
+		c.reply.Bulk(stats.Policy)
+	default:
+		return fmt.Errorf("unknown subcommand '%s', expected USAGE or STATS", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerObject returns an HTTP handler describing the value stored at a key:
+// its type, encoding, approximate size, creation and last access times and
+// access frequency. Looking at a key does not count as an access.
+func (s *Server) handlerObject() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		info, err := s.store.Object(key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving object '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":          key,
+			"type":         info.Type,
+			"encoding":     info.Encoding,
+			"memory_usage": info.Size,
+			"created":      info.Created,
+			"last_access":  info.LastAccess,
+			"idle_seconds": int64(info.Idle.Seconds()),
+			"freq":         info.Freq,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/pubsub"
+	"strings"
+)
+
+// subscriberCommands are the commands RESP2 and telnet clients may run while
+// subscribed to at least one channel or pattern.
+var subscriberCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+	"EXIT":         true,
+}
+
+// subscribed reports whether the client has any active subscription.
+func (c *client) subscribed() bool {
+	return c.sub != nil && c.sub.Count() > 0
+}
+
+// forward writes the values received on ch to the client with write, under
+// c.mu, until ch is closed or writing fails.
+func forward[T any](c *client, ch <-chan T, write func(T)) {
+	for v := range ch {
+		c.mu.Lock()
+		write(v)
+		// Batch whatever else is already waiting into the same write
+	drain:
+		for {
+			select {
+			case more, ok := <-ch:
+				if !ok {
+					break drain
+				}
+				write(more)
+			default:
+				break drain
+			}
+		}
+		err := c.out.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// forwardMessages writes the messages published to sub to the client until
+// the subscriber is closed. A subscriber dropped for falling behind has its
+// connection closed, as Redis does once the output buffer limit is reached.
+func (s *Server) forwardMessages(c *client, sub *pubsub.Subscriber) {
+	forward(c, sub.Messages(), func(msg pubsub.Message) { writeMessage(c, msg) })
+	if sub.Dropped() {
+		c.conn.Close()
+	}
+}
+
+// writeMessage writes a message or pmessage push.
+func writeMessage(c *client, msg pubsub.Message) {
+	if msg.Pattern != "" {
+		c.reply.Push(4)
+		c.reply.Bulk("pmessage")
+		c.reply.Bulk(msg.Pattern)
+	} else {
+		c.reply.Push(3)
+		c.reply.Bulk("message")
+	}
+	c.reply.Bulk(msg.Channel)
+	c.reply.Bulk(msg.Payload)
+}
+
+// writeSubscription writes the confirmation of a (un)subscription.
+func writeSubscription(c *client, kind, name string, count int) {
+	c.reply.Push(3)
+	c.reply.Bulk(kind)
+	c.reply.Bulk(name)
+	c.reply.Int(int64(count))
+}
+
+// handleSubscribe serves SUBSCRIBE and, when pattern is set, PSUBSCRIBE.
+func (s *Server) handleSubscribe(c *client, args []string, pattern bool) error {
+	if len(args) == 0 {
+		if pattern {
+			return fmt.Errorf("usage: PSUBSCRIBE pattern [pattern ...]")
+		}
+		return fmt.Errorf("usage: SUBSCRIBE channel [channel ...]")
+	}
+	if c.sub == nil {
+		c.sub = s.broker.NewSubscriber(pubsub.DefaultBuffer)
+		go s.forwardMessages(c, c.sub)
+	}
+	for _, name := range args {
+		if pattern {
+			writeSubscription(c, "psubscribe", name, s.broker.PSubscribe(c.sub, name))
+		} else {
+			writeSubscription(c, "subscribe", name, s.broker.Subscribe(c.sub, name))
+		}
+	}
+	return nil
+}
+
+// handleUnsubscribe serves UNSUBSCRIBE and, when pattern is set, PUNSUBSCRIBE.
+// Without arguments every channel, or pattern, is unsubscribed from.
+func (s *Server) handleUnsubscribe(c *client, args []string, pattern bool) error {
+	kind := "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+	if c.sub == nil {
+		for _, name := range args {
+			writeSubscription(c, kind, name, 0)
+		}
+		if len(args) == 0 {
+			c.reply.Push(3)
+			c.reply.Bulk(kind)
+			c.reply.Null()
+			c.reply.Int(0)
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		if pattern {
+			args = c.sub.Patterns()
+		} else {
+			args = c.sub.Channels()
+		}
+		if len(args) == 0 {
+			c.reply.Push(3)
+			c.reply.Bulk(kind)
+			c.reply.Null()
+			c.reply.Int(int64(c.sub.Count()))
+			return nil
+		}
+	}
+	for _, name := range args {
+		if pattern {
+			writeSubscription(c, kind, name, s.broker.PUnsubscribe(c.sub, name))
+		} else {
+			writeSubscription(c, kind, name, s.broker.Unsubscribe(c.sub, name))
+		}
+	}
+	return nil
+}
+
+func (s *Server) handlePublish(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: PUBLISH channel message")
+	}
+	c.reply.Int(int64(s.broker.Publish(args[0], args[1])))
+	return nil
+}
+
+// handlePubSub serves PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...]
+// and PUBSUB NUMPAT.
+func (s *Server) handlePubSub(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "CHANNELS":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: PUBSUB CHANNELS [pattern]")
+		}
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+		c.reply.Strings(s.broker.Channels(pattern))
+	case "NUMSUB":
+		c.reply.Map(len(args) - 1)
+		for _, channel := range args[1:] {
+			c.reply.Bulk(channel)
+			c.reply.Int(int64(s.broker.NumSub(channel)))
+		}
+	case "NUMPAT":
+		c.reply.Int(int64(s.broker.NumPat()))
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	return nil
+}
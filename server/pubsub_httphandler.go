@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-idis/internal/pubsub"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sseKeepAlive is how often an idle event stream receives a comment line,
+// which keeps proxies from timing the connection out.
+const sseKeepAlive = 15 * time.Second
+
+// handlerSubscribe returns an HTTP handler streaming the messages of a channel
+// as Server-Sent Events. Pass pattern=true to subscribe to a glob pattern.
+// Each event carries a JSON object with the channel and message.
+func (s *Server) handlerSubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		channel, ok := vars["channel"]
+		if !ok {
+			http.Error(w, "Channel is required", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		sub := s.broker.NewSubscriber(pubsub.DefaultBuffer)
+		defer s.broker.Close(sub)
+		if r.URL.Query().Get("pattern") == "true" {
+			s.broker.PSubscribe(sub, channel)
+		} else {
+			s.broker.Subscribe(sub, channel)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, ": subscribed to %s\n\n", channel)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case msg, ok := <-sub.Messages():
+				if !ok {
+					// Dropped for falling behind
+					return
+				}
+				event := map[string]string{
+					"channel": msg.Channel,
+					"message": msg.Payload,
+				}
+				if msg.Pattern != "" {
+					event["pattern"] = msg.Pattern
+				}
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handlerPublish returns an HTTP handler publishing the JSON string in the
+// request body to a channel.
+func (s *Server) handlerPublish() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		channel, ok := vars["channel"]
+		if !ok {
+			http.Error(w, "Channel is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for the message
+		var message string
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON string.", http.StatusBadRequest)
+			return
+		}
+
+		receivers := s.broker.Publish(channel, message)
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"receivers": receivers}}, http.StatusOK, nil)
+	}
+}
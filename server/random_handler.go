@@ -2,12 +2,11 @@ package server
 
 import (
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 )
 
-func (s *Server) handleRand(conn net.Conn, args []string) error {
+func (s *Server) handleRand(c *client, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage: RAND key offset")
 	}
@@ -20,6 +19,10 @@ func (s *Server) handleRand(conn net.Conn, args []string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "Values: "+strings.Join(values, ", ")+"\n")
+	if t, ok := c.reply.(*textWriter); ok {
+		t.Lines("Values: " + strings.Join(values, ", "))
+		return nil
+	}
+	c.reply.Strings(values)
 	return nil
 }
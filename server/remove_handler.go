@@ -2,10 +2,9 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleRemove(conn net.Conn, args []string) error {
+func (s *Server) handleRemove(c *client, args []string) error {
 	if len(args) != 2 {
 		return fmt.Errorf("usage: REMOVE key value")
 	}
@@ -13,6 +12,6 @@ func (s *Server) handleRemove(conn net.Conn, args []string) error {
 	if err := s.store.RemoveValue(key, value); err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "Removed\n")
+	c.reply.Status("Removed")
 	return nil
 }
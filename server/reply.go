@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// replyWriter renders command results for the protocol a client speaks.
+// Aggregates are announced with Array or Map and followed by their elements.
+type replyWriter interface {
+	Status(s string)
+	Error(err error)
+	Int(n int64)
+	Bulk(s string)
+	Null()
+	// NullArray is the nil reply of commands that otherwise return an array,
+	// such as BLPOP on timeout.
+	NullArray()
+	Float(f float64)
+	Strings(values []string)
+	Array(n int)
+	Map(n int)
+	// Push announces an out-of-band message such as a pub/sub delivery.
+	Push(n int)
+	Flush() error
+}
+
+// textWriter renders replies as the human readable lines used by the telnet listener.
+type textWriter struct {
+	w      *bufio.Writer
+	frames []textFrame
+}
+
+type textFrame struct {
+	n      int // number of elements, counting keys and values for maps
+	i      int // elements written so far
+	isMap  bool
+	indent string
+}
+
+func newTextWriter(w *bufio.Writer) *textWriter {
+	return &textWriter{w: w}
+}
+
+// open returns the text preceding the next element on its line.
+func (t *textWriter) open() (prefix string, isKey bool) {
+	if len(t.frames) == 0 {
+		return "", false
+	}
+	f := &t.frames[len(t.frames)-1]
+	if !f.isMap {
+		return f.indent + strconv.Itoa(f.i+1) + ": ", false
+	}
+	if f.i%2 == 0 {
+		return f.indent, true
+	}
+	// Values follow their key on the same line
+	return " ", false
+}
+
+// close marks the current element as written, finishing any completed aggregates.
+func (t *textWriter) close() {
+	for len(t.frames) > 0 {
+		f := &t.frames[len(t.frames)-1]
+		f.i++
+		if f.i < f.n {
+			return
+		}
+		t.frames = t.frames[:len(t.frames)-1]
+	}
+}
+
+func (t *textWriter) scalar(s string) {
+	prefix, isKey := t.open()
+	if isKey {
+		t.w.WriteString(prefix + s + ":")
+	} else {
+		t.w.WriteString(prefix + s + "\n")
+	}
+	t.close()
+}
+
+func (t *textWriter) aggregate(n int, isMap bool) {
+	prefix, _ := t.open()
+	indent := ""
+	if len(t.frames) > 0 {
+		indent = t.frames[len(t.frames)-1].indent + "   "
+	}
+	if n == 0 {
+		t.w.WriteString(prefix + "(empty list)\n")
+		t.close()
+		return
+	}
+	if len(t.frames) > 0 {
+		t.w.WriteString(strings.TrimRight(prefix, " ") + "\n")
+	}
+	if isMap {
+		n *= 2
+	}
+	t.frames = append(t.frames, textFrame{n: n, isMap: isMap, indent: indent})
+}
+
+func (t *textWriter) Status(s string)    { t.scalar(s) }
+func (t *textWriter) Error(err error)    { t.scalar(err.Error()) }
+func (t *textWriter) Int(n int64)        { t.scalar(strconv.FormatInt(n, 10)) }
+func (t *textWriter) Bulk(s string)      { t.scalar(s) }
+func (t *textWriter) Null()              { t.scalar("(nil)") }
+func (t *textWriter) NullArray()         { t.scalar("(nil)") }
+func (t *textWriter) Float(f float64)    { t.scalar(formatFloat(f)) }
+func (t *textWriter) Array(n int)        { t.aggregate(n, false) }
+func (t *textWriter) Map(n int)          { t.aggregate(n, true) }
+func (t *textWriter) Push(n int)         { t.aggregate(n, false) }
+func (t *textWriter) Flush() error       { return t.w.Flush() }
+func (t *textWriter) Strings(v []string) { writeStrings(t, v) }
+
+// Lines writes lines as a single reply. The commands telnet clients had
+// before RESP use it to keep their original wording.
+func (t *textWriter) Lines(lines ...string) { t.scalar(strings.Join(lines, "\n")) }
+
+// writeStrings writes values as an array of bulk strings.
+func writeStrings(w replyWriter, values []string) {
+	w.Array(len(values))
+	for _, v := range values {
+		w.Bulk(v)
+	}
+}
+
+// formatFloat formats f the way Redis prints scores and increments.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
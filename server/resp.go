@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen   = 512 << 20 // Largest bulk string accepted from a client
+	maxArrayLen  = 1 << 20   // Largest number of arguments in a single command
+	maxInlineLen = 64 << 10  // Longest inline command or header line, as proto-inline-max-size in Redis
+)
+
+// errProtocol is returned for malformed requests; the connection is closed after replying.
+var errProtocol = errors.New("Protocol error")
+
+// respWriter renders replies using the RESP2 or RESP3 wire protocol.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newRESPWriter(w *bufio.Writer) *respWriter {
+	return &respWriter{w: w, proto: 2}
+}
+
+func (r *respWriter) line(prefix byte, s string) {
+	r.w.WriteByte(prefix)
+	r.w.WriteString(s)
+	r.w.WriteString("\r\n")
+}
+
+func (r *respWriter) Status(s string) { r.line('+', s) }
+
+func (r *respWriter) Error(err error) { r.line('-', respError(err)) }
+
+func (r *respWriter) Int(n int64) { r.line(':', strconv.FormatInt(n, 10)) }
+
+func (r *respWriter) Bulk(s string) {
+	r.line('$', strconv.Itoa(len(s)))
+	r.w.WriteString(s)
+	r.w.WriteString("\r\n")
+}
+
+func (r *respWriter) Null() {
+	if r.proto >= 3 {
+		r.w.WriteString("_\r\n")
+		return
+	}
+	r.w.WriteString("$-1\r\n")
+}
+
+func (r *respWriter) NullArray() {
+	if r.proto >= 3 {
+		r.w.WriteString("_\r\n")
+		return
+	}
+	r.w.WriteString("*-1\r\n")
+}
+
+func (r *respWriter) Float(f float64) {
+	if r.proto >= 3 {
+		r.line(',', formatFloat(f))
+		return
+	}
+	r.Bulk(formatFloat(f))
+}
+
+func (r *respWriter) Strings(values []string) { writeStrings(r, values) }
+
+func (r *respWriter) Array(n int) { r.line('*', strconv.Itoa(n)) }
+
+func (r *respWriter) Map(n int) {
+	if r.proto >= 3 {
+		r.line('%', strconv.Itoa(n))
+		return
+	}
+	r.line('*', strconv.Itoa(n*2))
+}
+
+// Push uses the RESP3 push type; RESP2 clients receive a plain array.
+func (r *respWriter) Push(n int) {
+	if r.proto >= 3 {
+		r.line('>', strconv.Itoa(n))
+		return
+	}
+	r.line('*', strconv.Itoa(n))
+}
+
+func (r *respWriter) Flush() error { return r.w.Flush() }
+
+// respError formats err as a RESP error line. Errors carrying an
+// idis.CodedError are reported under its code, all others as generic ERR
+// errors.
+func respError(err error) string {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	var coded *idis.CodedError
+	if !errors.As(err, &coded) {
+		return "ERR " + msg
+	}
+	if strings.HasPrefix(msg, coded.Code+" ") {
+		return msg
+	}
+	return coded.Code + " " + msg
+}
+
+// readRESPCommand reads a single command from a RESP client. Both multibulk
+// requests and inline commands (as sent by telnet or redis-cli in pipe mode)
+// are accepted.
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArrayLen {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		header, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", errProtocol)
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line of up to maxInlineLen bytes, so a client cannot grow
+// the server's memory by never sending a newline.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return "", fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadRESPCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+		err   error // returned after the commands in want
+	}{
+		{name: "multibulk", input: "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nhello\r\n", want: [][]string{{"SET", "k", "hello"}}, err: io.EOF},
+		{name: "binary bulk", input: "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", want: [][]string{{"ECHO", "a\r\nb"}}, err: io.EOF},
+		{name: "empty bulk", input: "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n", want: [][]string{{"ECHO", ""}}, err: io.EOF},
+		{name: "pipelined", input: "*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPING\r\n", want: [][]string{{"PING"}, {"PING"}}, err: io.EOF},
+		{name: "inline", input: "SET k  v\r\nPING\n", want: [][]string{{"SET", "k", "v"}, {"PING"}}, err: io.EOF},
+		{name: "empty inline", input: "\r\n", want: [][]string{{}}, err: io.EOF},
+		{name: "bad multibulk length", input: "*x\r\n", err: errProtocol},
+		{name: "multibulk too long", input: fmt.Sprintf("*%d\r\n", maxArrayLen+1), err: errProtocol},
+		{name: "missing dollar", input: "*1\r\n:1\r\n", err: errProtocol},
+		{name: "bad bulk length", input: "*1\r\n$x\r\n", err: errProtocol},
+		{name: "negative bulk length", input: "*1\r\n$-1\r\n", err: errProtocol},
+		{name: "bulk too long", input: fmt.Sprintf("*1\r\n$%d\r\n", maxBulkLen+1), err: errProtocol},
+		{name: "missing CRLF", input: "*1\r\n$4\r\nPINGxx", err: errProtocol},
+		{name: "truncated bulk", input: "*1\r\n$4\r\nPI", err: io.ErrUnexpectedEOF},
+		{name: "truncated header", input: "*2\r\n$4\r\nPING\r\n$", err: io.EOF},
+		{name: "inline too long", input: strings.Repeat("a", maxInlineLen+1), err: errProtocol},
+		{name: "inline at limit", input: strings.Repeat("a", maxInlineLen-2) + "\r\n", want: [][]string{{strings.Repeat("a", maxInlineLen-2)}}, err: io.EOF},
+	}
+	for _, tt := range tests {
+		for _, split := range []bool{false, true} {
+			name := tt.name
+			var r io.Reader = strings.NewReader(tt.input)
+			if split {
+				// Every read returns a single byte, as a slow client would send them
+				name += "/split"
+				r = iotest.OneByteReader(r)
+			}
+			t.Run(name, func(t *testing.T) {
+				reader := bufio.NewReader(r)
+				for _, want := range tt.want {
+					got, err := readRESPCommand(reader)
+					if err != nil {
+						t.Fatalf("readRESPCommand() error = %v, want %q", err, want)
+					}
+					if len(got) != 0 || len(want) != 0 {
+						if !reflect.DeepEqual(got, want) {
+							t.Fatalf("readRESPCommand() = %q, want %q", got, want)
+						}
+					}
+				}
+				if _, err := readRESPCommand(reader); !errors.Is(err, tt.err) {
+					t.Fatalf("readRESPCommand() error = %v, want %v", err, tt.err)
+				}
+			})
+		}
+	}
+}
+
+func TestRespError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("key not found"), "ERR key not found"},
+		{errors.New("XX and NX options at the same time are not compatible"), "ERR XX and NX options at the same time are not compatible"},
+		{errors.New("line\r\nbreak"), "ERR line  break"},
+		{idis.ErrWrongType, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{fmt.Errorf("EXEC: %w", idis.ErrOOM), "OOM EXEC: OOM command not allowed when used memory > 'maxmemory'"},
+		{&idis.CodedError{Code: "NOPROTO", Msg: "unsupported protocol version"}, "NOPROTO unsupported protocol version"},
+	}
+	for _, tt := range tests {
+		if got := respError(tt.err); got != tt.want {
+			t.Errorf("respError(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"go-idis/internal/idis"
 	"log/slog"
 	"net/http"
 )
@@ -34,8 +36,75 @@ func (s *Server) RegisterAPIs() {
 	// Set the expiration time for the key
 	s.router.HandleFunc("/expire/{key}", s.handlerExpire()).Methods(http.MethodPost, http.MethodOptions)
 
+	// Typed values
+	s.router.HandleFunc("/type/{key}", s.handlerType()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/object/{key}", s.handlerObject()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/getstr/{key}", s.handlerGetString()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/setstr/{key}", s.handlerSetString()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/smembers/{key}", s.handlerSMembers()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/sadd/{key}", s.handlerSAdd()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/srem/{key}", s.handlerSRem()).Methods(http.MethodPost, http.MethodOptions)
+
+	// Sorted sets
+	s.router.HandleFunc("/zadd/{key}", s.handlerZAdd()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/zrem/{key}", s.handlerZRem()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/zscore/{key}/{member}", s.handlerZScore()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/zrank/{key}/{member}", s.handlerZRank()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/zrange/{key}", s.handlerZRange()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/zcount/{key}", s.handlerZCount()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/zpopmin/{key}", s.handlerZPop(false)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/zpopmax/{key}", s.handlerZPop(true)).Methods(http.MethodPost, http.MethodOptions)
+
+	// Lists
+	s.router.HandleFunc("/lpush/{key}", s.handlerPush(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/rpush/{key}", s.handlerPush(false)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/lpop/{key}", s.handlerPop(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/rpop/{key}", s.handlerPop(false)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/lrange/{key}", s.handlerLRange()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/lindex/{key}/{index}", s.handlerLIndex()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/lset/{key}/{index}", s.handlerLSet()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/linsert/{key}", s.handlerLInsert()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/lpos/{key}/{element}", s.handlerLPos()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/lrem/{key}/{element}", s.handlerLRem()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/ltrim/{key}", s.handlerLTrim()).Methods(http.MethodPost, http.MethodOptions)
+
+	// Hashes
+	s.router.HandleFunc("/hash/{key}", s.handlerHGetAll()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/hash/{key}", s.handlerHSet()).Methods(http.MethodPost, http.MethodOptions)
+
+	// Streams
+	s.router.HandleFunc("/xadd/{key}", s.handlerXAdd()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/xrange/{key}", s.handlerXRange()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Pub/sub
+	s.router.HandleFunc("/subscribe/{channel}", s.handlerSubscribe()).Methods(http.MethodGet, http.MethodOptions).Name("subscribe")
+	s.router.HandleFunc("/publish/{channel}", s.handlerPublish()).Methods(http.MethodPost, http.MethodOptions)
+
+	// Live traffic
+	s.router.HandleFunc("/monitor", s.handlerMonitor()).Methods(http.MethodGet, http.MethodOptions).Name("monitor")
+
+	// Transactions
+	s.router.HandleFunc("/tx", s.handlerTx()).Methods(http.MethodPost, http.MethodOptions).Name("tx")
+	s.router.HandleFunc("/version/{key}", s.handlerVersion()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Snapshots
+	s.router.HandleFunc("/admin/save", s.handlerSave()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/admin/bgsave", s.handlerBgSave()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/admin/lastsave", s.handlerLastSave()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Connected clients
+	s.router.HandleFunc("/admin/clients", s.handlerClients()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/admin/clients/{id}", s.handlerKillClient()).Methods(http.MethodDelete, http.MethodOptions)
+
 	// help
 	s.router.HandleFunc("/help", s.handlerHelp()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Server information
+	s.router.HandleFunc("/info", s.handlerInfo()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/metrics", s.handlerMetrics()).Methods(http.MethodGet, http.MethodOptions)
+
+	// No handler runs while a transaction does
+	s.router.Use(s.instrument, s.txGuard)
 }
 
 func (s *Server) respond(
@@ -66,3 +135,17 @@ func (s *Server) respond(
 		slog.Error("Failed to encode response:", "error", err)
 	}
 }
+
+// statusFor maps a store error to an HTTP status code.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, idis.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, idis.ErrWrongType):
+		return http.StatusConflict
+	case errors.Is(err, idis.ErrOOM):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+)
+
+// handleSave writes a snapshot to the dump file and replies once it is on disk.
+func (s *Server) handleSave(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: SAVE")
+	}
+	if err := s.store.Save(); err != nil {
+		return err
+	}
+	c.reply.Status("OK")
+	return nil
+}
+
+// handleBgSave starts writing a snapshot in the background. INFO persistence
+// and LASTSAVE tell when it is done.
+func (s *Server) handleBgSave(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: BGSAVE")
+	}
+	if err := s.store.BgSave(); err != nil {
+		return err
+	}
+	c.reply.Status("Background saving started")
+	return nil
+}
+
+// handleLastSave replies with the Unix time of the last successful snapshot,
+// or 0 if there was none.
+func (s *Server) handleLastSave(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: LASTSAVE")
+	}
+	var unix int64
+	if t := s.store.LastSave(); !t.IsZero() {
+		unix = t.Unix()
+	}
+	c.reply.Int(unix)
+	return nil
+}
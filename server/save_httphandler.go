@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"net/http"
+)
+
+// saveStatus is the JSON form of the snapshot status returned by the admin
+// routes. Times are Unix seconds and durations milliseconds.
+func saveStatus(st idis.SaveStatus) map[string]interface{} {
+	var lastSave int64
+	if !st.LastSave.IsZero() {
+		lastSave = st.LastSave.Unix()
+	}
+	status := map[string]interface{}{
+		"filename":           st.Filename,
+		"in_progress":        st.InProgress,
+		"last_save":          lastSave,
+		"last_status":        st.LastStatus,
+		"last_duration_ms":   st.LastDuration.Milliseconds(),
+		"changes_since_save": st.ChangesSinceSave,
+		"saves":              st.Saves,
+	}
+	if st.LastError != "" {
+		status["last_error"] = st.LastError
+	}
+	if st.InProgress {
+		status["progress"] = map[string]interface{}{
+			"background": st.Background,
+			"elapsed_ms": st.CurrentTime.Milliseconds(),
+			"keys_total": st.KeysTotal,
+			"keys_done":  st.KeysDone,
+		}
+	}
+	return status
+}
+
+// handlerSave returns an HTTP handler writing a snapshot to the dump file
+// and responding once it is on disk.
+func (s *Server) handlerSave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.store.Save(); err != nil {
+			s.respond(w, ResponseMsg{Message: "error", Data: fmt.Sprintf("Error saving snapshot: %v", err)}, saveErrorStatus(err), nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: saveStatus(s.store.SaveStatus())}, http.StatusOK, nil)
+	}
+}
+
+// handlerBgSave returns an HTTP handler starting a snapshot in the
+// background. Its progress is reported by /admin/lastsave.
+func (s *Server) handlerBgSave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.store.BgSave(); err != nil {
+			s.respond(w, ResponseMsg{Message: "error", Data: fmt.Sprintf("Error starting snapshot: %v", err)}, saveErrorStatus(err), nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: saveStatus(s.store.SaveStatus())}, http.StatusAccepted, nil)
+	}
+}
+
+// handlerLastSave returns an HTTP handler reporting the last snapshot and
+// the progress of one being written.
+func (s *Server) handlerLastSave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, ResponseMsg{Message: "success", Data: saveStatus(s.store.SaveStatus())}, http.StatusOK, nil)
+	}
+}
+
+func saveErrorStatus(err error) int {
+	if errors.Is(err, idis.ErrSaveInProgress) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -1,60 +1,157 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"go-idis/internal/config"
 	"go-idis/internal/idis"
+	"go-idis/internal/pubsub"
 	"log"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	httpAddr   string
-	telnetAddr string
-	store      idis.Repository
-	router     *mux.Router
+	cfg          *config.Config
+	httpAddr     string
+	telnetAddr   string
+	respAddr     string
+	store        idis.Repository
+	broker       *pubsub.Broker
+	router       *mux.Router
+	nextClientID atomic.Int64
+	// txMu is held shared by every command and exclusively while a
+	// transaction runs, see tx_handler.go
+	txMu    sync.RWMutex
+	stats   *serverStats // counters reported by INFO, see stats.go
+	slowlog *slowLog
+
+	// Clients running MONITOR, see monitor.go
+	monitorsMu   sync.RWMutex
+	monitors     map[*monitor]struct{}
+	monitorCount atomic.Int32
+
+	// Shutdown state, see shutdown_handler.go
+	httpServer *http.Server
+	listeners  []net.Listener
+	clientsMu  sync.Mutex
+	clients    map[*client]struct{}
+	conns      sync.WaitGroup  // one per connection being served
+	ctx        context.Context // done once shutting down
+	cancel     context.CancelFunc
+	closing    atomic.Bool
+	shutdown   sync.Once
+	stopped    chan struct{} // closed once shut down
+	stopErr    error
 }
 
-// NewServer initializes the Server with HTTP and Telnet addresses
-func NewServer(httpAddr, telnetAddr string, store idis.Repository) *Server {
-	return &Server{
-		httpAddr:   httpAddr,
-		telnetAddr: telnetAddr,
+// NewServer initializes the Server with the HTTP, Telnet and RESP addresses
+// of cfg, which CONFIG reads and writes back.
+func NewServer(cfg *config.Config, store idis.Repository) *Server {
+	s := &Server{
+		cfg:        cfg,
+		httpAddr:   cfg.HTTPAddr,
+		telnetAddr: cfg.TelnetAddr,
+		respAddr:   cfg.RESPAddr,
 		store:      store,
+		broker:     pubsub.NewBroker(),
+		stats:      newServerStats(),
+		slowlog:    newSlowLog(cfg.SlowlogLogSlowerThan, cfg.SlowlogMaxLen),
 		router:     mux.NewRouter(),
+		clients:    make(map[*client]struct{}),
+		monitors:   make(map[*monitor]struct{}),
+		stopped:    make(chan struct{}),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	// Keyspace notifications reach subscribers on every listener
+	store.SetPublisher(func(channel, message string) {
+		s.broker.Publish(channel, message)
+	})
+	return s
 }
 
-// Run starts the HTTP and Telnet servers concurrently
+// Run starts the HTTP, RESP and Telnet servers concurrently and returns once
+// the server has been shut down, see Shutdown
 func (s *Server) Run() error {
-	// Start the HTTP server in a separate goroutine
-	go func() {
-		s.RegisterAPIs()
-		fmt.Printf("HTTP server running on %s\n", s.httpAddr)
-		if err := http.ListenAndServe(s.httpAddr, s.router); err != nil {
-			log.Fatalf("HTTP server failed: %v", err)
-		}
-	}()
+	s.RegisterAPIs()
 
-	// Start the Telnet server
+	// Listen on every address first so that none is served if one fails
+	httpListener, err := net.Listen("tcp", s.httpAddr)
+	if err != nil {
+		return fmt.Errorf("HTTP server failed to start: %w", err)
+	}
+	// Start the RESP server so stock Redis clients can connect
+	respListener, err := net.Listen("tcp", s.respAddr)
+	if err != nil {
+		httpListener.Close()
+		return fmt.Errorf("RESP server failed to start: %w", err)
+	}
 	listener, err := net.Listen("tcp", s.telnetAddr)
 	if err != nil {
+		httpListener.Close()
+		respListener.Close()
 		return fmt.Errorf("telnet server failed to start: %w", err)
 	}
-	defer listener.Close()
+	// The HTTP listener is closed by httpServer.Shutdown
+	s.listeners = []net.Listener{respListener, listener}
+
+	// Requests are handed the server context, so event streams end when
+	// shutting down
+	s.httpServer = &http.Server{
+		Handler:     s.router,
+		BaseContext: func(net.Listener) context.Context { return s.ctx },
+	}
+	go func() {
+		if err := s.httpServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server failed: %v", err)
+			s.Shutdown(true)
+		}
+	}()
+	fmt.Printf("HTTP server running on %s\n", s.httpAddr)
+
+	go s.accept(respListener, s.handleRESPConnection)
+	fmt.Printf("RESP server running on %s\n", s.respAddr)
+
+	go s.accept(listener, s.handleConnection)
 	fmt.Printf("Telnet server running on %s\n", s.telnetAddr)
-	fmt.Println("Type 'exit' to shut down the Telnet server.")
+	fmt.Println("Type 'exit' to disconnect from the Telnet server, or 'shutdown' to stop it.")
+
+	<-s.stopped
+	return s.stopErr
+}
 
-	// Accept Telnet connections in a loop
+// accept serves connections from listener in a loop, one goroutine per
+// client, until the server shuts down
+func (s *Server) accept(listener net.Listener, handle func(net.Conn)) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if s.closing.Load() {
+				return
+			}
 			log.Println("Connection error:", err)
 			continue
 		}
-		fmt.Printf("Telnet client connected from %s\n", conn.RemoteAddr().String())
-		go s.handleConnection(conn)
+		// Checked under clientsMu so that no connection is added once
+		// Shutdown waits for them
+		s.clientsMu.Lock()
+		if s.closing.Load() {
+			s.clientsMu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns.Add(1)
+		s.clientsMu.Unlock()
+		s.stats.connections.Add(1)
+		fmt.Printf("Client connected to %s from %s\n", listener.Addr(), conn.RemoteAddr().String())
+		go func() {
+			defer s.conns.Done()
+			handle(conn)
+		}()
 	}
 }
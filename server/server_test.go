@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"go-idis/internal/config"
+	"go-idis/internal/idis"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a server over an empty store, without listeners.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := config.Default()
+	cfg.AppendOnly = false
+	cfg.SaveInterval = 0
+	return NewServer(cfg, idis.NewShardedRepository(4))
+}
+
+// testConn is a RESP client connected to a test server.
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// replyError is an error reply.
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+// push is a RESP3 push, as opposed to an array reply.
+type push []interface{}
+
+// dial connects a new RESP client to s over TCP.
+func dial(t *testing.T, s *Server) *testConn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			s.handleRESPConnection(conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes a command without waiting for its reply.
+func (tc *testConn) send(args ...string) {
+	tc.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := tc.conn.Write([]byte(b.String())); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// do sends a command and returns its reply.
+func (tc *testConn) do(args ...string) interface{} {
+	tc.t.Helper()
+	tc.send(args...)
+	return tc.read()
+}
+
+// read returns the next reply: a string for simple and bulk strings, an
+// int64, a replyError, nil, or a []interface{} or push for aggregates.
+func (tc *testConn) read() interface{} {
+	tc.t.Helper()
+	tc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	v, err := readReply(tc.r)
+	if err != nil {
+		tc.t.Fatalf("reading a reply: %v", err)
+	}
+	return v
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed line %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+', ',':
+		return body, nil
+	case '-':
+		return replyError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*', '>', '%', '~':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if kind == '%' {
+			n *= 2
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		if kind == '>' {
+			return push(values), nil
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", kind)
+}
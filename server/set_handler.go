@@ -2,10 +2,9 @@ package server
 
 import (
 	"fmt"
-	"net"
 )
 
-func (s *Server) handleSet(conn net.Conn, args []string) error {
+func (s *Server) handleSet(c *client, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("usage: SET key value1 value2.... valueN")
 	}
@@ -13,11 +12,11 @@ func (s *Server) handleSet(conn net.Conn, args []string) error {
 	if err := s.store.Set(key, values...); err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "OK\n")
+	c.reply.Status("OK")
 	return nil
 }
 
-func (s *Server) handleSetUnique(conn net.Conn, args []string) error {
+func (s *Server) handleSetUnique(c *client, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("usage: SETUQ key value1 value2 ... valueN")
 	}
@@ -25,6 +24,6 @@ func (s *Server) handleSetUnique(conn net.Conn, args []string) error {
 	if err := s.store.SetUnique(key, values...); err != nil {
 		return err
 	}
-	fmt.Fprint(conn, "OK\n")
+	c.reply.Status("OK")
 	return nil
 }
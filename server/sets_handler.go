@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+)
+
+func (s *Server) handleSAdd(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: SADD key member1 member2 ... memberN")
+	}
+	n, err := s.store.SAdd(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleSRem(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: SREM key member1 member2 ... memberN")
+	}
+	n, err := s.store.SRem(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleSMembers(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: SMEMBERS key")
+	}
+	members, err := s.store.SMembers(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Strings(members)
+	return nil
+}
+
+func (s *Server) handleSIsMember(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: SISMEMBER key member")
+	}
+	found, err := s.store.SIsMember(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if found {
+		c.reply.Int(1)
+	} else {
+		c.reply.Int(0)
+	}
+	return nil
+}
+
+func (s *Server) handleSCard(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: SCARD key")
+	}
+	n, err := s.store.SCard(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerSMembers returns an HTTP handler for retrieving the members of a set.
+func (s *Server) handlerSMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		members, err := s.store.SMembers(key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving members of key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     key,
+			"members": members,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerSAdd returns an HTTP handler for adding members to a set.
+func (s *Server) handlerSAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for members
+		var members []string
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON array of members.", http.StatusBadRequest)
+			return
+		}
+
+		added, err := s.store.SAdd(key, members...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error adding members to key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"added": added}}, http.StatusOK, nil)
+	}
+}
+
+// handlerSRem returns an HTTP handler for removing members from a set.
+func (s *Server) handlerSRem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for members
+		var members []string
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON array of members.", http.StatusBadRequest)
+			return
+		}
+
+		removed, err := s.store.SRem(key, members...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error removing members from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"removed": removed}}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"log"
+	"strings"
+	"time"
+)
+
+// Shutdown stops the server and makes Run return. New connections are
+// refused, blocking commands and event streams return at once, and in-flight
+// commands and requests are given shutdown-timeout to finish. The
+// append-only file is then synced and closed and, if save is set, a final
+// snapshot is written to the dump file.
+//
+// Only the first call shuts the server down; later ones wait for it and
+// return the same error.
+func (s *Server) Shutdown(save bool) error {
+	s.shutdown.Do(func() {
+		s.stopErr = s.stop(save)
+		close(s.stopped)
+	})
+	<-s.stopped
+	return s.stopErr
+}
+
+// stop drains the connections and persists the store, see Shutdown.
+func (s *Server) stop(save bool) error {
+	fmt.Println("Shutting down, no longer accepting connections")
+	s.clientsMu.Lock()
+	s.closing.Store(true)
+	s.clientsMu.Unlock()
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.cancel()
+
+	timeout := s.cfg.ShutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpDone := make(chan error, 1)
+	go func() {
+		if s.httpServer == nil {
+			httpDone <- nil
+			return
+		}
+		httpDone <- s.httpServer.Shutdown(ctx)
+	}()
+
+	// Clients waiting for their next command are woken up and disconnect;
+	// the others finish the command they are running first
+	s.clientsMu.Lock()
+	for c := range s.clients {
+		c.conn.SetReadDeadline(time.Now())
+	}
+	s.clientsMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Printf("Clients still busy after %v, closing their connections", timeout)
+		s.clientsMu.Lock()
+		for c := range s.clients {
+			c.conn.Close()
+		}
+		s.clientsMu.Unlock()
+	}
+	if err := <-httpDone; err != nil {
+		log.Printf("HTTP requests still running after %v, closing their connections", timeout)
+		s.httpServer.Close()
+	}
+
+	var errs []error
+	if err := s.store.CloseAOF(); err != nil {
+		errs = append(errs, fmt.Errorf("closing append-only file: %w", err))
+	}
+	if save {
+		// A background save may still be running, its snapshot would miss
+		// the latest writes
+		err := s.store.Save()
+		for errors.Is(err, idis.ErrSaveInProgress) {
+			time.Sleep(10 * time.Millisecond)
+			err = s.store.Save()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving snapshot: %w", err))
+		} else {
+			fmt.Println("Data successfully dumped to file:", s.store.DumpFile())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleShutdown serves SHUTDOWN [SAVE|NOSAVE]. Without either, a final
+// snapshot is written if periodic snapshots are enabled. As in Redis, RESP
+// clients get no reply, the connection is closed once the server is shut
+// down.
+func (s *Server) handleShutdown(c *client, args []string) error {
+	save := s.cfg.SaveInterval > 0
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && strings.EqualFold(args[0], "SAVE"):
+		save = true
+	case len(args) == 1 && strings.EqualFold(args[0], "NOSAVE"):
+		save = false
+	default:
+		return fmt.Errorf("usage: SHUTDOWN [SAVE|NOSAVE]")
+	}
+	if c.execing {
+		return fmt.Errorf("shutdown is not allowed in a transaction")
+	}
+
+	// Shutdown waits for this command to finish, so it runs on its own
+	go s.Shutdown(save)
+	if c.proto == 0 {
+		c.reply.Status("Shutting down")
+	}
+	c.quit = true
+	return nil
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Arguments past slowlogMaxArgs and bytes past slowlogMaxArgLen are
+	// left out of slow log entries, as in Redis.
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+// slowLog keeps the latest commands and HTTP requests that took longer than
+// a threshold in a ring buffer.
+type slowLog struct {
+	slowerThan atomic.Int64 // microseconds, negative to log nothing
+
+	mu     sync.Mutex
+	maxLen int
+	ring   []slowLogEntry
+	start  int // oldest entry once the ring is full
+	nextID int64
+}
+
+// slowLogEntry is a command or HTTP request that was slow.
+type slowLogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string // truncated, see slowlogMaxArgs
+	addr     string   // client address
+	name     string   // client name, or "http" for HTTP requests
+}
+
+func newSlowLog(slowerThan int64, maxLen int) *slowLog {
+	l := &slowLog{maxLen: maxLen}
+	l.slowerThan.Store(slowerThan)
+	return l
+}
+
+// record logs a command or request that took d if it is over the threshold.
+func (l *slowLog) record(args []string, d time.Duration, addr, name string) {
+	threshold := l.slowerThan.Load()
+	if threshold < 0 || d.Microseconds() < threshold {
+		return
+	}
+	e := slowLogEntry{
+		time:     time.Now(),
+		duration: d,
+		args:     truncateArgs(args),
+		addr:     addr,
+		name:     name,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxLen == 0 {
+		return
+	}
+	e.id = l.nextID
+	l.nextID++
+	if len(l.ring) < l.maxLen {
+		l.ring = append(l.ring, e)
+		return
+	}
+	l.ring[l.start] = e
+	l.start = (l.start + 1) % len(l.ring)
+}
+
+// truncateArgs copies args, replacing the arguments and bytes over the
+// limits with a note of how many were left out.
+func truncateArgs(args []string) []string {
+	n := min(len(args), slowlogMaxArgs)
+	out := make([]string, n)
+	for i := 0; i < n; i++ {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			out[i] = fmt.Sprintf("... (%d more arguments)", len(args)-slowlogMaxArgs+1)
+			break
+		}
+		out[i] = args[i]
+		if len(args[i]) > slowlogMaxArgLen {
+			out[i] = fmt.Sprintf("%s... (%d more bytes)", args[i][:slowlogMaxArgLen], len(args[i])-slowlogMaxArgLen)
+		}
+	}
+	return out
+}
+
+// latest returns up to count entries, newest first; a negative count
+// returns them all.
+func (l *slowLog) latest(count int) []slowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 || count > len(l.ring) {
+		count = len(l.ring)
+	}
+	entries := make([]slowLogEntry, count)
+	for i := range entries {
+		entries[i] = l.ring[(l.start+len(l.ring)-1-i)%len(l.ring)]
+	}
+	return entries
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.ring)
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring, l.start = nil, 0
+}
+
+// setMaxLen changes how many entries are kept, dropping the oldest ones if
+// there are more.
+func (l *slowLog) setMaxLen(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ring := make([]slowLogEntry, 0, min(n, len(l.ring)))
+	for i := max(len(l.ring)-n, 0); i < len(l.ring); i++ {
+		ring = append(ring, l.ring[(l.start+i)%len(l.ring)])
+	}
+	l.ring, l.start, l.maxLen = ring, 0, n
+}
+
+func (l *slowLog) getMaxLen() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxLen
+}
+
+// handleSlowlog serves SLOWLOG GET [count], SLOWLOG LEN and SLOWLOG RESET.
+// GET replies with the 10 latest entries by default, all of them with -1.
+func (s *Server) handleSlowlog(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: SLOWLOG GET [count] | LEN | RESET")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		count := 10
+		switch len(args) {
+		case 1:
+		case 2:
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < -1 {
+				return fmt.Errorf("count should be greater than or equal to -1")
+			}
+			count = n
+		default:
+			return fmt.Errorf("usage: SLOWLOG GET [count]")
+		}
+		entries := s.slowlog.latest(count)
+		c.reply.Array(len(entries))
+		for _, e := range entries {
+			c.reply.Array(6)
+			c.reply.Int(e.id)
+			c.reply.Int(e.time.Unix())
+			c.reply.Int(e.duration.Microseconds())
+			c.reply.Strings(e.args)
+			c.reply.Bulk(e.addr)
+			c.reply.Bulk(e.name)
+		}
+	case "LEN":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: SLOWLOG LEN")
+		}
+		c.reply.Int(int64(s.slowlog.len()))
+	case "RESET":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: SLOWLOG RESET")
+		}
+		s.slowlog.reset()
+		c.reply.Status("OK")
+	default:
+		return fmt.Errorf("unknown subcommand '%s', expected GET, LEN or RESET", args[0])
+	}
+	return nil
+}
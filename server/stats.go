@@ -0,0 +1,228 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// errUnknownCommand is returned for commands execute does not know. They are
+// not counted per command, so clients cannot grow the statistics at will.
+var errUnknownCommand = errors.New("unknown command")
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms
+// exported at /metrics.
+var latencyBuckets = []float64{
+	0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005,
+	0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// serverStats holds the counters reported by INFO and /metrics. They only
+// grow while the server runs.
+type serverStats struct {
+	started      time.Time
+	connections  atomic.Int64 // TCP connections accepted
+	processed    atomic.Int64 // commands run, including those queued by MULTI
+	failed       atomic.Int64 // commands that replied with an error
+	httpRequests atomic.Int64
+
+	mu       sync.RWMutex // guards the maps, not the counters
+	commands map[string]*callStats
+	routes   map[routeKey]*callStats
+}
+
+// routeKey identifies an HTTP route by method and path template, such as
+// GET /get/{key}.
+type routeKey struct {
+	method string
+	route  string
+}
+
+// callStats counts the calls of a single command or HTTP route.
+type callStats struct {
+	calls   atomic.Int64
+	failed  atomic.Int64
+	latency histogram
+}
+
+// histogram counts durations in latencyBuckets, plus one bucket for longer
+// ones.
+type histogram struct {
+	counts []atomic.Int64
+	sum    atomic.Int64 // nanoseconds
+}
+
+// callCount is a snapshot of the counters of a command or HTTP route.
+// buckets are cumulative, as in the Prometheus exposition format.
+type callCount struct {
+	name    string // command name or route template
+	method  string // HTTP method of a route
+	calls   int64
+	failed  int64
+	buckets []int64
+	sum     time.Duration
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		started:  time.Now(),
+		commands: make(map[string]*callStats),
+		routes:   make(map[routeKey]*callStats),
+	}
+}
+
+func newCallStats() *callStats {
+	return &callStats{latency: histogram{counts: make([]atomic.Int64, len(latencyBuckets)+1)}}
+}
+
+// observe counts a call lasting d, which failed if failed is set.
+func (cs *callStats) observe(d time.Duration, failed bool) {
+	cs.calls.Add(1)
+	if failed {
+		cs.failed.Add(1)
+	}
+	i := sort.SearchFloat64s(latencyBuckets, d.Seconds())
+	cs.latency.counts[i].Add(1)
+	cs.latency.sum.Add(int64(d))
+}
+
+func (cs *callStats) snapshot(name, method string) callCount {
+	cc := callCount{
+		name:    name,
+		method:  method,
+		calls:   cs.calls.Load(),
+		failed:  cs.failed.Load(),
+		buckets: make([]int64, len(latencyBuckets)),
+		sum:     time.Duration(cs.latency.sum.Load()),
+	}
+	var total int64
+	for i := range cc.buckets {
+		total += cs.latency.counts[i].Load()
+		cc.buckets[i] = total
+	}
+	return cc
+}
+
+// lookup returns the stats stored under key in m, adding them if missing.
+func lookup[K comparable](mu *sync.RWMutex, m map[K]*callStats, key K) *callStats {
+	mu.RLock()
+	cs, ok := m[key]
+	mu.RUnlock()
+	if ok {
+		return cs
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if cs, ok = m[key]; !ok {
+		cs = newCallStats()
+		m[key] = cs
+	}
+	return cs
+}
+
+// record counts a run of command lasting d, which failed if err is not nil.
+func (st *serverStats) record(command string, d time.Duration, err error) {
+	st.processed.Add(1)
+	if err != nil {
+		st.failed.Add(1)
+	}
+	if errors.Is(err, errUnknownCommand) {
+		return
+	}
+	lookup(&st.mu, st.commands, command).observe(d, err != nil)
+}
+
+// commandCounts returns the counters of every command called so far, sorted
+// by name.
+func (st *serverStats) commandCounts() []callCount {
+	st.mu.RLock()
+	counts := make([]callCount, 0, len(st.commands))
+	for name, cs := range st.commands {
+		counts = append(counts, cs.snapshot(name, ""))
+	}
+	st.mu.RUnlock()
+	sort.Slice(counts, func(i, j int) bool { return counts[i].name < counts[j].name })
+	return counts
+}
+
+// routeCounts returns the counters of every HTTP route requested so far,
+// sorted by route and method.
+func (st *serverStats) routeCounts() []callCount {
+	st.mu.RLock()
+	counts := make([]callCount, 0, len(st.routes))
+	for key, cs := range st.routes {
+		counts = append(counts, cs.snapshot(key.route, key.method))
+	}
+	st.mu.RUnlock()
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].name != counts[j].name {
+			return counts[i].name < counts[j].name
+		}
+		return counts[i].method < counts[j].method
+	})
+	return counts
+}
+
+// statusRecorder captures the status code written by an HTTP handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets event streams flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// streamingRoutes name the routes serving event streams, which last as long
+// as the client listens and are left out of the slow log.
+var streamingRoutes = map[string]bool{"subscribe": true, "monitor": true}
+
+// instrument is a middleware handing HTTP requests to the monitors, counting
+// them per route, with their latency and how many failed with a 4xx or 5xx
+// status, and logging slow ones.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.feedMonitors("http", r.RemoteAddr, []string{r.Method, r.URL.RequestURI()})
+		s.stats.httpRequests.Add(1)
+		key := routeKey{method: r.Method}
+		route := mux.CurrentRoute(r)
+		if route != nil {
+			key.route, _ = route.GetPathTemplate()
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		d := time.Since(start)
+		lookup(&s.stats.mu, s.stats.routes, key).observe(d, rec.status >= 400)
+		if route == nil || !streamingRoutes[route.GetName()] {
+			s.slowlog.record([]string{r.Method, r.URL.RequestURI()}, d, r.RemoteAddr, "http")
+		}
+	})
+}
@@ -0,0 +1,502 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-idis/internal/idis"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeStreamEntries writes entries as [id, [field, value, ...]] pairs.
+func writeStreamEntries(c *client, entries []idis.StreamEntry) {
+	c.reply.Array(len(entries))
+	for _, e := range entries {
+		c.reply.Array(2)
+		c.reply.Bulk(e.ID.String())
+		if e.Fields == nil {
+			c.reply.Null()
+		} else {
+			c.reply.Strings(e.Fields)
+		}
+	}
+}
+
+// writeStreamReads writes the result of XREAD or XREADGROUP: a map from key
+// to entries for RESP3 clients, otherwise a list of [key, entries] pairs.
+func writeStreamReads(c *client, reads []idis.StreamRead) {
+	if len(reads) == 0 {
+		c.reply.NullArray()
+		return
+	}
+	if c.proto >= 3 {
+		c.reply.Map(len(reads))
+		for _, rd := range reads {
+			c.reply.Bulk(rd.Key)
+			writeStreamEntries(c, rd.Entries)
+		}
+		return
+	}
+	c.reply.Array(len(reads))
+	for _, rd := range reads {
+		c.reply.Array(2)
+		c.reply.Bulk(rd.Key)
+		writeStreamEntries(c, rd.Entries)
+	}
+}
+
+// parseStreamTrim parses MAXLEN|MINID [=|~] threshold [LIMIT count] starting
+// at args[i] and returns the index following it.
+func parseStreamTrim(args []string, i int) (idis.StreamTrim, int, error) {
+	trim := idis.NoTrim
+	strategy := strings.ToUpper(args[i])
+	i++
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		// Trimming is always exact, which "~" permits
+		i++
+	}
+	if i >= len(args) {
+		return trim, i, fmt.Errorf("syntax error")
+	}
+	switch strategy {
+	case "MAXLEN":
+		n, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil {
+			return trim, i, idis.ErrNotInteger
+		}
+		if n < 0 {
+			return trim, i, fmt.Errorf("The MAXLEN argument must be >= 0.")
+		}
+		trim.MaxLen = n
+	case "MINID":
+		id, err := idis.ParseStreamID(args[i])
+		if err != nil {
+			return trim, i, err
+		}
+		trim.MinID, trim.ByMinID = id, true
+	}
+	i++
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		// LIMIT only bounds approximate trimming
+		if _, err := strconv.Atoi(args[i+1]); err != nil {
+			return trim, i, idis.ErrNotInteger
+		}
+		i += 2
+	}
+	return trim, i, nil
+}
+
+// handleXAdd serves XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold] *|id field value [field value ...].
+func (s *Server) handleXAdd(c *client, args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("usage: XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold] *|id field value [field value ...]")
+	}
+	key := args[0]
+	noMkStream := false
+	trim := idis.NoTrim
+	i := 1
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			var err error
+			if trim, i, err = parseStreamTrim(args, i); err != nil {
+				return err
+			}
+		default:
+			break options
+		}
+	}
+	if i >= len(args) {
+		return fmt.Errorf("syntax error")
+	}
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return fmt.Errorf("wrong number of arguments for 'xadd' command")
+	}
+
+	id, ok, err := s.store.XAdd(key, args[i], fields, noMkStream, trim)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Bulk(id.String())
+	}
+	return nil
+}
+
+func (s *Server) handleXLen(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: XLEN key")
+	}
+	n, err := s.store.XLen(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleXRange serves XRANGE key start end [COUNT n] and XREVRANGE key end start [COUNT n].
+func (s *Server) handleXRange(c *client, args []string, rev bool) error {
+	if len(args) != 3 && len(args) != 5 {
+		if rev {
+			return fmt.Errorf("usage: XREVRANGE key end start [COUNT count]")
+		}
+		return fmt.Errorf("usage: XRANGE key start end [COUNT count]")
+	}
+	from, to := args[1], args[2]
+	if rev {
+		from, to = to, from
+	}
+	start, err := idis.ParseStreamRangeBound(from, true)
+	if err != nil {
+		return err
+	}
+	end, err := idis.ParseStreamRangeBound(to, false)
+	if err != nil {
+		return err
+	}
+	count := 0
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "COUNT" {
+			return fmt.Errorf("syntax error")
+		}
+		if count, err = atoi(args[4]); err != nil {
+			return err
+		}
+		if count <= 0 {
+			c.reply.Array(0)
+			return nil
+		}
+	}
+
+	entries, err := s.store.XRange(args[0], start, end, count, rev)
+	if err != nil {
+		return err
+	}
+	writeStreamEntries(c, entries)
+	return nil
+}
+
+// parseStreamIDs parses a list of complete stream IDs.
+func parseStreamIDs(args []string) ([]idis.StreamID, error) {
+	ids := make([]idis.StreamID, 0, len(args))
+	for _, arg := range args {
+		id, err := idis.ParseStreamID(arg)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *Server) handleXDel(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: XDEL key id [id ...]")
+	}
+	ids, err := parseStreamIDs(args[1:])
+	if err != nil {
+		return err
+	}
+	n, err := s.store.XDel(args[0], ids...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleXTrim serves XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count].
+func (s *Server) handleXTrim(c *client, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]")
+	}
+	switch strings.ToUpper(args[1]) {
+	case "MAXLEN", "MINID":
+	default:
+		return fmt.Errorf("syntax error")
+	}
+	trim, i, err := parseStreamTrim(args, 1)
+	if err != nil {
+		return err
+	}
+	if i != len(args) {
+		return fmt.Errorf("syntax error")
+	}
+	n, err := s.store.XTrim(args[0], trim)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// streamReadArgs holds the options shared by XREAD and XREADGROUP.
+type streamReadArgs struct {
+	group, consumer string
+	count           int
+	block           bool
+	timeout         time.Duration
+	noAck           bool
+	keys, ids       []string
+}
+
+// parseStreamRead parses [GROUP group consumer] [COUNT count] [BLOCK ms]
+// [NOACK] STREAMS key [key ...] id [id ...].
+func parseStreamRead(args []string, withGroup bool) (streamReadArgs, error) {
+	var a streamReadArgs
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "GROUP" && withGroup && i+2 < len(args):
+			a.group, a.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := atoi(args[i+1])
+			if err != nil {
+				return a, err
+			}
+			a.count = n
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return a, fmt.Errorf("timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return a, fmt.Errorf("timeout is negative")
+			}
+			a.block, a.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+		case opt == "NOACK" && withGroup:
+			a.noAck = true
+		case opt == "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return a, fmt.Errorf("Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			a.keys, a.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			if withGroup && a.group == "" {
+				return a, fmt.Errorf("Missing GROUP option for XREADGROUP")
+			}
+			return a, nil
+		default:
+			return a, fmt.Errorf("syntax error")
+		}
+	}
+	return a, fmt.Errorf("syntax error")
+}
+
+// handleXRead serves XREAD [COUNT count] [BLOCK ms] STREAMS key [key ...] id [id ...].
+func (s *Server) handleXRead(c *client, args []string) error {
+	a, err := parseStreamRead(args, false)
+	if err != nil {
+		return err
+	}
+	for _, id := range a.ids {
+		if id == ">" {
+			return fmt.Errorf("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		}
+	}
+
+	ctx, stop := context.Background(), func() bool { return false }
+	if a.block {
+		c.out.Flush()
+		ctx, stop = c.block(a.timeout)
+	}
+	reads, err := s.store.XRead(ctx, a.keys, a.ids, a.count, a.block)
+	stop()
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		c.reply.NullArray()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	writeStreamReads(c, reads)
+	return nil
+}
+
+// handleXReadGroup serves XREADGROUP GROUP group consumer [COUNT count]
+// [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...].
+func (s *Server) handleXReadGroup(c *client, args []string) error {
+	a, err := parseStreamRead(args, true)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := context.Background(), func() bool { return false }
+	if a.block {
+		c.out.Flush()
+		ctx, stop = c.block(a.timeout)
+	}
+	reads, err := s.store.XReadGroup(ctx, a.group, a.consumer, a.keys, a.ids, a.count, a.noAck, a.block)
+	stop()
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		c.reply.NullArray()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	writeStreamReads(c, reads)
+	return nil
+}
+
+// handleXGroup serves the XGROUP subcommands CREATE, DESTROY, SETID,
+// CREATECONSUMER and DELCONSUMER.
+func (s *Server) handleXGroup(c *client, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: XGROUP CREATE|DESTROY|SETID|CREATECONSUMER|DELCONSUMER key group ...")
+	}
+	key, group := args[1], args[2]
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "CREATE":
+		if len(args) < 4 || len(args) > 5 {
+			return fmt.Errorf("usage: XGROUP CREATE key group id|$ [MKSTREAM]")
+		}
+		mkStream := false
+		if len(args) == 5 {
+			if strings.ToUpper(args[4]) != "MKSTREAM" {
+				return fmt.Errorf("syntax error")
+			}
+			mkStream = true
+		}
+		if err := s.store.XGroupCreate(key, group, args[3], mkStream); err != nil {
+			return err
+		}
+		c.reply.Status("OK")
+	case "DESTROY":
+		ok, err := s.store.XGroupDestroy(key, group)
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.reply.Int(1)
+		} else {
+			c.reply.Int(0)
+		}
+	case "SETID":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: XGROUP SETID key group id|$")
+		}
+		if err := s.store.XGroupSetID(key, group, args[3]); err != nil {
+			return err
+		}
+		c.reply.Status("OK")
+	case "CREATECONSUMER":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: XGROUP CREATECONSUMER key group consumer")
+		}
+		ok, err := s.store.XGroupCreateConsumer(key, group, args[3])
+		if err != nil {
+			return err
+		}
+		if ok {
+			c.reply.Int(1)
+		} else {
+			c.reply.Int(0)
+		}
+	case "DELCONSUMER":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: XGROUP DELCONSUMER key group consumer")
+		}
+		n, err := s.store.XGroupDelConsumer(key, group, args[3])
+		if err != nil {
+			return err
+		}
+		c.reply.Int(int64(n))
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	return nil
+}
+
+func (s *Server) handleXAck(c *client, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: XACK key group id [id ...]")
+	}
+	ids, err := parseStreamIDs(args[2:])
+	if err != nil {
+		return err
+	}
+	n, err := s.store.XAck(args[0], args[1], ids...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleXPending serves XPENDING key group [start end count [consumer]].
+func (s *Server) handleXPending(c *client, args []string) error {
+	if len(args) != 2 && len(args) != 5 && len(args) != 6 {
+		return fmt.Errorf("usage: XPENDING key group [start end count [consumer]]")
+	}
+	key, group := args[0], args[1]
+
+	if len(args) == 2 {
+		summary, err := s.store.XPending(key, group)
+		if err != nil {
+			return err
+		}
+		c.reply.Array(4)
+		c.reply.Int(int64(summary.Count))
+		if summary.Count == 0 {
+			c.reply.Null()
+			c.reply.Null()
+			c.reply.Null()
+			return nil
+		}
+		c.reply.Bulk(summary.Lowest)
+		c.reply.Bulk(summary.Highest)
+		c.reply.Array(len(summary.Consumers))
+		for consumer, n := range summary.Consumers {
+			c.reply.Strings([]string{consumer, strconv.Itoa(n)})
+		}
+		return nil
+	}
+
+	start, err := idis.ParseStreamRangeBound(args[2], true)
+	if err != nil {
+		return err
+	}
+	end, err := idis.ParseStreamRangeBound(args[3], false)
+	if err != nil {
+		return err
+	}
+	count, err := atoi(args[4])
+	if err != nil {
+		return err
+	}
+	consumer := ""
+	if len(args) == 6 {
+		consumer = args[5]
+	}
+	if count <= 0 {
+		c.reply.Array(0)
+		return nil
+	}
+	entries, err := s.store.XPendingRange(key, group, start, end, count, consumer)
+	if err != nil {
+		return err
+	}
+	c.reply.Array(len(entries))
+	for _, p := range entries {
+		c.reply.Array(4)
+		c.reply.Bulk(p.ID.String())
+		c.reply.Bulk(p.Consumer)
+		c.reply.Int(p.Idle.Milliseconds())
+		c.reply.Int(int64(p.DeliveryCount))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-idis/internal/idis"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerXAdd returns an HTTP handler appending the fields of a JSON object
+// to a stream. The entry ID defaults to "*"; pass maxlen to cap the stream,
+// e.g. /xadd/events?maxlen=1000.
+func (s *Server) handlerXAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for fields
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body) == 0 {
+			http.Error(w, "Invalid request body. Expected a non-empty JSON object of string fields.", http.StatusBadRequest)
+			return
+		}
+		names := make([]string, 0, len(body))
+		for f := range body {
+			names = append(names, f)
+		}
+		sort.Strings(names)
+		fields := make([]string, 0, len(body)*2)
+		for _, f := range names {
+			fields = append(fields, f, body[f])
+		}
+
+		query := r.URL.Query()
+		trim := idis.NoTrim
+		if v := query.Get("maxlen"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid maxlen value", http.StatusBadRequest)
+				return
+			}
+			trim.MaxLen = n
+		}
+
+		id, _, err := s.store.XAdd(key, queryDefault(query.Get("id"), "*"), fields, false, trim)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error adding to stream '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]string{"id": id.String()}}, http.StatusOK, nil)
+	}
+}
+
+// handlerXRange returns an HTTP handler for reading a range of a stream,
+// e.g. /xrange/events?start=-&end=%2B&count=10.
+func (s *Server) handlerXRange() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		start, err1 := idis.ParseStreamRangeBound(queryDefault(query.Get("start"), "-"), true)
+		end, err2 := idis.ParseStreamRangeBound(queryDefault(query.Get("end"), "+"), false)
+		count, err3 := strconv.Atoi(queryDefault(query.Get("count"), "0"))
+		if err1 != nil || err2 != nil || err3 != nil {
+			http.Error(w, "Invalid start, end or count value", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := s.store.XRange(key, start, end, count, query.Get("rev") == "true")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading stream '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     key,
+			"entries": entries,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
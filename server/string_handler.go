@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+func (s *Server) handleSetString(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: SETSTR key value")
+	}
+	if err := s.store.SetString(args[0], args[1]); err != nil {
+		return err
+	}
+	c.reply.Status("OK")
+	return nil
+}
+
+func (s *Server) handleGetString(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: GETSTR key")
+	}
+	value, err := s.store.GetString(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Bulk(value)
+	return nil
+}
+
+// handleIncrBy serves INCR, DECR, INCRBY and DECRBY; sign is -1 for the DECR forms.
+func (s *Server) handleIncrBy(c *client, args []string, name string, sign int64) error {
+	byArg := name == "INCRBY" || name == "DECRBY"
+	if byArg && len(args) != 2 {
+		return fmt.Errorf("usage: %s key increment", name)
+	}
+	if !byArg && len(args) != 1 {
+		return fmt.Errorf("usage: %s key", name)
+	}
+
+	delta := int64(1)
+	if byArg {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("value is not an integer or out of range")
+		}
+		if sign < 0 && n == math.MinInt64 {
+			return fmt.Errorf("decrement would overflow")
+		}
+		delta = n
+	}
+
+	n, err := s.store.IncrBy(args[0], sign*delta)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(n)
+	return nil
+}
+
+func (s *Server) handleAppend(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: APPEND key value")
+	}
+	n, err := s.store.Append(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleStrLen(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: STRLEN key")
+	}
+	n, err := s.store.StrLen(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerGetString returns an HTTP handler for retrieving the string stored at a key.
+func (s *Server) handlerGetString() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		value, err := s.store.GetString(key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":   key,
+			"value": value,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerSetString returns an HTTP handler for storing a string at a key.
+func (s *Server) handlerSetString() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for the value
+		var value string
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON string.", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.store.SetString(key, value); err != nil {
+			http.Error(w, fmt.Sprintf("Error setting key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: "OK"}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/idis"
+)
+
+// txCommands run immediately rather than being queued inside MULTI.
+var txCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"QUIT":    true,
+	"EXIT":    true,
+}
+
+// blockingCommands may wait for other clients. They run without the
+// transaction lock, and do not wait when run inside a transaction.
+var blockingCommands = map[string]bool{
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BLMOVE":     true,
+	"XREAD":      true,
+	"XREADGROUP": true,
+}
+
+// untxCommands cannot be part of a transaction.
+var untxCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"MONITOR":      true,
+}
+
+// queueCommand queues a command sent after MULTI. A command that cannot be
+// queued, unknown or not allowed in a transaction, fails the transaction, so
+// the following EXEC aborts.
+func (s *Server) queueCommand(c *client, command string, parts []string) error {
+	if s.lookupCommand(command) == nil {
+		c.failed = true
+		return fmt.Errorf("%w '%s'", errUnknownCommand, parts[0])
+	}
+	if untxCommands[command] {
+		c.failed = true
+		return fmt.Errorf("Command not allowed inside a transaction")
+	}
+	c.queued = append(c.queued, parts)
+	c.reply.Status("QUEUED")
+	return nil
+}
+
+// resetTx leaves MULTI and forgets the watched keys.
+func (c *client) resetTx() {
+	c.multi = false
+	c.failed = false
+	c.queued = nil
+	c.watched = nil
+}
+
+func (s *Server) handleMulti(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: MULTI")
+	}
+	if c.multi {
+		return fmt.Errorf("calls to MULTI can not be nested")
+	}
+	c.multi = true
+	c.reply.Status("OK")
+	return nil
+}
+
+// handleExec runs the commands queued since MULTI as one atomic step and
+// replies with their results, or with nil when a watched key was modified.
+func (s *Server) handleExec(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: EXEC")
+	}
+	if !c.multi {
+		return fmt.Errorf("no MULTI to EXEC")
+	}
+	queued, watched, failed := c.queued, c.watched, c.failed
+	c.resetTx()
+	if failed {
+		return &idis.CodedError{Code: "EXECABORT", Msg: "Transaction discarded because of previous errors."}
+	}
+	if !s.exec(c, queued, watched) {
+		c.reply.NullArray()
+	}
+	return nil
+}
+
+// exec runs queued commands under the exclusive transaction lock, so no other
+// command sees their intermediate state, and replies with an array of their
+// results. It reports false, running nothing, if any watched key has moved
+// on from the version recorded.
+func (s *Server) exec(c *client, queued [][]string, watched map[string]uint64) bool {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	for key, version := range watched {
+		if s.store.Version(key) != version {
+			return false
+		}
+	}
+
+	c.execing = true
+	defer func() { c.execing = false }()
+	c.reply.Array(len(queued))
+	for _, parts := range queued {
+		if err := s.execute(c, parts); err != nil {
+			c.reply.Error(err)
+		}
+	}
+	return true
+}
+
+func (s *Server) handleDiscard(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: DISCARD")
+	}
+	if !c.multi {
+		return fmt.Errorf("no MULTI to DISCARD")
+	}
+	c.resetTx()
+	c.reply.Status("OK")
+	return nil
+}
+
+// handleWatch records the current version of keys. The next EXEC aborts if
+// any of them is modified before it runs.
+func (s *Server) handleWatch(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: WATCH key [key ...]")
+	}
+	if c.multi {
+		return fmt.Errorf("cannot WATCH inside MULTI")
+	}
+	if c.watched == nil {
+		c.watched = make(map[string]uint64, len(args))
+	}
+	for _, key := range args {
+		// Watching a key again keeps the version first seen
+		if _, ok := c.watched[key]; !ok {
+			c.watched[key] = s.store.Version(key)
+		}
+	}
+	c.reply.Status("OK")
+	return nil
+}
+
+func (s *Server) handleUnwatch(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: UNWATCH")
+	}
+	c.watched = nil
+	c.reply.Status("OK")
+	return nil
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// unguardedRoutes name the routes that do not run under the shared
+// transaction lock: event streams would hold it for as long as they are
+// open, and /tx takes it exclusively.
+var unguardedRoutes = map[string]bool{"subscribe": true, "monitor": true, "tx": true}
+
+// txGuard is a middleware running HTTP handlers under the shared transaction
+// lock, as processCommand does for the TCP listeners.
+func (s *Server) txGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route == nil || !unguardedRoutes[route.GetName()] {
+			s.txMu.RLock()
+			defer s.txMu.RUnlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// txRequest is the body accepted by /tx. Watch maps keys to the versions
+// returned by /version/{key}; the transaction is aborted if any has changed.
+type txRequest struct {
+	Watch    map[string]uint64 `json:"watch"`
+	Commands [][]string        `json:"commands"`
+}
+
+// handlerTx returns an HTTP handler running a batch of commands atomically,
+// like MULTI/EXEC, e.g.
+//
+//	{"watch": {"src": 42}, "commands": [["REMOVE", "src", "v"], ["SET", "dst", "v"]]}
+//
+// The result of each command is returned in order; a failed command yields
+// an object with an error and does not stop the others.
+func (s *Server) handlerTx() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req txRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Commands) == 0 {
+			http.Error(w, "Invalid request body. Expected a JSON object with a non-empty array of commands.", http.StatusBadRequest)
+			return
+		}
+		for _, parts := range req.Commands {
+			if len(parts) == 0 {
+				http.Error(w, "Invalid request body. Commands must not be empty.", http.StatusBadRequest)
+				return
+			}
+			command := strings.ToUpper(parts[0])
+			if s.lookupCommand(command) == nil {
+				http.Error(w, fmt.Sprintf("Unknown command '%s'", parts[0]), http.StatusBadRequest)
+				return
+			}
+			if txCommands[command] || untxCommands[command] {
+				http.Error(w, fmt.Sprintf("Command '%s' is not allowed in a transaction", parts[0]), http.StatusBadRequest)
+				return
+			}
+		}
+
+		reply := &jsonWriter{}
+		c := &client{
+			id:       s.nextClientID.Add(1),
+			addr:     r.RemoteAddr,
+			listener: "http",
+			out:      bufio.NewWriter(io.Discard),
+			reply:    reply,
+			proto:    3,
+		}
+		if !s.exec(c, req.Commands, req.Watch) {
+			http.Error(w, "Transaction aborted: a watched key was modified", http.StatusConflict)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]interface{}{"results": reply.values[0]}}, http.StatusOK, nil)
+	}
+}
+
+// handlerVersion returns an HTTP handler reporting the version of a key, for
+// use in the watch object of /tx.
+func (s *Server) handlerVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     key,
+			"version": s.store.Version(key),
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// jsonWriter collects replies as values encodable to JSON, so commands can
+// be run on behalf of HTTP clients.
+type jsonWriter struct {
+	values []interface{} // completed top-level replies
+	frames []*jsonFrame
+}
+
+type jsonFrame struct {
+	n     int // number of elements, counting keys and values for maps
+	isMap bool
+	items []interface{}
+}
+
+// add appends v to the innermost open aggregate, completing any aggregates
+// it fills.
+func (j *jsonWriter) add(v interface{}) {
+	for len(j.frames) > 0 {
+		f := j.frames[len(j.frames)-1]
+		f.items = append(f.items, v)
+		if len(f.items) < f.n {
+			return
+		}
+		j.frames = j.frames[:len(j.frames)-1]
+		v = f.value()
+	}
+	j.values = append(j.values, v)
+}
+
+func (f *jsonFrame) value() interface{} {
+	if !f.isMap {
+		return f.items
+	}
+	m := make(map[string]interface{}, len(f.items)/2)
+	for i := 0; i+1 < len(f.items); i += 2 {
+		m[fmt.Sprint(f.items[i])] = f.items[i+1]
+	}
+	return m
+}
+
+func (j *jsonWriter) aggregate(n int, isMap bool) {
+	if isMap {
+		n *= 2
+	}
+	f := &jsonFrame{n: n, isMap: isMap, items: make([]interface{}, 0, n)}
+	if n == 0 {
+		j.add(f.value())
+		return
+	}
+	j.frames = append(j.frames, f)
+}
+
+func (j *jsonWriter) Status(s string) { j.add(s) }
+func (j *jsonWriter) Error(err error) { j.add(map[string]string{"error": err.Error()}) }
+func (j *jsonWriter) Int(n int64)     { j.add(n) }
+func (j *jsonWriter) Bulk(s string)   { j.add(s) }
+func (j *jsonWriter) Null()           { j.add(nil) }
+func (j *jsonWriter) NullArray()      { j.add(nil) }
+func (j *jsonWriter) Float(f float64) {
+	// JSON has no infinities
+	if math.IsInf(f, 0) {
+		j.add(formatFloat(f))
+	} else {
+		j.add(f)
+	}
+}
+func (j *jsonWriter) Array(n int)        { j.aggregate(n, false) }
+func (j *jsonWriter) Map(n int)          { j.aggregate(n, true) }
+func (j *jsonWriter) Push(n int)         { j.aggregate(n, false) }
+func (j *jsonWriter) Flush() error       { return nil }
+func (j *jsonWriter) Strings(v []string) { writeStrings(j, v) }
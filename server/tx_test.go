@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// expect checks that a reply is want.
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s = %#v, want %#v", what, got, want)
+	}
+}
+
+// expectError checks that a reply is an error starting with prefix.
+func expectError(t *testing.T, what string, got interface{}, prefix string) {
+	t.Helper()
+	if err, ok := got.(replyError); !ok || !strings.HasPrefix(string(err), prefix) {
+		t.Fatalf("%s = %#v, want an error starting with %q", what, got, prefix)
+	}
+}
+
+func TestExecWatch(t *testing.T) {
+	s := newTestServer(t)
+	a, b := dial(t, s), dial(t, s)
+
+	// Untouched watched keys let EXEC run
+	expect(t, "WATCH", a.do("WATCH", "k"), "OK")
+	expect(t, "MULTI", a.do("MULTI"), "OK")
+	expect(t, "SETSTR", a.do("SETSTR", "k", "1"), "QUEUED")
+	expect(t, "EXEC", a.do("EXEC"), []interface{}{"OK"})
+
+	// A write by another client in between aborts it
+	expect(t, "WATCH", a.do("WATCH", "k"), "OK")
+	expect(t, "SETSTR from b", b.do("SETSTR", "k", "2"), "OK")
+	expect(t, "MULTI", a.do("MULTI"), "OK")
+	expect(t, "SETSTR", a.do("SETSTR", "k", "3"), "QUEUED")
+	expect(t, "aborted EXEC", a.do("EXEC"), nil)
+	expect(t, "GETSTR", a.do("GETSTR", "k"), "2")
+
+	// EXEC forgets the watched keys
+	expect(t, "SETSTR from b", b.do("SETSTR", "k", "4"), "OK")
+	expect(t, "MULTI", a.do("MULTI"), "OK")
+	expect(t, "SETSTR", a.do("SETSTR", "k", "5"), "QUEUED")
+	expect(t, "EXEC", a.do("EXEC"), []interface{}{"OK"})
+	expect(t, "GETSTR", a.do("GETSTR", "k"), "5")
+}
+
+func TestExecAbortAfterQueueError(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		err     string
+	}{
+		{"unknown command", []string{"NOSUCHCMD", "k"}, "ERR unknown command"},
+		{"command not allowed", []string{"SUBSCRIBE", "ch"}, "ERR Command not allowed inside a transaction"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			c := dial(t, s)
+			expect(t, "MULTI", c.do("MULTI"), "OK")
+			expect(t, "SETSTR", c.do("SETSTR", "k", "v"), "QUEUED")
+			expectError(t, tt.command[0], c.do(tt.command...), tt.err)
+			// Later commands are still queued, only to be discarded
+			expect(t, "SETSTR", c.do("SETSTR", "other", "v"), "QUEUED")
+			expectError(t, "EXEC", c.do("EXEC"), "EXECABORT")
+			expect(t, "EXISTS k", c.do("EXISTS", "k"), int64(0))
+			expect(t, "EXISTS other", c.do("EXISTS", "other"), int64(0))
+
+			// The connection leaves the transaction
+			expect(t, "SETSTR", c.do("SETSTR", "k", "v"), "OK")
+		})
+	}
+}
+
+func TestExecErrorDoesNotAbort(t *testing.T) {
+	s := newTestServer(t)
+	c := dial(t, s)
+	expect(t, "SETSTR", c.do("SETSTR", "s", "text"), "OK")
+	expect(t, "MULTI", c.do("MULTI"), "OK")
+	expect(t, "SADD", c.do("SADD", "s", "m"), "QUEUED")
+	expect(t, "INCR", c.do("INCR", "s"), "QUEUED")
+	expect(t, "SETSTR", c.do("SETSTR", "t", "v"), "QUEUED")
+
+	replies, ok := c.do("EXEC").([]interface{})
+	if !ok || len(replies) != 3 {
+		t.Fatalf("EXEC = %#v, want 3 replies", replies)
+	}
+	expectError(t, "SADD", replies[0], "WRONGTYPE")
+	expectError(t, "INCR", replies[1], "ERR")
+	expect(t, "SETSTR", replies[2], "OK")
+	expect(t, "GETSTR", c.do("GETSTR", "t"), "v")
+}
+
+// postTx runs a /tx request and returns the status and the results.
+func postTx(t *testing.T, s *Server, body string) (int, []interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tx", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	// respond wraps the ResponseMsg built by the handler in another
+	var resp struct {
+		Data struct {
+			Data struct {
+				Results []interface{} `json:"results"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Errorf("decoding %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp.Data.Data.Results
+}
+
+func TestHTTPTx(t *testing.T) {
+	s := newTestServer(t)
+	s.RegisterAPIs()
+
+	code, results := postTx(t, s, `{"commands": [["SETSTR", "s", "text"], ["INCR", "s"], ["SETSTR", "t", "v"]]}`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if len(results) != 3 || results[0] != "OK" || results[2] != "OK" {
+		t.Fatalf("results = %v, want OK, an error and OK", results)
+	}
+	if _, ok := results[1].(map[string]interface{})["error"]; !ok {
+		t.Fatalf("INCR result = %v, want an error", results[1])
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"watched key modified", `{"watch": {"t": 0}, "commands": [["SETSTR", "t", "w"]]}`, http.StatusConflict},
+		{"unknown command", `{"commands": [["SETSTR", "t", "w"], ["NOSUCHCMD"]]}`, http.StatusBadRequest},
+		{"command not allowed", `{"commands": [["SETSTR", "t", "w"], ["MULTI"]]}`, http.StatusBadRequest},
+		{"no commands", `{"commands": []}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code, _ := postTx(t, s, tt.body); code != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, code, tt.code)
+		}
+	}
+	// None of the rejected batches ran
+	c := dial(t, s)
+	expect(t, "GETSTR", c.do("GETSTR", "t"), "v")
+}
+
+func TestHTTPTxAtomic(t *testing.T) {
+	s := newTestServer(t)
+	s.RegisterAPIs()
+	c := dial(t, s)
+	expect(t, "SETSTR", c.do("SETSTR", "a", "0"), "OK")
+	expect(t, "SETSTR", c.do("SETSTR", "b", "0"), "OK")
+
+	const writers, batches = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < batches; j++ {
+				if code, _ := postTx(t, s, `{"commands": [["INCR", "a"], ["INCR", "b"]]}`); code != http.StatusOK {
+					t.Errorf("status = %d, want %d", code, http.StatusOK)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// A transaction over RESP never sees one key incremented without the
+	// other
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		c.do("MULTI")
+		c.do("GETSTR", "a")
+		c.do("GETSTR", "b")
+		replies := c.do("EXEC").([]interface{})
+		if replies[0] != replies[1] {
+			t.Fatalf("EXEC saw a = %v and b = %v", replies[0], replies[1])
+		}
+	}
+	want := strconv.Itoa(writers * batches)
+	expect(t, "GETSTR a", c.do("GETSTR", "a"), want)
+	expect(t, "GETSTR b", c.do("GETSTR", "b"), want)
+}
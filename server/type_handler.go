@@ -0,0 +1,17 @@
+package server
+
+import (
+	"fmt"
+)
+
+func (s *Server) handleType(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: TYPE key")
+	}
+	typ, err := s.store.Type(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Status(typ)
+	return nil
+}
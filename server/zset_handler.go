@@ -0,0 +1,330 @@
+package server
+
+import (
+	"fmt"
+	"go-idis/internal/idis"
+	"strconv"
+	"strings"
+)
+
+// writeScored writes sorted set members, followed by their scores when
+// withScores is set. RESP3 clients receive [member, score] pairs as Redis 7
+// does; RESP2 and telnet clients receive a flat list.
+func writeScored(c *client, members []idis.ScoredMember, withScores bool) {
+	if !withScores {
+		c.reply.Array(len(members))
+		for _, m := range members {
+			c.reply.Bulk(m.Member)
+		}
+		return
+	}
+	if c.proto >= 3 {
+		c.reply.Array(len(members))
+		for _, m := range members {
+			c.reply.Array(2)
+			c.reply.Bulk(m.Member)
+			c.reply.Float(m.Score)
+		}
+		return
+	}
+	c.reply.Array(len(members) * 2)
+	for _, m := range members {
+		c.reply.Bulk(m.Member)
+		c.reply.Float(m.Score)
+	}
+}
+
+func (s *Server) handleZAdd(c *client, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]")
+	}
+	key := args[0]
+
+	var opts idis.ZAddOptions
+	incr := false
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return fmt.Errorf("syntax error")
+	}
+	if opts.NX && opts.XX {
+		return fmt.Errorf("XX and NX options at the same time are not compatible")
+	}
+	if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+		return fmt.Errorf("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return fmt.Errorf("INCR option supports a single increment-element pair")
+	}
+
+	members := make([]idis.ScoredMember, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := idis.ParseScore(pairs[j])
+		if err != nil {
+			return err
+		}
+		members = append(members, idis.ScoredMember{Member: pairs[j+1], Score: score})
+	}
+
+	if incr {
+		score, ok, err := s.store.ZAddIncr(key, opts, members[0])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.reply.Null()
+		} else {
+			c.reply.Float(score)
+		}
+		return nil
+	}
+
+	n, err := s.store.ZAdd(key, opts, members...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleZRem(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ZREM key member1 member2 ... memberN")
+	}
+	n, err := s.store.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+func (s *Server) handleZScore(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ZSCORE key member")
+	}
+	score, ok, err := s.store.ZScore(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Float(score)
+	}
+	return nil
+}
+
+func (s *Server) handleZCard(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ZCARD key")
+	}
+	n, err := s.store.ZCard(args[0])
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleZRank serves ZRANK and ZREVRANK.
+func (s *Server) handleZRank(c *client, args []string, rev bool) error {
+	if len(args) != 2 {
+		if rev {
+			return fmt.Errorf("usage: ZREVRANK key member")
+		}
+		return fmt.Errorf("usage: ZRANK key member")
+	}
+	rank, ok, err := s.store.ZRank(args[0], args[1], rev)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.reply.Null()
+	} else {
+		c.reply.Int(int64(rank))
+	}
+	return nil
+}
+
+func (s *Server) handleZCount(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: ZCOUNT key min max")
+	}
+	min, err := idis.ParseScoreBound(args[1])
+	if err != nil {
+		return err
+	}
+	max, err := idis.ParseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	n, err := s.store.ZCount(args[0], min, max)
+	if err != nil {
+		return err
+	}
+	c.reply.Int(int64(n))
+	return nil
+}
+
+// handleZPop serves ZPOPMIN and ZPOPMAX.
+func (s *Server) handleZPop(c *client, args []string, max bool) error {
+	if len(args) < 1 || len(args) > 2 {
+		if max {
+			return fmt.Errorf("usage: ZPOPMAX key [count]")
+		}
+		return fmt.Errorf("usage: ZPOPMIN key [count]")
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("value is out of range, must be positive")
+		}
+		count = n
+	}
+	members, err := s.store.ZPop(args[0], count, max)
+	if err != nil {
+		return err
+	}
+	writeScored(c, members, true)
+	return nil
+}
+
+// zrangeQuery describes a parsed ZRANGE family command.
+type zrangeQuery struct {
+	by         string // "rank", "score" or "lex"
+	rev        bool
+	withScores bool
+	offset     int
+	count      int
+}
+
+// handleZRange serves ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES].
+func (s *Server) handleZRange(c *client, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]")
+	}
+	q := zrangeQuery{by: "rank", count: -1}
+	return s.zrange(c, args[0], args[1], args[2], q, args[3:])
+}
+
+// handleZRangeBy serves ZRANGEBYSCORE, ZRANGEBYLEX and ZREVRANGE, which
+// are ZRANGE with BYSCORE, BYLEX or REV implied.
+func (s *Server) handleZRangeBy(c *client, args []string, name string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: %s key min max [WITHSCORES] [LIMIT offset count]", name)
+	}
+	q := zrangeQuery{by: "rank", count: -1}
+	switch name {
+	case "ZRANGEBYSCORE":
+		q.by = "score"
+	case "ZRANGEBYLEX":
+		q.by = "lex"
+	case "ZREVRANGE":
+		q.rev = true
+	}
+	return s.zrange(c, args[0], args[1], args[2], q, args[3:])
+}
+
+func (s *Server) zrange(c *client, key, start, stop string, q zrangeQuery, opts []string) error {
+	limit := false
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "BYSCORE":
+			q.by = "score"
+		case "BYLEX":
+			q.by = "lex"
+		case "REV":
+			q.rev = true
+		case "WITHSCORES":
+			q.withScores = true
+		case "LIMIT":
+			if i+2 >= len(opts) {
+				return fmt.Errorf("syntax error")
+			}
+			offset, err1 := strconv.Atoi(opts[i+1])
+			count, err2 := strconv.Atoi(opts[i+2])
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("value is not an integer or out of range")
+			}
+			q.offset, q.count, limit = offset, count, true
+			i += 2
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	if limit && q.by == "rank" {
+		return fmt.Errorf("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if q.withScores && q.by == "lex" {
+		return fmt.Errorf("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	if q.offset < 0 {
+		// A negative offset always selects nothing
+		c.reply.Array(0)
+		return nil
+	}
+
+	// With REV the range is given from max to min
+	if q.rev && q.by != "rank" {
+		start, stop = stop, start
+	}
+
+	var members []idis.ScoredMember
+	var err error
+	switch q.by {
+	case "score":
+		min, perr := idis.ParseScoreBound(start)
+		if perr != nil {
+			return perr
+		}
+		max, perr := idis.ParseScoreBound(stop)
+		if perr != nil {
+			return perr
+		}
+		members, err = s.store.ZRangeByScore(key, min, max, q.rev, q.offset, q.count)
+	case "lex":
+		min, perr := idis.ParseLexBound(start)
+		if perr != nil {
+			return perr
+		}
+		max, perr := idis.ParseLexBound(stop)
+		if perr != nil {
+			return perr
+		}
+		members, err = s.store.ZRangeByLex(key, min, max, q.rev, q.offset, q.count)
+	default:
+		from, err1 := strconv.Atoi(start)
+		to, err2 := strconv.Atoi(stop)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("value is not an integer or out of range")
+		}
+		members, err = s.store.ZRangeByRank(key, from, to, q.rev)
+	}
+	if err != nil {
+		return err
+	}
+	writeScored(c, members, q.withScores)
+	return nil
+}
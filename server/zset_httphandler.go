@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-idis/internal/idis"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// handlerZAdd returns an HTTP handler for adding scored members to a sorted set.
+// ZADD flags are passed as query parameters, e.g. /zadd/board?xx=true&ch=true.
+func (s *Server) handlerZAdd() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for members
+		var members []idis.ScoredMember
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
+			http.Error(w, `Invalid request body. Expected a JSON array of {"member": ..., "score": ...} objects.`, http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		opts := idis.ZAddOptions{
+			NX: query.Get("nx") == "true",
+			XX: query.Get("xx") == "true",
+			GT: query.Get("gt") == "true",
+			LT: query.Get("lt") == "true",
+			CH: query.Get("ch") == "true",
+		}
+		if opts.NX && (opts.XX || opts.GT || opts.LT) || (opts.GT && opts.LT) {
+			http.Error(w, "Incompatible ZADD flags", http.StatusBadRequest)
+			return
+		}
+
+		changed, err := s.store.ZAdd(key, opts, members...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error adding members to key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"changed": changed}}, http.StatusOK, nil)
+	}
+}
+
+// handlerZRem returns an HTTP handler for removing members from a sorted set.
+func (s *Server) handlerZRem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Parse the request body for members
+		var members []string
+		if err := json.NewDecoder(r.Body).Decode(&members); err != nil {
+			http.Error(w, "Invalid request body. Expected a JSON array of members.", http.StatusBadRequest)
+			return
+		}
+
+		removed, err := s.store.ZRem(key, members...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error removing members from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"removed": removed}}, http.StatusOK, nil)
+	}
+}
+
+// handlerZScore returns an HTTP handler for retrieving the score of a member.
+func (s *Server) handlerZScore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, member := vars["key"], vars["member"]
+
+		score, found, err := s.store.ZScore(key, member)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving score from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Member '%s' not found in key '%s'", member, key), http.StatusNotFound)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: idis.ScoredMember{Member: member, Score: score}}, http.StatusOK, nil)
+	}
+}
+
+// handlerZRank returns an HTTP handler for retrieving the rank of a member.
+// Pass rev=true to rank from the highest score.
+func (s *Server) handlerZRank() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, member := vars["key"], vars["member"]
+
+		rank, found, err := s.store.ZRank(key, member, r.URL.Query().Get("rev") == "true")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving rank from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Member '%s' not found in key '%s'", member, key), http.StatusNotFound)
+			return
+		}
+
+		response := map[string]interface{}{
+			"member": member,
+			"rank":   rank,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerZRange returns an HTTP handler for range queries on a sorted set.
+//
+//	/zrange/{key}?start=0&stop=-1            by index
+//	/zrange/{key}?by=score&min=1&max=(5      by score
+//	/zrange/{key}?by=lex&min=[a&max=+        by member
+//
+// rev=true reverses the order; offset and count limit score and lex ranges.
+func (s *Server) handlerZRange() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		rev := query.Get("rev") == "true"
+		offset, count := 0, -1
+		if v := query.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset value", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+		if v := query.Get("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid count value", http.StatusBadRequest)
+				return
+			}
+			count = n
+		}
+
+		var members []idis.ScoredMember
+		var err error
+		switch query.Get("by") {
+		case "score":
+			min, perr := idis.ParseScoreBound(queryDefault(query.Get("min"), "-inf"))
+			max, perr2 := idis.ParseScoreBound(queryDefault(query.Get("max"), "+inf"))
+			if perr != nil || perr2 != nil {
+				http.Error(w, "Invalid min or max value", http.StatusBadRequest)
+				return
+			}
+			members, err = s.store.ZRangeByScore(key, min, max, rev, offset, count)
+		case "lex":
+			min, perr := idis.ParseLexBound(queryDefault(query.Get("min"), "-"))
+			max, perr2 := idis.ParseLexBound(queryDefault(query.Get("max"), "+"))
+			if perr != nil || perr2 != nil {
+				http.Error(w, "Invalid min or max value", http.StatusBadRequest)
+				return
+			}
+			members, err = s.store.ZRangeByLex(key, min, max, rev, offset, count)
+		case "", "rank":
+			start, err1 := strconv.Atoi(queryDefault(query.Get("start"), "0"))
+			stop, err2 := strconv.Atoi(queryDefault(query.Get("stop"), "-1"))
+			if err1 != nil || err2 != nil {
+				http.Error(w, "Invalid start or stop value", http.StatusBadRequest)
+				return
+			}
+			members, err = s.store.ZRangeByRank(key, start, stop, rev)
+		default:
+			http.Error(w, "Invalid by value. Expected rank, score or lex.", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving range from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     key,
+			"members": members,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handlerZCount returns an HTTP handler counting members within a score range.
+func (s *Server) handlerZCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		min, err1 := idis.ParseScoreBound(queryDefault(query.Get("min"), "-inf"))
+		max, err2 := idis.ParseScoreBound(queryDefault(query.Get("max"), "+inf"))
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid min or max value", http.StatusBadRequest)
+			return
+		}
+
+		n, err := s.store.ZCount(key, min, max)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error counting members of key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: map[string]int{"count": n}}, http.StatusOK, nil)
+	}
+}
+
+// handlerZPop returns an HTTP handler popping the lowest, or highest when max
+// is set, scored members from a sorted set.
+func (s *Server) handlerZPop(max bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r) // Extract variables from the URL
+		key, ok := vars["key"]
+		if !ok {
+			http.Error(w, "Key is required", http.StatusBadRequest)
+			return
+		}
+
+		count, err := strconv.Atoi(queryDefault(r.URL.Query().Get("count"), "1"))
+		if err != nil || count < 0 {
+			http.Error(w, "Invalid count value", http.StatusBadRequest)
+			return
+		}
+
+		members, err := s.store.ZPop(key, count, max)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error popping members from key '%s': %v", key, err), statusFor(err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"key":     key,
+			"members": members,
+		}
+		s.respond(w, ResponseMsg{Message: "success", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// queryDefault returns v, or def when v is empty.
+func queryDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}